@@ -0,0 +1,450 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ConfigLayerDefaults = "defaults"
+	ConfigLayerBase     = "base"
+	ConfigLayerProfile  = "profile"
+	ConfigLayerEnv      = "env"
+
+	// ConfigEnvPathSeparator separates the prefix and the path segments of the env overrides, as in APP__DB__HOST.
+	ConfigEnvPathSeparator = "__"
+
+	// ConfigListMergeReplace makes the list of a layer replace the one of the previous layers.
+	ConfigListMergeReplace = "replace"
+	// ConfigListMergeAppend appends the items of the list of a layer to the ones of the previous layers.
+	ConfigListMergeAppend = "append"
+)
+
+// ConfigSource tells where the value of a key comes from: the layer and the file, or env var, of the layer.
+type ConfigSource struct {
+	Layer  string `yaml:"layer,omitempty" mapstructure:"layer,omitempty" json:"layer,omitempty"`
+	Origin string `yaml:"origin,omitempty" mapstructure:"origin,omitempty" json:"origin,omitempty"`
+}
+
+func (s ConfigSource) String() string {
+	if s.Origin == "" {
+		return s.Layer
+	}
+	return s.Layer + ":" + s.Origin
+}
+
+// LayeredConfig is the configuration merged from the layers, from the lowest to the highest priority: embedded defaults, base file,
+// profile file and env vars. Maps are merged key by key, lists are replaced or appended according to the list merge mode and
+// a null value removes the key. The keys are dotted paths with the indexes of the lists as segments, as in db.hosts.0.
+type LayeredConfig struct {
+	defaults   []byte
+	file       string
+	profile    string
+	envPrefix  string
+	resolveEnv bool
+	secrets    bool
+	listMerge  string
+
+	data    map[string]interface{}
+	sources map[string]ConfigSource
+}
+
+type LayeredConfigOption func(c *LayeredConfig) error
+
+func WithConfigDefaults(b []byte) LayeredConfigOption {
+	return func(c *LayeredConfig) error {
+		c.defaults = b
+		return nil
+	}
+}
+
+// WithConfigFile sets the base file. The file has to exist.
+func WithConfigFile(fn string) LayeredConfigOption {
+	return func(c *LayeredConfig) error {
+		c.file = fn
+		return nil
+	}
+}
+
+// WithConfigProfile loads the profile file after the base file. It is found beside the base file with the profile appended to its name,
+// as in config-<profile>.yml. A missing profile file is an empty layer and an empty profile is ignored.
+func WithConfigProfile(profile string) LayeredConfigOption {
+	return func(c *LayeredConfig) error {
+		c.profile = profile
+		return nil
+	}
+}
+
+// WithConfigEnvPrefix enables the overrides of the env vars named after the prefix and the path of the key, as in APP__DB__HOST for db.host.
+// The segments match the keys case-insensitively with the underscores standing for dashes too. The values true and false are booleans and the decimal
+// numbers without leading zeros are numbers: anything else, as 03069 or 0x1F, is a string.
+func WithConfigEnvPrefix(prefix string) LayeredConfigOption {
+	return func(c *LayeredConfig) error {
+		c.envPrefix = prefix
+		return nil
+	}
+}
+
+// WithConfigEnvResolution resolves the env var references of the defaults and files content as ResolveConfigValueToByteArray does.
+func WithConfigEnvResolution(b bool) LayeredConfigOption {
+	return func(c *LayeredConfig) error {
+		c.resolveEnv = b
+		return nil
+	}
+}
+
+// WithConfigSecretProviders resolves the secret provider references of the defaults and files content too, as ResolveConfigValueWithSecretsToByteArray does.
+func WithConfigSecretProviders(b bool) LayeredConfigOption {
+	return func(c *LayeredConfig) error {
+		c.secrets = b
+		return nil
+	}
+}
+
+func WithConfigListMerge(mode string) LayeredConfigOption {
+	return func(c *LayeredConfig) error {
+		switch mode {
+		case ConfigListMergeReplace, ConfigListMergeAppend:
+			c.listMerge = mode
+		case "":
+			c.listMerge = ConfigListMergeReplace
+		default:
+			return fmt.Errorf("list merge mode %s not supported", mode)
+		}
+		return nil
+	}
+}
+
+func LoadLayeredConfig(opts ...LayeredConfigOption) (*LayeredConfig, error) {
+	const semLogContext = "util::load-layered-config"
+
+	c := &LayeredConfig{listMerge: ConfigListMergeReplace, data: map[string]interface{}{}, sources: map[string]ConfigSource{}}
+	for _, o := range opts {
+		if err := o(c); err != nil {
+			log.Error().Err(err).Msg(semLogContext)
+			return nil, err
+		}
+	}
+
+	if len(c.defaults) > 0 {
+		if err := c.mergeContent(c.defaults, ConfigSource{Layer: ConfigLayerDefaults}); err != nil {
+			log.Error().Err(err).Msg(semLogContext)
+			return nil, err
+		}
+	}
+
+	if c.file != "" {
+		if err := c.mergeFile(c.file, ConfigLayerBase); err != nil {
+			log.Error().Err(err).Msg(semLogContext)
+			return nil, err
+		}
+	}
+
+	if c.profile != "" {
+		if c.file == "" {
+			err := fmt.Errorf("profile %s without a base file", c.profile)
+			log.Error().Err(err).Msg(semLogContext)
+			return nil, err
+		}
+
+		// a profile without overrides has no file.
+		pfn := ProfileConfigFile(c.file, c.profile)
+		if err := c.mergeFile(pfn, ConfigLayerProfile); err != nil {
+			if !os.IsNotExist(err) {
+				log.Error().Err(err).Msg(semLogContext)
+				return nil, err
+			}
+			log.Info().Str("profile", c.profile).Str("file", pfn).Msg(semLogContext + " - profile file not found")
+		}
+	}
+
+	if c.envPrefix != "" {
+		if err := c.mergeEnv(os.Environ()); err != nil {
+			log.Error().Err(err).Msg(semLogContext)
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// ProfileConfigFile is the name of the profile file of a base file: config.yml with the dev profile is config-dev.yml.
+func ProfileConfigFile(fn string, profile string) string {
+	ext := filepath.Ext(fn)
+	return strings.TrimSuffix(fn, ext) + "-" + profile + ext
+}
+
+// Data is the merged configuration.
+func (c *LayeredConfig) Data() map[string]interface{} {
+	return c.data
+}
+
+// Source tells the layer that supplied the value of a key. Only keys of scalars and lists have a source, maps are made of the keys of many layers.
+// In append mode a list may be made of the items of many layers: once appended, the list has the source of the last layer and each item, as in servers.0,
+// the source of its own.
+func (c *LayeredConfig) Source(path string) (ConfigSource, bool) {
+	s, ok := c.sources[path]
+	return s, ok
+}
+
+// Sources maps the keys of the scalars and lists to the layer that supplied them.
+func (c *LayeredConfig) Sources() map[string]ConfigSource {
+	return c.sources
+}
+
+// SourcePaths are the keys with a source in alphabetical order.
+func (c *LayeredConfig) SourcePaths() []string {
+	paths := make([]string, 0, len(c.sources))
+	for p := range c.sources {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Bytes is the yaml of the merged configuration.
+func (c *LayeredConfig) Bytes() ([]byte, error) {
+	return yaml.Marshal(c.data)
+}
+
+// Unmarshal decodes the merged configuration into a struct with yaml tags.
+func (c *LayeredConfig) Unmarshal(v interface{}) error {
+	b, err := c.Bytes()
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(b, v)
+}
+
+func (c *LayeredConfig) mergeFile(fn string, layer string) error {
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+	return c.mergeContent(b, ConfigSource{Layer: layer, Origin: fn})
+}
+
+func (c *LayeredConfig) mergeContent(b []byte, src ConfigSource) error {
+	switch {
+	case c.secrets:
+		b = ResolveConfigValueWithSecretsToByteArray(b)
+	case c.resolveEnv:
+		b = ResolveConfigValueToByteArray(b)
+	}
+
+	var m map[string]interface{}
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return RedactError(fmt.Errorf("%s: %w", src, err))
+	}
+
+	c.mergeMap(c.data, m, "", src)
+	return nil
+}
+
+func (c *LayeredConfig) mergeMap(dst, src map[string]interface{}, path string, source ConfigSource) {
+	for k, v := range src {
+		c.mergeValue(dst, k, v, joinConfigPath(path, k), source)
+	}
+}
+
+func (c *LayeredConfig) mergeValue(dst map[string]interface{}, k string, v interface{}, path string, source ConfigSource) {
+	if v == nil {
+		delete(dst, k)
+		c.clearSources(path)
+		return
+	}
+
+	switch tv := v.(type) {
+	case map[string]interface{}:
+		current, ok := dst[k].(map[string]interface{})
+		if !ok {
+			current = map[string]interface{}{}
+			dst[k] = current
+			c.clearSources(path)
+		}
+		c.mergeMap(current, tv, path, source)
+		return
+
+	case []interface{}:
+		if current, ok := dst[k].([]interface{}); ok && c.listMerge == ConfigListMergeAppend {
+			dst[k] = append(append([]interface{}{}, current...), tv...)
+			c.appendSources(path, len(current), len(tv), source)
+			return
+		}
+	}
+
+	dst[k] = v
+	c.clearSources(path)
+	c.sources[path] = source
+}
+
+// appendSources gives the items of an appended list the source of their layer: the items already in the list keep the source of the list
+// if they don't have their own.
+func (c *LayeredConfig) appendSources(path string, n int, added int, source ConfigSource) {
+	if prev, ok := c.sources[path]; ok {
+		for i := 0; i < n; i++ {
+			if ip := joinConfigPath(path, strconv.Itoa(i)); !c.hasSources(ip) {
+				c.sources[ip] = prev
+			}
+		}
+	}
+
+	for i := n; i < n+added; i++ {
+		c.sources[joinConfigPath(path, strconv.Itoa(i))] = source
+	}
+	c.sources[path] = source
+}
+
+// hasSources tells if a key, or a key below it, has a source.
+func (c *LayeredConfig) hasSources(path string) bool {
+	if _, ok := c.sources[path]; ok {
+		return true
+	}
+	for p := range c.sources {
+		if strings.HasPrefix(p, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// clearSources forgets the sources of a key and of the keys below it.
+func (c *LayeredConfig) clearSources(path string) {
+	delete(c.sources, path)
+	for p := range c.sources {
+		if strings.HasPrefix(p, path+".") {
+			delete(c.sources, p)
+		}
+	}
+}
+
+func (c *LayeredConfig) mergeEnv(environ []string) error {
+	pfix := c.envPrefix + ConfigEnvPathSeparator
+	sort.Strings(environ)
+	for _, e := range environ {
+		name, value, ok := strings.Cut(e, "=")
+		if !ok || !strings.HasPrefix(name, pfix) {
+			continue
+		}
+
+		segments := strings.Split(strings.TrimPrefix(name, pfix), ConfigEnvPathSeparator)
+		if err := c.setEnvOverride(segments, value, ConfigSource{Layer: ConfigLayerEnv, Origin: name}); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *LayeredConfig) setEnvOverride(segments []string, value string, source ConfigSource) error {
+	v := envOverrideValue(value)
+
+	var node interface{} = c.data
+	path := ""
+	for i, seg := range segments {
+		last := i == len(segments)-1
+		switch tn := node.(type) {
+		case map[string]interface{}:
+			k := matchConfigKey(tn, seg)
+			path = joinConfigPath(path, k)
+			if last {
+				c.mergeValue(tn, k, v, path, source)
+				return nil
+			}
+
+			next, ok := tn[k]
+			if _, isList := next.([]interface{}); !ok || (!isList && !isConfigMap(next)) {
+				next = map[string]interface{}{}
+				tn[k] = next
+				c.clearSources(path)
+			}
+			node = next
+
+		case []interface{}:
+			ndx, err := strconv.Atoi(seg)
+			if err != nil || ndx < 0 || ndx >= len(tn) {
+				return fmt.Errorf("invalid index %s of list %s", seg, path)
+			}
+
+			path = joinConfigPath(path, seg)
+			if last {
+				tn[ndx] = v
+				c.clearSources(path)
+				c.sources[path] = source
+				return nil
+			}
+
+			if !isConfigMap(tn[ndx]) {
+				tn[ndx] = map[string]interface{}{}
+			}
+			node = tn[ndx]
+		}
+	}
+
+	return nil
+}
+
+// envOverrideNumberRegexp matches the decimal numbers without leading zeros: codes as 03069 or 0x1F are kept as strings.
+var envOverrideNumberRegexp = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?$`)
+
+// envOverrideValue is the value of an env override: true and false are booleans, the decimal numbers without leading zeros fitting an int64
+// or a float64 are numbers, anything else is a string.
+func envOverrideValue(value string) interface{} {
+	switch value {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+
+	if !envOverrideNumberRegexp.MatchString(value) {
+		return value
+	}
+
+	if !strings.Contains(value, ".") {
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return int(i)
+		}
+		return value
+	}
+
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return f
+	}
+	return value
+}
+
+func isConfigMap(v interface{}) bool {
+	_, ok := v.(map[string]interface{})
+	return ok
+}
+
+// matchConfigKey finds the key matching an env var segment. If none matches the key is the lowercase segment with dashes in place of underscores.
+func matchConfigKey(m map[string]interface{}, seg string) string {
+	norm := func(s string) string {
+		return strings.ToLower(strings.ReplaceAll(s, "-", "_"))
+	}
+
+	for k := range m {
+		if norm(k) == norm(seg) {
+			return k
+		}
+	}
+
+	return strings.ReplaceAll(strings.ToLower(seg), "_", "-")
+}
+
+func joinConfigPath(path, k string) string {
+	if path == "" {
+		return k
+	}
+	return path + "." + k
+}
@@ -0,0 +1,315 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DefaultConfigWatchInterval = 5 * time.Second
+	DefaultConfigWatchDebounce = 500 * time.Millisecond
+
+	// ConfigChangeApplied is the event of a new content that passed the validation and replaced the current one.
+	ConfigChangeApplied = "applied"
+	// ConfigChangeRejected is the event of a content that could not be read or failed the validation: the current one is kept.
+	ConfigChangeRejected = "rejected"
+)
+
+var ErrConfigValidation = errors.New("config validation failed")
+
+// ConfigChangeEvent is delivered to the subscribers of a ConfigWatcher. Content is the resolved content of the file, Previous the one it replaces.
+// On a rejected change Err tells why and Previous is the content still in use.
+type ConfigChangeEvent struct {
+	Type     string
+	Path     string
+	Content  []byte
+	Previous []byte
+	Err      error
+}
+
+// Unmarshal decodes the content of the event into a struct with yaml tags.
+func (e ConfigChangeEvent) Unmarshal(v interface{}) error {
+	return yaml.Unmarshal(e.Content, v)
+}
+
+// ConfigValidator checks a content before it replaces the current one, typically by unmarshalling it and validating the result.
+type ConfigValidator func(content []byte) error
+
+type ConfigChangeHandler func(ev ConfigChangeEvent)
+
+// ConfigWatcher polls a config file, such as the one found by ReadConfig, and delivers its changes to the subscribers. The changes are debounced:
+// the file is read again only once it stayed unchanged for the debounce period, so an editor writing it in steps triggers a single reload.
+type ConfigWatcher struct {
+	path       string
+	interval   time.Duration
+	debounce   time.Duration
+	validator  ConfigValidator
+	resolveEnv bool
+	secrets    bool
+
+	mu          sync.Mutex
+	current     []byte
+	stat        configFileStat
+	subscribers map[int]ConfigChangeHandler
+	nextId      int
+	started     bool
+
+	quit chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+type configFileStat struct {
+	modTime time.Time
+	size    int64
+	exists  bool
+}
+
+type ConfigWatcherOption func(w *ConfigWatcher) error
+
+func WithConfigWatchInterval(d time.Duration) ConfigWatcherOption {
+	return func(w *ConfigWatcher) error {
+		if d <= 0 {
+			return fmt.Errorf("invalid watch interval %s", d)
+		}
+		w.interval = d
+		return nil
+	}
+}
+
+// WithConfigWatchDebounce sets the time the file has to stay unchanged before being read. A zero debounce reads it at the first poll that sees the change.
+func WithConfigWatchDebounce(d time.Duration) ConfigWatcherOption {
+	return func(w *ConfigWatcher) error {
+		if d < 0 {
+			return fmt.Errorf("invalid watch debounce %s", d)
+		}
+		w.debounce = d
+		return nil
+	}
+}
+
+func WithConfigValidator(v ConfigValidator) ConfigWatcherOption {
+	return func(w *ConfigWatcher) error {
+		w.validator = v
+		return nil
+	}
+}
+
+// WithConfigWatchEnvResolution resolves the env var references of the content as ReadFileAndResolveEnvVars does. It is on by default.
+func WithConfigWatchEnvResolution(b bool) ConfigWatcherOption {
+	return func(w *ConfigWatcher) error {
+		w.resolveEnv = b
+		return nil
+	}
+}
+
+// WithConfigWatchSecretProviders resolves the secret provider references of the content too, as ReadFileAndResolveEnvVarsAndSecrets does.
+func WithConfigWatchSecretProviders(b bool) ConfigWatcherOption {
+	return func(w *ConfigWatcher) error {
+		w.secrets = b
+		return nil
+	}
+}
+
+// NewConfigWatcher reads and validates the file: a file that cannot be read or fails the validation is an error. Start begins the polling.
+func NewConfigWatcher(fn string, opts ...ConfigWatcherOption) (*ConfigWatcher, error) {
+	const semLogContext = "util::new-config-watcher"
+
+	w := &ConfigWatcher{
+		path:        fn,
+		interval:    DefaultConfigWatchInterval,
+		debounce:    DefaultConfigWatchDebounce,
+		resolveEnv:  true,
+		subscribers: make(map[int]ConfigChangeHandler),
+		quit:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+
+	for _, o := range opts {
+		if err := o(w); err != nil {
+			log.Error().Err(err).Msg(semLogContext)
+			return nil, err
+		}
+	}
+
+	w.stat = statConfigFile(fn)
+	content, err := w.load()
+	if err != nil {
+		log.Error().Err(err).Str("path", fn).Msg(semLogContext)
+		return nil, err
+	}
+
+	w.current = content
+	return w, nil
+}
+
+// Current is the last content that passed the validation.
+func (w *ConfigWatcher) Current() []byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+func (w *ConfigWatcher) Path() string {
+	return w.path
+}
+
+// Subscribe registers a handler of the change events. The handlers are called in turn from the watcher goroutine and should not block.
+// The returned function removes the subscription.
+func (w *ConfigWatcher) Subscribe(h ConfigChangeHandler) func() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	id := w.nextId
+	w.nextId++
+	w.subscribers[id] = h
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.subscribers, id)
+	}
+}
+
+// Start polls the file in a goroutine until Close is called.
+func (w *ConfigWatcher) Start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.started {
+		return
+	}
+	w.started = true
+	go w.run()
+}
+
+// Close stops the polling and waits for the goroutine to exit. It can be called more than once.
+func (w *ConfigWatcher) Close() {
+	w.once.Do(func() {
+		close(w.quit)
+	})
+
+	w.mu.Lock()
+	started := w.started
+	w.started = true
+	w.mu.Unlock()
+	if started {
+		<-w.done
+	}
+}
+
+// Reload reads the file now, delivers the event to the subscribers and returns it. An unchanged content is not an event and the returned one has an empty type.
+func (w *ConfigWatcher) Reload() ConfigChangeEvent {
+	const semLogContext = "util::config-watcher-reload"
+
+	w.mu.Lock()
+	w.stat = statConfigFile(w.path)
+	previous := w.current
+	w.mu.Unlock()
+
+	ev := ConfigChangeEvent{Path: w.path, Previous: previous}
+	content, err := w.load()
+	switch {
+	case err != nil:
+		ev.Type = ConfigChangeRejected
+		ev.Err = err
+		log.Error().Err(err).Str("path", w.path).Msg(semLogContext)
+	case bytes.Equal(content, previous):
+		return ConfigChangeEvent{}
+	default:
+		ev.Type = ConfigChangeApplied
+		ev.Content = content
+		w.mu.Lock()
+		w.current = content
+		w.mu.Unlock()
+		log.Info().Str("path", w.path).Msg(semLogContext + " - config applied")
+	}
+
+	w.notify(ev)
+	return ev
+}
+
+func (w *ConfigWatcher) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	var pending bool
+	var changedAt time.Time
+	for {
+		select {
+		case <-w.quit:
+			return
+		case now := <-ticker.C:
+			st := statConfigFile(w.path)
+			w.mu.Lock()
+			changed := st != w.stat
+			w.stat = st
+			w.mu.Unlock()
+
+			if changed {
+				pending = true
+				changedAt = now
+			}
+
+			if pending && now.Sub(changedAt) >= w.debounce {
+				pending = false
+				w.Reload()
+			}
+		}
+	}
+}
+
+func (w *ConfigWatcher) notify(ev ConfigChangeEvent) {
+	w.mu.Lock()
+	handlers := make([]ConfigChangeHandler, 0, len(w.subscribers))
+	for id := 0; id < w.nextId; id++ {
+		if h, ok := w.subscribers[id]; ok {
+			handlers = append(handlers, h)
+		}
+	}
+	w.mu.Unlock()
+
+	for _, h := range handlers {
+		h(ev)
+	}
+}
+
+func (w *ConfigWatcher) load() ([]byte, error) {
+	var content []byte
+	var err error
+	switch {
+	case w.secrets:
+		content, err = ReadFileAndResolveEnvVarsAndSecrets(w.path)
+	case w.resolveEnv:
+		content, err = ReadFileAndResolveEnvVars(w.path)
+	default:
+		content, err = os.ReadFile(w.path)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if w.validator != nil {
+		if err = w.validator(content); err != nil {
+			return nil, RedactError(fmt.Errorf("%w: %v", ErrConfigValidation, err))
+		}
+	}
+
+	return content, nil
+}
+
+func statConfigFile(fn string) configFileStat {
+	fi, err := os.Stat(fn)
+	if err != nil {
+		return configFileStat{}
+	}
+	return configFileStat{modTime: fi.ModTime(), size: fi.Size(), exists: true}
+}
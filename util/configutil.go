@@ -40,7 +40,51 @@ func ResolveConfigValueToString(v string) string {
 	return v
 }
 
+// ResolveConfigValueWithSecretsToByteArray is ResolveConfigValueWithSecretsToString on bytes.
+func ResolveConfigValueWithSecretsToByteArray(v []byte) []byte {
+	return []byte(ResolveConfigValueWithSecretsToString(string(v)))
+}
+
+// ResolveConfigValueWithSecretsToString replaces the ${VAR} references with the values of the env vars and then the references of the
+// secret providers, such as ${file:/run/secrets/db}, ${envfile:.env#KEY} and ${b64:...}, with the secrets. Only the references of the text are
+// resolved: the ones found in the values of the env vars are left as they are. Unresolved references are left as they are.
+func ResolveConfigValueWithSecretsToString(v string) string {
+	resolved, envSpans := resolveConfigEnvVars(v)
+	return resolveConfigSecrets(resolved, envSpans)
+}
+
+// resolveConfigEnvVars replaces the ${VAR} references with the values of the env vars and tells where the values are in the resolved text.
+func resolveConfigEnvVars(v string) (string, [][2]int) {
+	var sb strings.Builder
+	var spans [][2]int
+
+	last := 0
+	for _, m := range ConfigValueRegexp.FindAllStringSubmatchIndex(v, -1) {
+		env, ok := os.LookupEnv(v[m[4]:m[5]])
+		if !ok {
+			continue
+		}
+
+		sb.WriteString(v[last:m[0]])
+		spans = append(spans, [2]int{sb.Len(), sb.Len() + len(env)})
+		sb.WriteString(env)
+		last = m[1]
+	}
+	sb.WriteString(v[last:])
+
+	return sb.String(), spans
+}
+
 func ReadFileAndResolveEnvVars(cfgFile string) ([]byte, error) {
+	return readFileAndResolve(cfgFile, ResolveConfigValueToString)
+}
+
+// ReadFileAndResolveEnvVarsAndSecrets is ReadFileAndResolveEnvVars resolving the references of the secret providers too, as ResolveConfigValueWithSecretsToString does.
+func ReadFileAndResolveEnvVarsAndSecrets(cfgFile string) ([]byte, error) {
+	return readFileAndResolve(cfgFile, ResolveConfigValueWithSecretsToString)
+}
+
+func readFileAndResolve(cfgFile string, resolve func(string) string) ([]byte, error) {
 
 	fsz := fileutil.FileSize(cfgFile)
 	if fsz < 0 {
@@ -58,7 +102,7 @@ func ReadFileAndResolveEnvVars(cfgFile string) ([]byte, error) {
 
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		sb.WriteString(ResolveConfigValueToString(scanner.Text()))
+		sb.WriteString(resolve(scanner.Text()))
 		sb.WriteString("\n")
 	}
 
@@ -1,13 +1,21 @@
 package util_test
 
 import (
+	"bytes"
+	"fmt"
 	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/require"
+	"path/filepath"
 
 	"io/fs"
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 func TestResolveConfigValue(t *testing.T) {
@@ -72,3 +80,262 @@ func TestRegexp(t *testing.T) {
 		}
 	}
 }
+
+func TestResolveConfigSecrets(t *testing.T) {
+
+	dir := t.TempDir()
+	secretFn := filepath.Join(dir, "db")
+	require.NoError(t, os.WriteFile(secretFn, []byte("s3cr3t-pwd\n"), fs.ModePerm))
+
+	envFn := filepath.Join(dir, ".env")
+	require.NoError(t, os.WriteFile(envFn, []byte("# comment\nexport API_KEY=\"k-123456\"\nOTHER=1\n"), fs.ModePerm))
+
+	util.RegisterSecretProvider("vault", util.MapSecretProvider{"secret/db#user": "db-admin"})
+	defer util.RegisterSecretProvider("vault", nil)
+
+	t.Setenv("SECRETS_DIR", dir)
+	t.Setenv("INJECTED_REF", "${file:"+secretFn+"}")
+
+	cfg := fmt.Sprintf(`
+db:
+  user: ${vault:secret/db#user}
+  password: ${file:${SECRETS_DIR}/db}
+  api-key: ${envfile:%s#API_KEY}
+  token: ${b64:dG9rZW4tdmFsdWU=}
+  missing: ${envfile:%s#NOT_THERE}
+  unknown: ${nope:whatever}
+  injected: ${INJECTED_REF}
+`, envFn, envFn)
+
+	// the secret providers are opt-in.
+	s := util.ResolveConfigValueToString(cfg)
+	require.Contains(t, s, "token: ${b64:dG9rZW4tdmFsdWU=}")
+
+	s = util.ResolveConfigValueWithSecretsToString(cfg)
+	require.Contains(t, s, "user: db-admin")
+	require.Contains(t, s, "password: s3cr3t-pwd\n")
+	require.Contains(t, s, "api-key: k-123456")
+	require.Contains(t, s, "token: token-value")
+	require.Contains(t, s, "missing: ${envfile:")
+	require.Contains(t, s, "unknown: ${nope:whatever}")
+	require.Contains(t, s, "injected: ${file:"+secretFn+"}")
+
+	require.Equal(t, "pwd is ***, key is ***", util.RedactSecrets("pwd is s3cr3t-pwd, key is k-123456"))
+
+	// the short values are redacted only as a whole.
+	util.RegisterSecretValue("123")
+	require.Equal(t, "OTHER=123", util.RedactSecrets("OTHER=123"))
+	require.Equal(t, util.RedactedValue, util.RedactSecrets("123"))
+
+	err := util.RedactError(fmt.Errorf("invalid value s3cr3t-pwd: %w", os.ErrInvalid))
+	require.Equal(t, "invalid value ***: invalid argument", err.Error())
+	require.ErrorIs(t, err, os.ErrInvalid)
+
+	var buf bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&buf)
+	defer func() { log.Logger = logger }()
+
+	t.Setenv("TPM_SECRET_TEST", "s3cr3t-pwd")
+	t.Setenv("TPM_SECRET_TEST_PIN", "123")
+	util.LogEnvVars(zerolog.InfoLevel, "^TPM_SECRET_TEST")
+	require.Contains(t, buf.String(), "TPM_SECRET_TEST")
+	require.NotContains(t, buf.String(), "s3cr3t-pwd")
+	require.NotContains(t, buf.String(), "123")
+}
+
+var layeredDefaults = []byte(`
+db:
+  host: localhost
+  port: 5432
+  max-conns: 10
+  options:
+    ssl: false
+servers:
+  - a
+log:
+  level: info
+`)
+
+func TestLoadLayeredConfig(t *testing.T) {
+
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "config.yml")
+	require.NoError(t, os.WriteFile(fn, []byte(`
+db:
+  host: db.local
+  options:
+    timeout: 5s
+servers:
+  - b
+  - c
+`), fs.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config-prod.yml"), []byte(`
+db:
+  host: db.prod
+  options: 
+    ssl: true
+log: ~
+`), fs.ModePerm))
+
+	t.Setenv("TPMAPP__DB__PORT", "6432")
+	t.Setenv("TPMAPP__DB__MAX_CONNS", "50")
+	t.Setenv("TPMAPP__SERVERS__1", "z")
+	t.Setenv("TPMAPP__BANK__ABI", "03069")
+	t.Setenv("TPMAPP__BANK__CAB", "0123")
+	t.Setenv("TPMAPP__BANK__MASK", "0x1F")
+	t.Setenv("TPMAPP__BANK__ACCOUNT", "12345678901234567890")
+	t.Setenv("TPMAPP__BANK__RATE", "1.5")
+	t.Setenv("TPMAPP__BANK__ENABLED", "true")
+	t.Setenv("TPMAPP__BANK__ZERO", "0")
+
+	cfg, err := util.LoadLayeredConfig(
+		util.WithConfigDefaults(layeredDefaults),
+		util.WithConfigFile(fn),
+		util.WithConfigProfile("prod"),
+		util.WithConfigEnvPrefix("TPMAPP"))
+	require.NoError(t, err)
+
+	for _, p := range cfg.SourcePaths() {
+		s, _ := cfg.Source(p)
+		t.Logf("%s <-- %s", p, s)
+	}
+
+	var c struct {
+		DB struct {
+			Host     string `yaml:"host"`
+			Port     int    `yaml:"port"`
+			MaxConns int    `yaml:"max-conns"`
+			Options  struct {
+				Ssl     bool   `yaml:"ssl"`
+				Timeout string `yaml:"timeout"`
+			} `yaml:"options"`
+		} `yaml:"db"`
+		Servers []string               `yaml:"servers"`
+		Log     map[string]interface{} `yaml:"log"`
+	}
+	require.NoError(t, cfg.Unmarshal(&c))
+	require.Equal(t, "db.prod", c.DB.Host)
+	require.Equal(t, 6432, c.DB.Port)
+	require.Equal(t, 50, c.DB.MaxConns)
+	require.True(t, c.DB.Options.Ssl)
+	require.Equal(t, "5s", c.DB.Options.Timeout)
+	require.Equal(t, []string{"b", "z"}, c.Servers)
+	require.Nil(t, c.Log)
+
+	require.Equal(t, map[string]interface{}{
+		"abi":     "03069",
+		"cab":     "0123",
+		"mask":    "0x1F",
+		"account": "12345678901234567890",
+		"rate":    1.5,
+		"enabled": true,
+		"zero":    0,
+	}, cfg.Data()["bank"])
+
+	wanted := map[string]string{
+		"db.host":            util.ConfigLayerProfile,
+		"db.port":            util.ConfigLayerEnv,
+		"db.max-conns":       util.ConfigLayerEnv,
+		"db.options.ssl":     util.ConfigLayerProfile,
+		"db.options.timeout": util.ConfigLayerBase,
+		"servers":            util.ConfigLayerBase,
+		"servers.1":          util.ConfigLayerEnv,
+		"bank.abi":           util.ConfigLayerEnv,
+		"bank.cab":           util.ConfigLayerEnv,
+		"bank.mask":          util.ConfigLayerEnv,
+		"bank.account":       util.ConfigLayerEnv,
+		"bank.rate":          util.ConfigLayerEnv,
+		"bank.enabled":       util.ConfigLayerEnv,
+		"bank.zero":          util.ConfigLayerEnv,
+	}
+	require.Len(t, cfg.Sources(), len(wanted))
+	for p, layer := range wanted {
+		s, ok := cfg.Source(p)
+		require.True(t, ok, p)
+		require.Equal(t, layer, s.Layer, p)
+	}
+
+	cfg, err = util.LoadLayeredConfig(util.WithConfigDefaults(layeredDefaults), util.WithConfigFile(fn), util.WithConfigListMerge(util.ConfigListMergeAppend))
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"a", "b", "c"}, cfg.Data()["servers"])
+	for p, layer := range map[string]string{"servers": util.ConfigLayerBase, "servers.0": util.ConfigLayerDefaults, "servers.1": util.ConfigLayerBase, "servers.2": util.ConfigLayerBase} {
+		s, ok := cfg.Source(p)
+		require.True(t, ok, p)
+		require.Equal(t, layer, s.Layer, p)
+	}
+
+	cfg, err = util.LoadLayeredConfig(util.WithConfigFile(fn), util.WithConfigProfile("dev"))
+	require.NoError(t, err)
+	require.Equal(t, "db.local", cfg.Data()["db"].(map[string]interface{})["host"])
+
+	_, err = util.LoadLayeredConfig(util.WithConfigFile(filepath.Join(dir, "missing.yml")), util.WithConfigProfile("dev"))
+	require.Error(t, err)
+}
+
+func TestConfigWatcher(t *testing.T) {
+
+	type watchedConfig struct {
+		Port int `yaml:"port"`
+	}
+
+	validator := func(b []byte) error {
+		var cfg watchedConfig
+		if err := yaml.Unmarshal(b, &cfg); err != nil {
+			return err
+		}
+		if cfg.Port <= 0 {
+			return fmt.Errorf("invalid port %d", cfg.Port)
+		}
+		return nil
+	}
+
+	t.Setenv("WATCHED_PORT", "8080")
+	fn := filepath.Join(t.TempDir(), "config.yml")
+	require.NoError(t, os.WriteFile(fn, []byte("port: ${WATCHED_PORT}\n"), fs.ModePerm))
+
+	w, err := util.NewConfigWatcher(fn, util.WithConfigValidator(validator), util.WithConfigWatchInterval(10*time.Millisecond), util.WithConfigWatchDebounce(30*time.Millisecond))
+	require.NoError(t, err)
+	require.Equal(t, "port: 8080\n", string(w.Current()))
+
+	events := make(chan util.ConfigChangeEvent, 10)
+	unsubscribe := w.Subscribe(func(ev util.ConfigChangeEvent) {
+		events <- ev
+	})
+
+	w.Start()
+	defer w.Close()
+
+	nextEvent := func() util.ConfigChangeEvent {
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(2 * time.Second):
+			t.Fatal("no config change event")
+		}
+		return util.ConfigChangeEvent{}
+	}
+
+	require.NoError(t, os.WriteFile(fn, []byte("port: 9090\n"), fs.ModePerm))
+	ev := nextEvent()
+	require.Equal(t, util.ConfigChangeApplied, ev.Type)
+	require.Equal(t, "port: 8080\n", string(ev.Previous))
+
+	var cfg watchedConfig
+	require.NoError(t, ev.Unmarshal(&cfg))
+	require.Equal(t, 9090, cfg.Port)
+
+	// A content failing the validation is rejected and the last good one kept.
+	require.NoError(t, os.WriteFile(fn, []byte("port: -1\n"), fs.ModePerm))
+	ev = nextEvent()
+	require.Equal(t, util.ConfigChangeRejected, ev.Type)
+	require.ErrorIs(t, ev.Err, util.ErrConfigValidation)
+	require.Equal(t, "port: 9090\n", string(w.Current()))
+
+	unsubscribe()
+	w.Close()
+	require.NoError(t, os.WriteFile(fn, []byte("port: 7070\n"), fs.ModePerm))
+	require.Equal(t, util.ConfigChangeApplied, w.Reload().Type)
+	require.Equal(t, "port: 7070\n", string(w.Current()))
+	require.Len(t, events, 0)
+}
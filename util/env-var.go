@@ -32,7 +32,7 @@ func LogEnvVars(level zerolog.Level, withPattern string) {
 		vn := v[:ndx]
 		vv := v[ndx:]
 		if patternRegexp != nil && patternRegexp.MatchString(vn) || patternRegexp == nil {
-			log.WithLevel(level).Str("var-name", vn).Str("var-value", vv).Msg(semLogContext)
+			log.WithLevel(level).Str("var-name", vn).Str("var-value", "="+RedactSecrets(vv[1:])).Msg(semLogContext)
 		}
 	}
 
@@ -0,0 +1,255 @@
+package expression
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/scanner"
+
+	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/expression/funcs"
+	varResolver "github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/vars"
+	"github.com/PaesslerAG/jsonpath"
+)
+
+// gvalFunctions are the functions provided by the gval full language.
+var gvalFunctions = []string{"date"}
+
+type AnalysisError struct {
+	Line    int    `yaml:"line,omitempty" mapstructure:"line,omitempty" json:"line,omitempty"`
+	Column  int    `yaml:"column,omitempty" mapstructure:"column,omitempty" json:"column,omitempty"`
+	Message string `yaml:"message,omitempty" mapstructure:"message,omitempty" json:"message,omitempty"`
+}
+
+func (e AnalysisError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%d:%d %s", e.Line, e.Column, e.Message)
+	}
+	return e.Message
+}
+
+// Analysis is the outcome of the static analysis of an expression.
+// Variables maps each prefix to the names referenced with it; references without prefix are reported under the env: prefix they resolve to.
+type Analysis struct {
+	Expression       string                                  `yaml:"expression,omitempty" mapstructure:"expression,omitempty" json:"expression,omitempty"`
+	IsExpression     bool                                    `yaml:"is-expression,omitempty" mapstructure:"is-expression,omitempty" json:"is-expression,omitempty"`
+	Deferred         bool                                    `yaml:"deferred,omitempty" mapstructure:"deferred,omitempty" json:"deferred,omitempty"`
+	Variables        map[varResolver.VariablePrefix][]string `yaml:"variables,omitempty" mapstructure:"variables,omitempty" json:"variables,omitempty"`
+	Functions        []string                                `yaml:"functions,omitempty" mapstructure:"functions,omitempty" json:"functions,omitempty"`
+	UnknownFunctions []string                                `yaml:"unknown-functions,omitempty" mapstructure:"unknown-functions,omitempty" json:"unknown-functions,omitempty"`
+	Errors           []AnalysisError                         `yaml:"errors,omitempty" mapstructure:"errors,omitempty" json:"errors,omitempty"`
+}
+
+func (a Analysis) HasErrors() bool {
+	return len(a.Errors) > 0 || len(a.UnknownFunctions) > 0
+}
+
+// gvalPositionRegexp extracts the position of the token that caused a gval parsing error.
+var gvalPositionRegexp = regexp.MustCompile(`(?s)\t:(\d+):(\d+) - \d+:\d+ (.*)$`)
+
+// Analyze inspects an expression without evaluating it: it reports the variable references grouped by prefix, the called functions
+// and the ones not found in the DefaultFunctionRegistry, and the syntax errors with their line and column. Text templates, the strings that
+// EvalOne doesn't consider expressions, are not checked for syntax errors.
+func Analyze(expr string) Analysis {
+
+	a := Analysis{Expression: expr}
+	if strings.TrimSpace(expr) == "" {
+		return a
+	}
+
+	refs, err := varResolver.FindVariableReferences(expr, varResolver.AnyVariableReference)
+	if err != nil {
+		a.Errors = append(a.Errors, AnalysisError{Message: err.Error()})
+		return a
+	}
+
+	// The masked text has the same length of the expression: references are replaced by identifiers of the same length
+	// in order to get the positions of the gval errors right.
+	masked := []byte(expr)
+	cursor := 0
+	for _, r := range refs {
+		ndx := strings.Index(expr[cursor:], r.Match)
+		if ndx < 0 {
+			continue
+		}
+		ndx += cursor
+
+		for i := ndx; i < ndx+len(r.Match); i++ {
+			masked[i] = '_'
+		}
+
+		a.addReference(expr, ndx, r)
+		cursor = ndx + len(r.Match)
+	}
+
+	if a.Deferred {
+		return a
+	}
+
+	lead := len(masked) - len(strings.TrimLeft(string(masked), " \t\r\n"))
+	sk := strings.TrimSpace(string(masked))
+	body, isExpr := funcs.IsExpression(sk)
+	a.IsExpression = isExpr
+	for i := lead; i < lead+len(sk)-len(body); i++ {
+		masked[i] = ' '
+	}
+
+	if !isExpr {
+		return a
+	}
+
+	a.findFunctions(string(masked))
+
+	_, err = compiledLanguage.NewEvaluable(string(masked))
+	if err != nil {
+		a.Errors = append(a.Errors, gvalParseError(err))
+	}
+
+	return a
+}
+
+// addReference adds the variables of the alternatives of a reference, but the ones whose name is made by nested references,
+// and then the variables of the nested references. ndx is the position of the reference in the expression.
+func (a *Analysis) addReference(expr string, ndx int, r varResolver.VariableReference) {
+	alts := r.Alternatives()
+	for _, alt := range alts {
+		if _, ok := varResolver.FallbackLiteral(alt); ok && len(alts) > 1 {
+			continue
+		}
+
+		nested := false
+		for _, nr := range r.Nested {
+			nested = nested || strings.Contains(alt, nr.Match)
+		}
+		if nested {
+			continue
+		}
+
+		variable, _ := varResolver.ParseVariable(strings.TrimPrefix(alt, "!"))
+		if variable.Deferred {
+			a.Deferred = true
+		}
+
+		pfix := variable.Prefix
+		name := variable.Name
+		switch pfix {
+		case varResolver.VariablePrefixNotSpecified:
+			pfix = varResolver.VariablePrefixEnv
+		case varResolver.VariablePrefixDollarDot, varResolver.VariablePrefixDollarSquareBracket:
+			name = variable.JsonPathName()
+			if _, err := jsonpath.New(name); err != nil {
+				line, col := lineAndColumn(expr, ndx)
+				a.Errors = append(a.Errors, AnalysisError{Line: line, Column: col, Message: fmt.Sprintf("invalid json path %s: %s", name, err.Error())})
+			}
+		}
+
+		a.addVariable(pfix, name)
+	}
+
+	cursor := ndx
+	for _, nr := range r.Nested {
+		nndx := strings.Index(expr[cursor:], nr.Match)
+		if nndx < 0 {
+			continue
+		}
+		nndx += cursor
+		a.addReference(expr, nndx, nr)
+		cursor = nndx + len(nr.Match)
+	}
+}
+
+func (a *Analysis) addVariable(pfix varResolver.VariablePrefix, n string) {
+	if a.Variables == nil {
+		a.Variables = make(map[varResolver.VariablePrefix][]string)
+	}
+
+	for _, s := range a.Variables[pfix] {
+		if s == n {
+			return
+		}
+	}
+
+	a.Variables[pfix] = append(a.Variables[pfix], n)
+}
+
+// findFunctions scans the text for identifiers, dotted ones included, followed by an open parenthesis.
+func (a *Analysis) findFunctions(text string) {
+
+	var sc scanner.Scanner
+	sc.Init(strings.NewReader(text))
+	sc.Error = func(*scanner.Scanner, string) {}
+	sc.Mode = scanner.GoTokens
+
+	type token struct {
+		tok  rune
+		text string
+	}
+
+	var toks []token
+	for tok := sc.Scan(); tok != scanner.EOF; tok = sc.Scan() {
+		toks = append(toks, token{tok: tok, text: sc.TokenText()})
+	}
+
+	for i := 0; i < len(toks); i++ {
+		if toks[i].tok != scanner.Ident {
+			continue
+		}
+
+		n := toks[i].text
+		j := i + 1
+		for j+1 < len(toks) && toks[j].tok == '.' && toks[j+1].tok == scanner.Ident {
+			n += "." + toks[j+1].text
+			j += 2
+		}
+
+		if j < len(toks) && toks[j].tok == '(' {
+			a.addFunction(n)
+		}
+
+		i = j - 1
+	}
+
+	sort.Strings(a.UnknownFunctions)
+}
+
+func (a *Analysis) addFunction(n string) {
+	for _, s := range a.Functions {
+		if s == n {
+			return
+		}
+	}
+
+	a.Functions = append(a.Functions, n)
+	if _, ok := DefaultFunctionRegistry().Lookup(n); ok {
+		return
+	}
+
+	for _, f := range gvalFunctions {
+		if f == n {
+			return
+		}
+	}
+
+	a.UnknownFunctions = append(a.UnknownFunctions, n)
+}
+
+func gvalParseError(err error) AnalysisError {
+	m := gvalPositionRegexp.FindStringSubmatch(err.Error())
+	if len(m) == 0 {
+		return AnalysisError{Message: err.Error()}
+	}
+
+	line, _ := strconv.Atoi(m[1])
+	col, _ := strconv.Atoi(m[2])
+	return AnalysisError{Line: line, Column: col, Message: m[3]}
+}
+
+func lineAndColumn(s string, offset int) (int, int) {
+	line := 1 + strings.Count(s[:offset], "\n")
+	col := offset + 1
+	if ndx := strings.LastIndex(s[:offset], "\n"); ndx >= 0 {
+		col = offset - ndx
+	}
+	return line, col
+}
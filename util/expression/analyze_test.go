@@ -0,0 +1,51 @@
+package expression_test
+
+import (
+	"testing"
+
+	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/expression"
+	varResolver "github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/vars"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyze(t *testing.T) {
+
+	a := expression.Analyze(`"{$.beneficiario.natura}" == "PP" && left("{v:abi}", 2) == "{g:abi-prefix}" && isDef({ENV_VAR})`)
+	require.True(t, a.IsExpression)
+	require.False(t, a.HasErrors(), a.Errors)
+	require.Equal(t, []string{"$.beneficiario.natura"}, a.Variables[varResolver.VariablePrefixDollarDot])
+	require.Equal(t, []string{"abi"}, a.Variables[varResolver.VariablePrefixVColon])
+	require.Equal(t, []string{"abi-prefix"}, a.Variables[varResolver.VariablePrefixGColon])
+	require.Equal(t, []string{"ENV_VAR"}, a.Variables[varResolver.VariablePrefixEnv])
+	require.Equal(t, []string{"left", "isDef"}, a.Functions)
+
+	a = expression.Analyze(`:str.left("{v:abi}", 2) == my.left("{v:abi}", 2) && notAFunction({h:canale})`)
+	require.True(t, a.HasErrors())
+	require.Equal(t, []string{"str.left", "my.left", "notAFunction"}, a.Functions)
+	require.Equal(t, []string{"my.left", "notAFunction"}, a.UnknownFunctions)
+	require.Equal(t, []string{"canale"}, a.Variables[varResolver.VariablePrefixHColon])
+
+	a = expression.Analyze("\"{v:abi}\" == \"03069\" &&\n  left(\"{v:abi}\", 2) == )")
+	require.Len(t, a.Errors, 1)
+	require.Equal(t, 2, a.Errors[0].Line)
+	t.Log(a.Errors[0].Error())
+
+	a = expression.Analyze(`{$.missing,defer} - {v:abi}`)
+	require.True(t, a.Deferred)
+	require.False(t, a.HasErrors())
+
+	a = expression.Analyze(`plain text {v:abi}`)
+	require.False(t, a.IsExpression)
+	require.False(t, a.HasErrors())
+
+	a = expression.Analyze(`{v:abi%>`)
+	require.Len(t, a.Errors, 1)
+
+	a = expression.Analyze(`"{v:missing|v:abi|'n/a'}" == "{v:x-{g:env}}" && {$.a.b|ENV_VAR} > 0`)
+	require.True(t, a.IsExpression)
+	require.False(t, a.HasErrors(), a.Errors)
+	require.Equal(t, []string{"missing", "abi"}, a.Variables[varResolver.VariablePrefixVColon])
+	require.Equal(t, []string{"env"}, a.Variables[varResolver.VariablePrefixGColon])
+	require.Equal(t, []string{"$.a.b"}, a.Variables[varResolver.VariablePrefixDollarDot])
+	require.Equal(t, []string{"ENV_VAR"}, a.Variables[varResolver.VariablePrefixEnv])
+}
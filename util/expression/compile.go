@@ -0,0 +1,585 @@
+package expression
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/expression/funcs"
+	varResolver "github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/vars"
+	"github.com/PaesslerAG/gval"
+	"github.com/PaesslerAG/jsonpath"
+	"github.com/rs/zerolog/log"
+)
+
+// refPlaceholderPrefix is the prefix of the identifiers that replace the variable references in the compiled text of an expression.
+const refPlaceholderPrefix = "__expr_ref_"
+
+type compiledReference struct {
+	refType    varResolver.VariableReferenceType
+	variable   varResolver.Variable
+	jsonPath   gval.Evaluable
+	jsonEscape bool
+	inLiteral  bool
+
+	// name is set for the references with nested references or fallbacks, resolved at each evaluation: alternatives are the ones of the fallback chain
+	// when the name doesn't hold nested references.
+	name         string
+	nested       bool
+	alternatives []string
+}
+
+type compiledPart struct {
+	text   string
+	refNdx int
+}
+
+// CompiledExpression is an expression whose variable references and gval text have been parsed once by Compile.
+// It doesn't hold any per-evaluation state so the same instance can be evaluated concurrently against different Contexts.
+type CompiledExpression struct {
+	expr      string
+	text      string
+	isExpr    bool
+	deferred  bool
+	parts     []compiledPart
+	refs      []compiledReference
+	evaluable gval.Evaluable
+	parseErr  error
+	depth     int
+}
+
+// Compile parses the expression and its variable references. Differently from EvalOne the references are not pasted in the text
+// of the expression but replaced by gval parameters valued at each evaluation: references inside a string literal contribute their formatted value
+// to the string, references outside a literal are valued with the number or boolean their text represents.
+// The expression/no-expression decision is taken on the expression text only and gval languages registered through WithGValFunctions are not considered.
+func Compile(expr string) (*CompiledExpression, error) {
+
+	const semLogContext = "expression-ctx::compile"
+
+	ce := &CompiledExpression{expr: expr}
+	if expr == "" {
+		return ce, nil
+	}
+
+	ce.depth = nestingDepth(expr)
+
+	refs, err := varResolver.FindVariableReferences(expr, varResolver.AnyVariableReference)
+	if err != nil {
+		log.Error().Err(err).Str("expr", expr).Msg(semLogContext)
+		return nil, err
+	}
+
+	if len(refs) > 0 {
+		// ResolveVariables trims the resolved text.
+		expr = strings.TrimSpace(expr)
+	}
+
+	cursor := 0
+	var skeleton strings.Builder
+	for _, r := range refs {
+		ndx := strings.Index(expr[cursor:], r.Match)
+		if ndx < 0 {
+			err = fmt.Errorf("cannot locate variable reference %s in expression", r.Match)
+			log.Error().Err(err).Str("expr", expr).Msg(semLogContext)
+			return nil, err
+		}
+
+		if ndx > 0 {
+			ce.parts = append(ce.parts, compiledPart{text: expr[cursor : cursor+ndx], refNdx: -1})
+			skeleton.WriteString(expr[cursor : cursor+ndx])
+		}
+
+		cr := compiledReference{refType: r.RefType}
+		n := r.VarName
+		if strings.HasPrefix(n, "!") {
+			cr.jsonEscape = true
+			n = strings.TrimPrefix(n, "!")
+		}
+
+		alts := r.Alternatives()
+		if len(r.Nested) > 0 || len(alts) > 1 {
+			cr.name, cr.nested = n, len(r.Nested) > 0
+			if !cr.nested {
+				cr.alternatives = alts
+			}
+			n = strings.TrimPrefix(alts[0], "!")
+		}
+
+		cr.variable, _ = varResolver.ParseVariable(n)
+		if cr.variable.Deferred {
+			ce.deferred = true
+		}
+
+		if pfix := cr.variable.Prefix; cr.name == "" && (pfix == varResolver.VariablePrefixDollarDot || pfix == varResolver.VariablePrefixDollarSquareBracket) {
+			cr.jsonPath, err = jsonpath.New(cr.variable.JsonPathName())
+			if err != nil {
+				log.Error().Err(err).Str("expr", expr).Str("path", cr.variable.JsonPathName()).Msg(semLogContext)
+				return nil, err
+			}
+		}
+
+		ce.parts = append(ce.parts, compiledPart{refNdx: len(ce.refs)})
+		skeleton.WriteString(refPlaceholder(len(ce.refs)))
+		ce.refs = append(ce.refs, cr)
+		cursor += ndx + len(r.Match)
+	}
+
+	if cursor < len(expr) {
+		ce.parts = append(ce.parts, compiledPart{text: expr[cursor:], refNdx: -1})
+		skeleton.WriteString(expr[cursor:])
+	}
+
+	if ce.deferred {
+		return ce, nil
+	}
+
+	// The prefixes recognized by IsExpression are literal text at the beginning of the expression so they can be trimmed from the first part.
+	sk := skeleton.String()
+	if len(refs) > 0 {
+		sk = strings.TrimSpace(sk)
+	}
+
+	var body string
+	body, ce.isExpr = funcs.IsExpression(sk)
+	if pfixLen := len(sk) - len(body); pfixLen > 0 {
+		ce.parts[0].text = ce.parts[0].text[pfixLen:]
+	}
+
+	ce.text = ce.rewrite()
+	ce.evaluable, ce.parseErr = compiledLanguage.NewEvaluable(ce.text)
+	if ce.parseErr != nil && ce.isExpr {
+		log.Error().Err(ce.parseErr).Str("expr", ce.expr).Str("text", ce.text).Msg(semLogContext)
+		return nil, ce.parseErr
+	}
+
+	return ce, nil
+}
+
+func refPlaceholder(ndx int) string {
+	return refPlaceholderPrefix + strconv.Itoa(ndx)
+}
+
+// rewrite produces the gval text of the expression. References found in a string literal split the literal in a concatenation of strings.
+func (ce *CompiledExpression) rewrite() string {
+
+	var sb strings.Builder
+
+	var quote byte
+	var escaped bool
+	var literal []compiledPart
+	var current strings.Builder
+
+	for _, p := range ce.parts {
+		if p.refNdx >= 0 {
+			if quote != 0 {
+				ce.refs[p.refNdx].inLiteral = true
+				literal = append(literal, compiledPart{text: current.String(), refNdx: -1}, p)
+				current.Reset()
+			} else {
+				sb.WriteString(" ")
+				sb.WriteString(refPlaceholder(p.refNdx))
+				sb.WriteString(" ")
+			}
+			continue
+		}
+
+		for i := 0; i < len(p.text); i++ {
+			c := p.text[i]
+			if quote == 0 {
+				switch c {
+				case '"', '\'', '`':
+					quote = c
+					literal = nil
+					current.Reset()
+				default:
+					sb.WriteByte(c)
+				}
+				continue
+			}
+
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\' && quote != '`':
+				escaped = true
+			case c == quote:
+				literal = append(literal, compiledPart{text: current.String(), refNdx: -1})
+				sb.WriteString(concatLiteral(quote, literal))
+				quote = 0
+				continue
+			}
+			current.WriteByte(c)
+		}
+	}
+
+	// Unterminated literals are written back as they are and left to the gval parser.
+	if quote != 0 {
+		sb.WriteByte(quote)
+		for _, p := range literal {
+			if p.refNdx >= 0 {
+				sb.WriteString(refPlaceholder(p.refNdx))
+			} else {
+				sb.WriteString(p.text)
+			}
+		}
+		sb.WriteString(current.String())
+	}
+
+	return sb.String()
+}
+
+func concatLiteral(quote byte, literal []compiledPart) string {
+	var items []string
+	for _, p := range literal {
+		if p.refNdx >= 0 {
+			items = append(items, refPlaceholder(p.refNdx))
+		} else if p.text != "" {
+			items = append(items, string(quote)+p.text+string(quote))
+		}
+	}
+
+	switch len(items) {
+	case 0:
+		return string(quote) + string(quote)
+	case 1:
+		return items[0]
+	default:
+		return "(" + strings.Join(items, " + ") + ")"
+	}
+}
+
+// Text returns the text handed over to gval, with the variable references replaced by parameters.
+func (ce *CompiledExpression) Text() string {
+	return ce.text
+}
+
+// IsExpression reports if the expression gets evaluated by gval or simply resolved as a text template.
+func (ce *CompiledExpression) IsExpression() bool {
+	return ce.isExpr && !ce.deferred
+}
+
+// Eval is the compiled counterpart of Context.EvalOne.
+func (ce *CompiledExpression) Eval(pvr *Context) (interface{}, error) {
+	return ce.EvalCtx(context.Background(), pvr)
+}
+
+// EvalCtx is the compiled counterpart of Context.EvalOneCtx.
+func (ce *CompiledExpression) EvalCtx(ctx context.Context, pvr *Context) (interface{}, error) {
+	tr := pvr.startTrace(ce.expr)
+	res, err := ce.eval(ctx, pvr)
+	pvr.endTrace(tr, res, err)
+	return res, err
+}
+
+func (ce *CompiledExpression) eval(ctx context.Context, pvr *Context) (interface{}, error) {
+
+	if ce.expr == "" {
+		return "", nil
+	}
+
+	if err := pvr.checkExpression(ctx, ce.expr, ce.depth); err != nil {
+		return nil, err
+	}
+
+	if ce.deferred || !ce.isExpr {
+		s, err := ce.resolveText(pvr)
+		pvr.traceText(s, false)
+		if err == nil {
+			err = pvr.limits.checkOutput(s)
+		}
+		return s, err
+	}
+
+	pvr.traceText(ce.text, true)
+
+	h := pvr.newCallHook(ctx)
+	params, err := ce.params(pvr, h)
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := ce.evaluable(ctx, params)
+	if err = h.evalErr(ctx, err); err != nil {
+		return nil, err
+	}
+
+	if err = pvr.limits.checkOutput(res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// BoolEval is the compiled counterpart of Context.BoolEvalOne.
+func (ce *CompiledExpression) BoolEval(pvr *Context) (bool, error) {
+	return ce.BoolEvalCtx(context.Background(), pvr)
+}
+
+// BoolEvalCtx is the compiled counterpart of Context.BoolEvalOneCtx.
+func (ce *CompiledExpression) BoolEvalCtx(ctx context.Context, pvr *Context) (bool, error) {
+	tr := pvr.startTrace(ce.expr)
+	res, err := ce.boolEval(ctx, pvr)
+	pvr.endTrace(tr, res, err)
+	return res, err
+}
+
+func (ce *CompiledExpression) boolEval(ctx context.Context, pvr *Context) (bool, error) {
+
+	const semLogContext = "expression-ctx::compiled-bool-eval"
+
+	// The empty expression evaluates to true.
+	if ce.expr == "" {
+		return true, nil
+	}
+
+	if err := pvr.checkExpression(ctx, ce.expr, ce.depth); err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+		return false, err
+	}
+
+	if ce.deferred {
+		s, err := ce.resolveText(pvr)
+		if err == nil {
+			err = fmt.Errorf("expression deferred: %s", s)
+		}
+		log.Error().Err(err).Str("expr", ce.expr).Msg(semLogContext)
+		return false, err
+	}
+
+	if ce.parseErr != nil {
+		log.Error().Err(ce.parseErr).Str("expr", ce.expr).Msg(semLogContext)
+		return false, ce.parseErr
+	}
+
+	pvr.traceText(ce.text, true)
+	h := pvr.newCallHook(ctx)
+	params, err := ce.params(pvr, h)
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		log.Error().Err(err).Str("expr", ce.expr).Msg(semLogContext)
+		return false, err
+	}
+
+	exprValue, err := ce.evaluable(ctx, params)
+	if err = h.evalErr(ctx, err); err != nil {
+		log.Error().Err(err).Str("expr", ce.expr).Msg(semLogContext)
+		return false, err
+	}
+
+	boolVal, ok := exprValue.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression %s is not a boolean expression", ce.expr)
+	}
+
+	return boolVal, nil
+}
+
+// resolveText resolves the expression as a text template in the same way of varResolver.ResolveVariables.
+func (ce *CompiledExpression) resolveText(pvr *Context) (string, error) {
+
+	if len(ce.refs) == 0 {
+		if len(ce.parts) == 0 {
+			return "", nil
+		}
+		return ce.parts[0].text, nil
+	}
+
+	var sb strings.Builder
+	for _, p := range ce.parts {
+		if p.refNdx < 0 {
+			sb.WriteString(p.text)
+			continue
+		}
+
+		r := ce.refs[p.refNdx]
+		if r.variable.Deferred {
+			raw := r.variable.Raw()
+			if r.name != "" {
+				raw = r.name
+			}
+			pvr.traceVariable(raw, nil, "", true, nil)
+			sb.WriteString(r.refType.ToVar(raw))
+			continue
+		}
+
+		s, err := ce.refString(pvr, r, r.jsonEscape)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(s)
+	}
+
+	return strings.TrimSpace(sb.String()), nil
+}
+
+// refString formats the value of a reference. As in the text resolution, lookup errors resolve to the empty string but the strict env ones.
+func (ce *CompiledExpression) refString(pvr *Context, r compiledReference, jsonEscape bool) (string, error) {
+
+	const semLogContext = "expression-ctx::compiled-ref-string"
+
+	if r.name != "" {
+		variable, v, literal, err := ce.dynamicValue(pvr, r)
+		if err != nil {
+			return "", err
+		}
+
+		if literal {
+			pvr.traceVariable(r.name, v, v.(string), false, nil)
+			return v.(string), nil
+		}
+		r.variable, r.jsonPath = variable, nil
+	}
+
+	v, err := pvr.varValue(r.variable, r.jsonPath)
+	if err != nil {
+		pvr.traceVariable(r.variable.Raw(), nil, "", false, err)
+		if errors.Is(err, ErrEnvVarNotResolved) {
+			return "", err
+		}
+		return "", nil
+	}
+
+	s, err := r.variable.ToString(v, jsonEscape, false)
+	if err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+	}
+
+	pvr.traceVariable(r.variable.Raw(), v, s, false, err)
+
+	return s, nil
+}
+
+// dynamicValue resolves the nested references of the name of a reference and looks up the alternatives of its fallback chain
+// up to the first one formatted as a non-empty text, as the text resolution does. The literal alternative resolves to its text.
+func (ce *CompiledExpression) dynamicValue(pvr *Context, r compiledReference) (varResolver.Variable, interface{}, bool, error) {
+
+	alts := r.alternatives
+	if r.nested {
+		name, _, err := pvr.resolveVariables(r.name)
+		if err != nil {
+			return varResolver.Variable{}, nil, false, err
+		}
+		alts = varResolver.SplitFallbacks(name)
+	}
+
+	var variable varResolver.Variable
+	var v interface{}
+	for i, alt := range alts {
+		if lit, ok := varResolver.FallbackLiteral(alt); ok && len(alts) > 1 {
+			return varResolver.Variable{}, lit, true, nil
+		}
+
+		var err error
+		variable, _ = varResolver.ParseVariable(strings.TrimPrefix(alt, "!"))
+		v, err = pvr.varValue(variable, nil)
+		if err != nil {
+			if errors.Is(err, ErrEnvVarNotResolved) {
+				return variable, nil, false, err
+			}
+			v = nil
+		}
+
+		if i == len(alts)-1 {
+			break
+		}
+
+		if s, _ := variable.ToString(v, false, false); s != "" {
+			break
+		}
+	}
+
+	return variable, v, false, nil
+}
+
+func (ce *CompiledExpression) params(pvr *Context, h *callHook) (*compiledParams, error) {
+	values := make([]interface{}, len(ce.refs))
+	for i, r := range ce.refs {
+
+		// In typed mode the value is handed over as is unless it has to be formatted or it is part of a string.
+		if pvr.typedReferences && !r.inLiteral && r.name != "" {
+			variable, v, literal, err := ce.dynamicValue(pvr, r)
+			if err != nil {
+				return nil, err
+			}
+
+			if literal || !variable.HasTags() {
+				pvr.traceVariable(r.name, v, "", false, nil)
+				values[i] = v
+				continue
+			}
+		}
+
+		if pvr.typedReferences && !r.inLiteral && r.name == "" && !r.variable.HasTags() {
+			v, err := pvr.varValue(r.variable, r.jsonPath)
+			pvr.traceVariable(r.variable.Raw(), v, "", false, err)
+			if errors.Is(err, ErrEnvVarNotResolved) {
+				return nil, err
+			}
+			values[i] = v
+			continue
+		}
+
+		// The value is not escaped: the json escape was needed only when the value was pasted into a literal of the text.
+		s, err := ce.refString(pvr, r, false)
+		if err != nil {
+			return nil, err
+		}
+
+		if r.inLiteral {
+			values[i] = s
+		} else {
+			values[i] = tokenValue(s)
+		}
+	}
+
+	return &compiledParams{vars: pvr.vars, refs: values, hook: h}, nil
+}
+
+// tokenValue types the text of a reference found outside a string literal as gval would have parsed it: numbers and booleans.
+func tokenValue(s string) interface{} {
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+
+	return s
+}
+
+// compiledParams is the gval parameter of a compiled evaluation. The placeholders are looked up in the reference values, the rest in the vars of the context.
+type compiledParams struct {
+	vars map[string]interface{}
+	refs []interface{}
+	hook *callHook
+}
+
+func (p *compiledParams) SelectGVal(c context.Context, k string) (interface{}, error) {
+	if strings.HasPrefix(k, refPlaceholderPrefix) {
+		ndx, err := strconv.Atoi(strings.TrimPrefix(k, refPlaceholderPrefix))
+		if err != nil || ndx < 0 || ndx >= len(p.refs) {
+			return nil, errors.New("invalid reference placeholder " + k)
+		}
+		return p.refs[ndx], nil
+	}
+
+	if p.hook != nil {
+		if err := c.Err(); err != nil {
+			return nil, err
+		}
+		return p.hook.wrap(c, k, p.vars[k]), nil
+	}
+
+	return p.vars[k], nil
+}
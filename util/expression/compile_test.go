@@ -0,0 +1,161 @@
+package expression_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/expression"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompiledExpression(t *testing.T) {
+	arr := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{
+			expr:     `{$.beneficiario.numero}`,
+			expected: "8188602",
+		},
+		{
+			expr:     `{$.beneficiario.numero,len=-10,pad=0}`,
+			expected: "0008188602",
+		},
+		{
+			expr:     `!e:{v:var01,len=10,pad=.}`,
+			expected: "OK........",
+		},
+		{
+			expr:     `!e:{$.missing.props,len=-10,pad=0,defer}`,
+			expected: "!e:{$.missing.props,len=-10,pad=0}",
+		},
+		{
+			expr:     `:firstOf("1,2")`,
+			expected: "1",
+		},
+		{
+			expr:     `"{$.beneficiario.natura}-{v:var01}" == "PP-OK"`,
+			expected: true,
+		},
+		{
+			expr:     `:"pre {v:quoted} post"`,
+			expected: `pre say "hello" post`,
+		},
+		{
+			expr:     `{$.operazione.importo} + 10 > 5`,
+			expected: true,
+		},
+		{
+			expr:     `:left("{$.ordinante.codiceFiscale}", 6)`,
+			expected: "LPRSPM",
+		},
+	}
+
+	exprCtx, err := expression.NewContext(expression.WithJsonInput(j), expression.WithVars(map[string]interface{}{"var01": "OK", "quoted": `say "hello"`}))
+	require.NoError(t, err)
+
+	for i, input := range arr {
+		ce, err := expression.Compile(input.expr)
+		require.NoError(t, err, "[%d] error", i)
+		t.Logf("[%d] %s compiled to %s", i, input.expr, ce.Text())
+
+		v, err := ce.Eval(exprCtx)
+		require.NoError(t, err, "[%d] error", i)
+		require.EqualValues(t, input.expected, v, "[%d] Expected doesn't match actual", i)
+	}
+}
+
+func TestCompiledExpressionBoolEval(t *testing.T) {
+	arr := []struct {
+		expr     string
+		expected bool
+	}{
+		{expr: `"{$.propNotPresent}" == "OK"`, expected: false},
+		{expr: `"{$.beneficiario.natura}" == "DT"`, expected: false},
+		{expr: `"{$.beneficiario.numero}" == "8188602"`, expected: true},
+		{expr: `"{v:var01}" == "OK" && "{$.beneficiario.numero}" == "8188602"`, expected: true},
+		{expr: `"{v:varNotPresent}" == "OK"`, expected: false},
+		{expr: `true`, expected: true},
+		{expr: ``, expected: true},
+	}
+
+	exprCtx, err := expression.NewContext(expression.WithJsonInput(j), expression.WithVars(map[string]interface{}{"var01": "OK"}))
+	require.NoError(t, err)
+
+	for i, input := range arr {
+		ce, err := expression.Compile(input.expr)
+		require.NoError(t, err, "[%d] error", i)
+
+		b, err := ce.BoolEval(exprCtx)
+		require.NoError(t, err, "[%d] error", i)
+		require.Equal(t, input.expected, b, "[%d] Expected doesn't match actual", i)
+
+		if input.expr != "" {
+			b, err = exprCtx.BoolEvalOne(input.expr)
+			require.NoError(t, err, "[%d] error", i)
+			require.Equal(t, input.expected, b, "[%d] compiled and not compiled evaluation differ", i)
+		}
+	}
+
+	_, err = expression.Compile(`:left("abc", `)
+	require.Error(t, err)
+}
+
+func TestCompiledExpressionConcurrency(t *testing.T) {
+	ce, err := expression.Compile(`"{$.id}" == "{v:expected}"`)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for k := 0; k < 100; k++ {
+				id := fmt.Sprintf("%d-%d", i, k)
+				exprCtx, err := expression.NewContext(
+					expression.WithJsonInput([]byte(fmt.Sprintf(`{"id": "%s"}`, id))),
+					expression.WithVars(map[string]interface{}{"expected": id}))
+				assert.NoError(t, err)
+
+				b, err := ce.BoolEval(exprCtx)
+				assert.NoError(t, err)
+				assert.True(t, b)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+const benchmarkExpr = `"{$.beneficiario.natura}" == "PP" && "{$.operazione.divisa}" == "{v:var01}" && lenJsonArray(operazioni) >= 0`
+
+func BenchmarkEvalOne(b *testing.B) {
+	exprCtx, err := expression.NewContext(expression.WithJsonInput(j), expression.WithVars(map[string]interface{}{"var01": "EUR", "operazioni": []interface{}{}}))
+	require.NoError(b, err)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err = exprCtx.BoolEvalOne(benchmarkExpr)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCompiledEval(b *testing.B) {
+	exprCtx, err := expression.NewContext(expression.WithJsonInput(j), expression.WithVars(map[string]interface{}{"var01": "EUR", "operazioni": []interface{}{}}))
+	require.NoError(b, err)
+
+	ce, err := expression.Compile(benchmarkExpr)
+	require.NoError(b, err)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err = ce.BoolEval(exprCtx)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package expression
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,17 +11,27 @@ import (
 	"github.com/PaesslerAG/gval"
 	"github.com/PaesslerAG/jsonpath"
 	"github.com/rs/zerolog/log"
-	"os"
+	"net/url"
+	"sort"
 	"strings"
 )
 
 type Option func(r *Context) error
 
 type Context struct {
-	vars    map[string]interface{}
-	input   map[string]interface{}
-	headers NameValuePairs
-	gvals   []gval.Language
+	vars            map[string]interface{}
+	input           map[string]interface{}
+	headers         NameValuePairs
+	pathParams      NameValuePairs
+	queryParams     NameValuePairs
+	gvals           []gval.Language
+	globals         *GlobalVars
+	typedReferences bool
+	env             envPolicy
+	explain         bool
+	trace           *Trace
+	traces          []*Trace
+	limits          Limits
 }
 
 type NameValuePair struct {
@@ -42,6 +53,54 @@ func (nvs NameValuePairs) GetFirst(n string) NameValuePair {
 	return NameValuePair{}
 }
 
+// GetAll returns the values of all the pairs with the given name. As in GetFirst the name is matched case-insensitive.
+func (nvs NameValuePairs) GetAll(n string) []string {
+
+	var values []string
+	n = strings.ToLower(n)
+	for _, nv := range nvs {
+		if strings.ToLower(nv.Name) == n {
+			values = append(values, nv.Value)
+		}
+	}
+	return values
+}
+
+// toNameValuePairs converts the supported param containers: NameValuePairs, url.Values and map[string]string.
+func toNameValuePairs(params interface{}) (NameValuePairs, error) {
+
+	var nvs NameValuePairs
+	switch tp := params.(type) {
+	case nil:
+	case NameValuePairs:
+		nvs = tp
+	case []NameValuePair:
+		nvs = tp
+	case url.Values:
+		nvs = make(NameValuePairs, 0, len(tp))
+		keys := make([]string, 0, len(tp))
+		for k := range tp {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			for _, v := range tp[k] {
+				nvs = append(nvs, NameValuePair{Name: k, Value: v})
+			}
+		}
+	case map[string]string:
+		nvs = make(NameValuePairs, 0, len(tp))
+		for k, v := range tp {
+			nvs = append(nvs, NameValuePair{Name: k, Value: v})
+		}
+	default:
+		return nil, fmt.Errorf("unsupported params type %T", params)
+	}
+
+	return nvs, nil
+}
+
 func WithHeaders(h []NameValuePair) Option {
 	return func(r *Context) error {
 		r.headers = h
@@ -49,6 +108,25 @@ func WithHeaders(h []NameValuePair) Option {
 	}
 }
 
+// WithPathParams sets the values of the p: references. The params can be provided as NameValuePairs, url.Values or map[string]string.
+func WithPathParams(params interface{}) Option {
+	return func(r *Context) error {
+		var err error
+		r.pathParams, err = toNameValuePairs(params)
+		return err
+	}
+}
+
+// WithQueryParams sets the values of the q: references. The params can be provided as NameValuePairs, url.Values or map[string]string.
+// A reference like {q:page} resolves to the first value of the parameter, a reference like {q:page[]} resolves to the array of all its values.
+func WithQueryParams(params interface{}) Option {
+	return func(r *Context) error {
+		var err error
+		r.queryParams, err = toNameValuePairs(params)
+		return err
+	}
+}
+
 func WithVars(m map[string]interface{}) Option {
 	return func(r *Context) error {
 
@@ -79,6 +157,55 @@ func WithFuncMap(fm map[string]interface{}) Option {
 	}
 }
 
+// WithFunctionRegistry adds the functions of the registry to the ones of the DefaultFunctionRegistry every context starts with.
+func WithFunctionRegistry(fr *FunctionRegistry) Option {
+	return func(r *Context) error {
+
+		if len(r.vars) == 0 {
+			r.vars = make(map[string]interface{})
+		}
+
+		// the namespaces shared with the functions already set are merged into a new map: the ones of the registries are not modified.
+		for n, i := range fr.FuncMap() {
+			ns, isNs := i.(map[string]interface{})
+			current, ok := r.vars[n].(map[string]interface{})
+			if !isNs || !ok {
+				r.vars[n] = i
+				continue
+			}
+
+			merged := make(map[string]interface{}, len(current)+len(ns))
+			for fn, f := range current {
+				merged[fn] = f
+			}
+			for fn, f := range ns {
+				merged[fn] = f
+			}
+			r.vars[n] = merged
+		}
+
+		return nil
+	}
+}
+
+// WithGlobalVars registers the store used to resolve the g: references.
+func WithGlobalVars(g *GlobalVars) Option {
+	return func(r *Context) error {
+		r.globals = g
+		return nil
+	}
+}
+
+// WithTypedReferences enables the typed mode: the expressions are evaluated through Compile and the references
+// outside string literals without format options keep the type of their value (json numbers are float64, arrays are []interface{} and so on)
+// instead of being turned into text.
+func WithTypedReferences(b bool) Option {
+	return func(r *Context) error {
+		r.typedReferences = b
+		return nil
+	}
+}
+
 // WithGValFunctions Not used actually. Not needed for expression. The funcMap should be enough
 func WithGValFunctions(fm []gval.Language) Option {
 	return func(r *Context) error {
@@ -126,7 +253,7 @@ func WithMapInput(aBody map[string]interface{}) Option {
 func NewContext(opts ...Option) (*Context, error) {
 	pvr := &Context{}
 	pvr.vars = make(map[string]interface{})
-	for n, i := range funcs.Builtins() {
+	for n, i := range DefaultFunctionRegistry().FuncMap() {
 		pvr.vars[n] = i
 	}
 
@@ -147,6 +274,9 @@ func NewContext(opts ...Option) (*Context, error) {
 	return pvr, nil
 }
 
+// QueryParamAllValuesSuffix appended to the name of a q: reference selects all the values of a multi-valued param.
+const QueryParamAllValuesSuffix = "[]"
+
 type EvaluationMode string
 
 const (
@@ -179,14 +309,42 @@ func (pvr *Context) Add(n string, v interface{}) error {
 }
 
 func (pvr *Context) EvalOne(v string) (interface{}, error) {
+	return pvr.EvalOneCtx(context.Background(), v)
+}
+
+// EvalOneCtx is EvalOne honoring the cancellation and the deadline of ctx: the evaluation stops with the error of ctx
+// before resolving the references, before evaluating the text and at each function call.
+func (pvr *Context) EvalOneCtx(ctx context.Context, v string) (interface{}, error) {
+	tr := pvr.startTrace(v)
+	res, err := pvr.evalOne(ctx, v)
+	pvr.endTrace(tr, res, err)
+	return res, err
+}
+
+func (pvr *Context) evalOne(ctx context.Context, v string) (interface{}, error) {
 
 	if v == "" {
 		return "", nil
 	}
 
+	if pvr.typedReferences {
+		ce, err := Compile(v)
+		if err != nil {
+			return "", err
+		}
+		return ce.EvalCtx(ctx, pvr)
+	}
+
+	if err := pvr.checkExpression(ctx, v, -1); err != nil {
+		return "", err
+	}
+
 	var err error
 	var deferred bool
-	v, deferred, err = varResolver.ResolveVariables(v, varResolver.AnyVariableReference, pvr.resolveVar, true)
+	v, deferred, err = pvr.resolveVariables(v)
+	if err == nil {
+		err = ctx.Err()
+	}
 	if err != nil {
 		return "", err
 	}
@@ -196,13 +354,38 @@ func (pvr *Context) EvalOne(v string) (interface{}, error) {
 		v, isExpr = funcs.IsExpression(v)
 
 		if isExpr {
-			return gval.Evaluate(v, pvr.vars, pvr.gvals...)
+			pvr.traceText(v, isExpr)
+			return pvr.evaluate(ctx, v)
 		}
 	}
 
+	pvr.traceText(v, isExpr)
+	if err = pvr.limits.checkOutput(v); err != nil {
+		return "", err
+	}
 	return v, nil
 }
 
+// evaluate hands the resolved text over to gval.
+func (pvr *Context) evaluate(ctx context.Context, text string) (interface{}, error) {
+	eval, err := gval.Full(pvr.gvals...).NewEvaluable(text)
+	if err != nil {
+		return nil, err
+	}
+
+	h := pvr.newCallHook(ctx)
+	res, err := eval(ctx, pvr.gvalParams(h))
+	if err = h.evalErr(ctx, err); err != nil {
+		return nil, err
+	}
+
+	if err = pvr.limits.checkOutput(res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
 func (pvr *Context) BoolEvalMany(varExpressions []string, mode EvaluationMode) (bool, int, error) {
 
 	if len(varExpressions) == 0 {
@@ -252,6 +435,18 @@ func (pvr *Context) BoolEvalMany(varExpressions []string, mode EvaluationMode) (
 }
 
 func (pvr *Context) BoolEvalOne(v string) (bool, error) {
+	return pvr.BoolEvalOneCtx(context.Background(), v)
+}
+
+// BoolEvalOneCtx is BoolEvalOne honoring the cancellation and the deadline of ctx as EvalOneCtx does.
+func (pvr *Context) BoolEvalOneCtx(ctx context.Context, v string) (bool, error) {
+	tr := pvr.startTrace(v)
+	res, err := pvr.boolEvalOne(ctx, v)
+	pvr.endTrace(tr, res, err)
+	return res, err
+}
+
+func (pvr *Context) boolEvalOne(ctx context.Context, v string) (bool, error) {
 
 	const semLogContext = "expression-ctx::bool-eval-one"
 	// The empty expression evaluates to true.
@@ -259,12 +454,28 @@ func (pvr *Context) BoolEvalOne(v string) (bool, error) {
 		return true, nil
 	}
 
+	if pvr.typedReferences {
+		ce, err := Compile(v)
+		if err != nil {
+			return false, err
+		}
+		return ce.BoolEvalCtx(ctx, pvr)
+	}
+
+	if err := pvr.checkExpression(ctx, v, -1); err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+		return false, err
+	}
+
 	var err error
 	var deferred bool
 
 	// Current formulation seems to be wrong.... variables are resolved only if it's an expression...
 	// if isExpr {
-	v, deferred, err = varResolver.ResolveVariables(v, varResolver.AnyVariableReference, pvr.resolveVar, true)
+	v, deferred, err = pvr.resolveVariables(v)
+	if err == nil {
+		err = ctx.Err()
+	}
 	if err != nil {
 		log.Error().Err(err).Str("expr", v).Msg(semLogContext)
 		return false, err
@@ -287,7 +498,8 @@ func (pvr *Context) BoolEvalOne(v string) (bool, error) {
 	}
 	*/
 
-	exprValue, err := gval.Evaluate(v, pvr.vars, pvr.gvals...)
+	pvr.traceText(v, true)
+	exprValue, err := pvr.evaluate(ctx, v)
 	if err != nil {
 		log.Error().Err(err).Str("expr", v).Msg(semLogContext)
 		return false, err
@@ -304,7 +516,20 @@ func (pvr *Context) BoolEvalOne(v string) (bool, error) {
 
 var resolverTypePrefix = []string{"$.", "$[", "h:", "p:", "v:"}
 
-func (pvr *Context) resolveVar(_ string, s string) (string, bool) {
+// resolveVariables resolves the variables of an expression as text. The env variables not resolved under a strict policy are an error:
+// the first one is kept by the resolver of the call, so that a context can be shared by concurrent evaluations.
+func (pvr *Context) resolveVariables(v string) (string, bool, error) {
+	var resolveErr error
+	s, deferred, err := varResolver.ResolveVariables(v, varResolver.AnyVariableReference, func(_ string, s string) (string, bool) {
+		return pvr.resolveVar(s, &resolveErr)
+	}, true)
+	if err == nil {
+		err = resolveErr
+	}
+	return s, deferred, err
+}
+
+func (pvr *Context) resolveVar(s string, resolveErr *error) (string, bool) {
 
 	const semLogContext = "expr-context::resolve-var"
 
@@ -317,68 +542,88 @@ func (pvr *Context) resolveVar(_ string, s string) (string, bool) {
 
 	variable, _ := varResolver.ParseVariable(s)
 	if variable.Deferred {
+		pvr.traceVariable(s, nil, "", true, nil)
 		return variable.Raw(), variable.Deferred
 	}
 
-	pfix, err := pvr.validatePrefix(variable.Prefix)
+	varValue, err := pvr.varValue(variable, nil)
 	if err != nil {
+		pvr.traceVariable(s, nil, "", false, err)
+		if errors.Is(err, ErrEnvVarNotResolved) && *resolveErr == nil {
+			*resolveErr = err
+		}
 		return "", variable.Deferred
 	}
 
+	ref := s
+	s, err = variable.ToString(varValue, doEscape, false)
+	if err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+	}
+
+	pvr.traceVariable(ref, varValue, s, false, err)
+
+	return s, variable.Deferred
+}
+
+// varValue looks up the raw value of a parsed variable reference. jsonPath is the pre-compiled evaluable of $. and $[ references:
+// if nil the path gets parsed on the fly. Unknown json keys are not reported as errors and resolve to a nil value.
+func (pvr *Context) varValue(variable varResolver.Variable, jsonPath gval.Evaluable) (interface{}, error) {
+
+	const semLogContext = "expr-context::var-value"
+
+	pfix, err := pvr.validatePrefix(variable.Prefix)
+	if err != nil {
+		return nil, err
+	}
+
 	var varValue interface{}
 
 	switch pfix {
 	case varResolver.VariablePrefixDollarSquareBracket:
 		fallthrough
 	case varResolver.VariablePrefixDollarDot:
-
-		varValue, err = jsonpath.Get(variable.JsonPathName(), pvr.input)
+		if jsonPath != nil {
+			varValue, err = jsonPath(context.Background(), pvr.input)
+		} else {
+			varValue, err = jsonpath.Get(variable.JsonPathName(), pvr.input)
+		}
 		// log.Trace().Str("path-name", s).Interface("value", v).Msg("evaluation of var")
-		/*
-			if err == nil {
-				s, err = pvr.jsonPathValueToString(varValue)
-				if err == nil {
-					return pvr.jsonEscape(s, doEscape)
-				}
-			}
-		*/
 
 	case varResolver.VariablePrefixHColon:
 		varValue = pvr.headers.GetFirst(variable.Name).Value
-		// return pvr.jsonEscape(s, doEscape)
+
+	case varResolver.VariablePrefixPColon:
+		varValue = pvr.pathParams.GetFirst(variable.Name).Value
+
+	case varResolver.VariablePrefixQColon:
+		if n := strings.TrimSuffix(variable.Name, QueryParamAllValuesSuffix); n != variable.Name {
+			var values []interface{}
+			for _, qv := range pvr.queryParams.GetAll(n) {
+				values = append(values, qv)
+			}
+			varValue = values
+		} else {
+			varValue = pvr.queryParams.GetFirst(variable.Name).Value
+		}
 
 	case varResolver.VariablePrefixVColon:
 		varValue, _ = pvr.vars[variable.Name]
-		/*
-			if ok {
-				s = fmt.Sprintf("%v", varValue)
-				return pvr.jsonEscape(s, doEscape)
-			}
-		*/
+
 	case varResolver.VariablePrefixGColon:
-		err = errors.New("unsupported g: prefix")
+		varValue, _ = pvr.globals.Get(variable.Name)
 	default:
-		varValue, _ = os.LookupEnv(variable.Name)
-		/*
-			if ok {
-				return pvr.jsonEscape(varValue.(string), doEscape)
-			}
-		*/
+		return pvr.lookupEnv(variable)
 	}
 
 	if err != nil {
 		if !isJsonPathUnknownKey(err) {
 			log.Error().Err(err).Msg(semLogContext)
-			return "", variable.Deferred
+			return nil, err
 		}
 	}
 
-	s, err = variable.ToString(varValue, doEscape, false)
-	if err != nil {
-		log.Error().Err(err).Msg(semLogContext)
-	}
-
-	return s, variable.Deferred
+	return varValue, nil
 }
 
 func isJsonPathUnknownKey(err error) bool {
@@ -445,13 +690,25 @@ func (pvr *Context) validatePrefix(pfix varResolver.VariablePrefix) (varResolver
 		}
 
 	case varResolver.VariablePrefixGColon:
-		isValid = true
+		if pvr.globals != nil {
+			isValid = true
+		}
 
 	case varResolver.VariablePrefixHColon:
 		if pvr.headers != nil {
 			isValid = true
 		}
 
+	case varResolver.VariablePrefixPColon:
+		if pvr.pathParams != nil {
+			isValid = true
+		}
+
+	case varResolver.VariablePrefixQColon:
+		if pvr.queryParams != nil {
+			isValid = true
+		}
+
 	case varResolver.VariablePrefixEnv:
 		isValid = true
 	}
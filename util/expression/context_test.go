@@ -3,6 +3,8 @@ package expression_test
 import (
 	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/expression"
 	"github.com/stretchr/testify/require"
+	"net/url"
+	"sync"
 	"testing"
 	"time"
 )
@@ -145,3 +147,217 @@ func TestContextBoolEvaluation(t *testing.T) {
 	}
 
 }
+
+func TestContextTypedEvaluation(t *testing.T) {
+	arr := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{
+			expr:     `lenJsonArray({$.operazioni}) == 1`,
+			expected: true,
+		},
+		{
+			expr:     `:{$.operazione.importo}`,
+			expected: float64(0),
+		},
+		{
+			expr:     `:{$.operazione.importo} + 10`,
+			expected: float64(10),
+		},
+		{
+			expr:     `{$.beneficiario.intestazione} == "MARIO ROSSI"`,
+			expected: true,
+		},
+		{
+			expr:     `{v:quoted} == "say \"hello\""`,
+			expected: true,
+		},
+		{
+			expr:     "\"{v:quoted}\" == `say \"hello\"`",
+			expected: true,
+		},
+		{
+			expr:     `isDef({$.missing.props})`,
+			expected: false,
+		},
+		{
+			expr:     `{$.beneficiario.numero,len=-10,pad=0} == 8188602`,
+			expected: true,
+		},
+		{
+			expr:     `{v:flag} && {v:num} > 2`,
+			expected: true,
+		},
+	}
+
+	exprCtx, err := expression.NewContext(
+		expression.WithJsonInput(j),
+		expression.WithVars(map[string]interface{}{"quoted": `say "hello"`, "flag": true, "num": 3}),
+		expression.WithTypedReferences(true))
+	require.NoError(t, err)
+
+	for i, input := range arr {
+		v, err := exprCtx.EvalOne(input.expr)
+		require.NoError(t, err, "[%d] error", i)
+		require.EqualValues(t, input.expected, v, "[%d] Expected doesn't match actual", i)
+	}
+
+	v, err := exprCtx.EvalOne(`:{$.operazioni}`)
+	require.NoError(t, err)
+	require.IsType(t, []interface{}{}, v)
+
+	b, err := exprCtx.BoolEvalOne(`{$.ordinante.natura} == "DT" && lenJsonArray({$.operazioni}) < 2`)
+	require.NoError(t, err)
+	require.True(t, b)
+}
+
+func TestContextFallbacksAndNestedReferences(t *testing.T) {
+
+	arr := []struct {
+		expr     string
+		expected interface{}
+		typed    interface{}
+	}{
+		{expr: `{v:missing|'def'}`, expected: "def", typed: "def"},
+		{expr: `{v:x-{v:env}}`, expected: "12", typed: "12"},
+		{expr: `:{v:x-{v:env}}`, expected: 12.0, typed: 12},
+		{expr: `:{v:missing|v:x-{v:env}} + 1`, expected: 13.0, typed: 13.0},
+		{expr: `"{v:missing|v:a}" == "A"`, expected: true, typed: true},
+		{expr: `:{v:missing|v:flag} && true`, expected: true, typed: true},
+		{expr: `"{v:x-{v:missing|'prod'}|'none'}" == "12"`, expected: true, typed: true},
+	}
+
+	for _, typed := range []bool{false, true} {
+		exprCtx, err := expression.NewContext(
+			expression.WithVars(map[string]interface{}{"a": "A", "env": "prod", "x-prod": 12, "flag": true}),
+			expression.WithTypedReferences(typed))
+		require.NoError(t, err)
+
+		for i, input := range arr {
+			expected := input.expected
+			if typed {
+				expected = input.typed
+			}
+
+			v, err := exprCtx.EvalOne(input.expr)
+			require.NoError(t, err, "[%d] error", i)
+			require.EqualValues(t, expected, v, "[%d] typed: %t - expected doesn't match actual", i, typed)
+		}
+	}
+}
+
+func TestContextPathAndQueryParams(t *testing.T) {
+
+	query, err := url.ParseQuery("page=2&tag=a&tag=b&size=10")
+	require.NoError(t, err)
+
+	exprCtx, err := expression.NewContext(
+		expression.WithPathParams(expression.NameValuePairs{{Name: "id", Value: "8188602"}}),
+		expression.WithQueryParams(query),
+	)
+	require.NoError(t, err)
+
+	arr := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{expr: `{p:id}`, expected: "8188602"},
+		{expr: `{p:id,len=-10,pad=0}`, expected: "0008188602"},
+		{expr: `{q:page}`, expected: "2"},
+		{expr: `{q:tag}`, expected: "a"},
+		{expr: `{q:tag[]}`, expected: `["a","b"]`},
+		{expr: `{q:missing}`, expected: ""},
+		{expr: `{q:page} > 1 && "{p:id}" == "8188602"`, expected: true},
+	}
+
+	for i, input := range arr {
+		v, err := exprCtx.EvalOne(input.expr)
+		require.NoError(t, err, "[%d] error", i)
+		require.EqualValues(t, input.expected, v, "[%d] Expected doesn't match actual", i)
+	}
+
+	exprCtx, err = expression.NewContext(
+		expression.WithQueryParams(query),
+		expression.WithTypedReferences(true),
+	)
+	require.NoError(t, err)
+
+	b, err := exprCtx.BoolEvalOne(`"b" in {q:tag[]} && {q:size} == "10"`)
+	require.NoError(t, err)
+	require.True(t, b)
+
+	_, err = expression.NewContext(expression.WithPathParams(42))
+	require.Error(t, err)
+}
+
+func TestContextEnvPolicy(t *testing.T) {
+	t.Setenv("EXPR_APP_NAME", "tpm")
+	t.Setenv("EXPR_SECRET", "s3cr3t")
+
+	arr := []struct {
+		opts     []expression.Option
+		expr     string
+		expected interface{}
+		wantErr  bool
+	}{
+		{expr: `{EXPR_SECRET}`, expected: "s3cr3t"},
+		{opts: []expression.Option{expression.WithEnvResolution(false)}, expr: `{EXPR_SECRET}`, expected: ""},
+		{opts: []expression.Option{expression.WithEnvResolution(false)}, expr: `{env:EXPR_APP_NAME}`, expected: ""},
+		{opts: []expression.Option{expression.WithEnvAllowList("EXPR_APP_NAME")}, expr: `{EXPR_APP_NAME}-{EXPR_SECRET}`, expected: "tpm-"},
+		{opts: []expression.Option{expression.WithEnvAllowRegexp("^EXPR_APP_")}, expr: `"{EXPR_APP_NAME}" == "tpm"`, expected: true},
+		{opts: []expression.Option{expression.WithEnvAllowRegexp("^EXPR_APP_")}, expr: `"{EXPR_SECRET}" == "s3cr3t"`, expected: false},
+		{opts: []expression.Option{expression.WithEnvAllowList("EXPR_APP_NAME"), expression.WithStrictEnv(true)}, expr: `{EXPR_SECRET}`, wantErr: true},
+		{opts: []expression.Option{expression.WithStrictEnv(true)}, expr: `{EXPR_TYPO}`, wantErr: true},
+		{opts: []expression.Option{expression.WithStrictEnv(true)}, expr: `{env:EXPR_TYPO}`, expected: ""},
+	}
+
+	for i, input := range arr {
+		for _, typed := range []bool{false, true} {
+			exprCtx, err := expression.NewContext(append(input.opts, expression.WithTypedReferences(typed))...)
+			require.NoError(t, err, "[%d] error", i)
+
+			v, err := exprCtx.EvalOne(input.expr)
+			if input.wantErr {
+				require.ErrorIs(t, err, expression.ErrEnvVarNotResolved, "[%d] typed: %t", i, typed)
+				continue
+			}
+
+			require.NoError(t, err, "[%d] error", i)
+			require.EqualValues(t, input.expected, v, "[%d] typed: %t - expected doesn't match actual", i, typed)
+		}
+	}
+
+	_, err := expression.NewContext(expression.WithEnvAllowRegexp("(["))
+	require.Error(t, err)
+}
+
+func TestContextEnvPolicyConcurrent(t *testing.T) {
+	t.Setenv("EXPR_APP_NAME", "tpm")
+
+	exprCtx, err := expression.NewContext(expression.WithStrictEnv(true))
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 20)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				_, errs[i] = exprCtx.BoolEvalOne(`"{EXPR_APP_NAME}" == "tpm"`)
+			} else {
+				_, errs[i] = exprCtx.EvalOne(`{EXPR_TYPO}`)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if i%2 == 0 {
+			require.NoError(t, err, "[%d] error", i)
+		} else {
+			require.ErrorIs(t, err, expression.ErrEnvVarNotResolved, "[%d] error", i)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+
+	varResolver "github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/vars"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrEnvVarNotResolved is the error reported in strict env mode when an env reference is not allowed or the variable is not set.
+var ErrEnvVarNotResolved = errors.New("env variable not resolved")
+
+// envPolicy restricts the resolution of the env: references and of the references without prefix.
+// The zero value resolves every env variable as the context always did.
+type envPolicy struct {
+	disabled    bool
+	allowList   map[string]struct{}
+	allowRegexp *regexp.Regexp
+	strict      bool
+}
+
+// WithEnvResolution enables or disables the resolution of env variables. When disabled env references resolve to the empty string.
+func WithEnvResolution(enabled bool) Option {
+	return func(r *Context) error {
+		r.env.disabled = !enabled
+		return nil
+	}
+}
+
+// WithEnvAllowList restricts the resolution to the named env variables. It can be combined with WithEnvAllowRegexp: a name is allowed if it satisfies either.
+func WithEnvAllowList(names ...string) Option {
+	return func(r *Context) error {
+		if r.env.allowList == nil {
+			r.env.allowList = make(map[string]struct{})
+		}
+
+		for _, n := range names {
+			r.env.allowList[n] = struct{}{}
+		}
+		return nil
+	}
+}
+
+// WithEnvAllowRegexp restricts the resolution to the env variables whose names match the pattern.
+func WithEnvAllowRegexp(pattern string) Option {
+	return func(r *Context) error {
+		var err error
+		r.env.allowRegexp, err = regexp.Compile(pattern)
+		return err
+	}
+}
+
+// WithStrictEnv makes the evaluation fail with ErrEnvVarNotResolved when an env variable is not allowed or a reference without prefix cannot be resolved.
+func WithStrictEnv(b bool) Option {
+	return func(r *Context) error {
+		r.env.strict = b
+		return nil
+	}
+}
+
+func (p envPolicy) isAllowed(n string) bool {
+	if p.disabled {
+		return false
+	}
+
+	if p.allowList == nil && p.allowRegexp == nil {
+		return true
+	}
+
+	if _, ok := p.allowList[n]; ok {
+		return true
+	}
+
+	return p.allowRegexp != nil && p.allowRegexp.MatchString(n)
+}
+
+// lookupEnv resolves an env variable according to the policy of the context. A bare reference, the one without prefix, that cannot be
+// resolved is most likely a typo and gets logged.
+func (pvr *Context) lookupEnv(variable varResolver.Variable) (interface{}, error) {
+
+	const semLogContext = "expr-context::lookup-env"
+
+	bare := variable.Prefix == varResolver.VariablePrefixNotSpecified
+	if !pvr.env.isAllowed(variable.Name) {
+		log.Warn().Str("name", variable.Name).Bool("bare", bare).Msg(semLogContext + " - env variable not allowed")
+		if pvr.env.strict {
+			return nil, fmt.Errorf("%w: %s not allowed", ErrEnvVarNotResolved, variable.Name)
+		}
+		return "", nil
+	}
+
+	v, ok := os.LookupEnv(variable.Name)
+	if !ok && bare {
+		log.Warn().Str("name", variable.Name).Msg(semLogContext + " - reference without prefix not resolved")
+		if pvr.env.strict {
+			return nil, fmt.Errorf("%w: %s not set", ErrEnvVarNotResolved, variable.Name)
+		}
+	}
+
+	return v, nil
+}
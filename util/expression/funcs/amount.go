@@ -0,0 +1,154 @@
+package funcs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+const (
+	RoundingHalfUp   = "half-up"
+	RoundingHalfEven = "half-even"
+	RoundingDown     = "down"
+)
+
+var ErrAmountOverflow = errors.New("amount overflow")
+
+// amountUnitScales are the number of decimal digits of each unit with respect to the currency unit: 1 euro is 100 cents and 1000000 micro.
+var amountUnitScales = map[string]int{
+	Dime:      1,
+	Cent:      2,
+	Mill:      3,
+	DeciMill:  4,
+	MicroCent: 6,
+}
+
+func unitScale(unit string) (int, error) {
+	if s, ok := amountUnitScales[unit]; ok {
+		return s, nil
+	}
+	return 0, fmt.Errorf("amount unit %s not supported", unit)
+}
+
+func pow10Rat(n int) *big.Rat {
+	return new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil))
+}
+
+// parseDecimal parses the text of a number without going through floats. The comma is accepted as decimal separator.
+func parseDecimal(s string) (*big.Rat, error) {
+	s = strings.TrimSpace(strings.ReplaceAll(s, ",", "."))
+	if s == "" || strings.ContainsAny(s, "/eE") {
+		return nil, fmt.Errorf("invalid decimal number: %q", s)
+	}
+
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("invalid decimal number: %q", s)
+	}
+
+	return r, nil
+}
+
+// decimalValue converts the supported number types to an exact rational. Floats are taken for the shortest decimal that represents them.
+func decimalValue(a interface{}) (*big.Rat, error) {
+	switch ta := a.(type) {
+	case string:
+		return parseDecimal(ta)
+	case float64:
+		if math.IsNaN(ta) || math.IsInf(ta, 0) {
+			return nil, fmt.Errorf("invalid decimal number: %v", ta)
+		}
+		return parseDecimal(strconv.FormatFloat(ta, 'f', -1, 64))
+	case float32:
+		return parseDecimal(strconv.FormatFloat(float64(ta), 'f', -1, 32))
+	case int64:
+		return new(big.Rat).SetInt64(ta), nil
+	case int32:
+		return new(big.Rat).SetInt64(int64(ta)), nil
+	case int:
+		return new(big.Rat).SetInt64(int64(ta)), nil
+	}
+
+	return nil, fmt.Errorf("unsupported number type %T", a)
+}
+
+// roundAmount rounds to an integer number of units. RoundingDown truncates towards zero, RoundingHalfUp rounds the halves away from zero
+// and RoundingHalfEven, the banker's rounding, rounds the halves to the even neighbour. The empty mode is RoundingHalfUp.
+func roundAmount(r *big.Rat, rounding string) (int64, error) {
+
+	switch rounding {
+	case RoundingDown, RoundingHalfUp, RoundingHalfEven, "":
+	default:
+		return 0, fmt.Errorf("rounding mode %s not supported", rounding)
+	}
+
+	q, m := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if m.Sign() != 0 {
+		roundAway := false
+		switch rounding {
+		case RoundingDown:
+		case RoundingHalfUp, "":
+			half := new(big.Int).Lsh(new(big.Int).Abs(m), 1)
+			roundAway = half.Cmp(r.Denom()) >= 0
+		case RoundingHalfEven:
+			half := new(big.Int).Lsh(new(big.Int).Abs(m), 1)
+			c := half.Cmp(r.Denom())
+			roundAway = c > 0 || (c == 0 && q.Bit(0) == 1)
+		}
+
+		if roundAway {
+			if r.Sign() < 0 {
+				q.Sub(q, big.NewInt(1))
+			} else {
+				q.Add(q, big.NewInt(1))
+			}
+		}
+	}
+
+	if !q.IsInt64() {
+		return 0, ErrAmountOverflow
+	}
+
+	return q.Int64(), nil
+}
+
+// scaleAmount re-expresses an amount given in the source unit in the target unit. The result is exact: rounding is left to the caller.
+func scaleAmount(r *big.Rat, sourceUnit, targetUnit string) (*big.Rat, error) {
+	ss, err := unitScale(sourceUnit)
+	if err != nil {
+		return nil, err
+	}
+
+	ts, err := unitScale(targetUnit)
+	if err != nil {
+		return nil, err
+	}
+
+	r = new(big.Rat).Set(r)
+	switch {
+	case ts > ss:
+		r.Mul(r, pow10Rat(ts-ss))
+	case ss > ts:
+		r.Quo(r, pow10Rat(ss-ts))
+	}
+
+	return r, nil
+}
+
+func convertAmount(i int64, sourceUnit, targetUnit string, rounding string) (int64, error) {
+	r, err := scaleAmount(new(big.Rat).SetInt64(i), sourceUnit, targetUnit)
+	if err != nil {
+		return 0, err
+	}
+	return roundAmount(r, rounding)
+}
+
+func addAmounts(a, b int64) (int64, error) {
+	if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b) {
+		return 0, ErrAmountOverflow
+	}
+	return a + b, nil
+}
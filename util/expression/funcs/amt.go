@@ -1,8 +1,10 @@
 package funcs
 
 import (
+	"errors"
 	"fmt"
 	"math"
+	"math/big"
 	"strconv"
 	"strings"
 
@@ -22,38 +24,34 @@ const (
 
 	ConversionMapKetFormat = "%s_to_%s"
 
-	AmountOpAdd  = "add"
-	AmountOpDiff = "diff"
+	AmountOpAdd   = "add"
+	AmountOpDiff  = "diff"
+	AmountOpMul   = "mul"
+	AmountOpDiv   = "div"
+	AmountOpPct   = "pct"
+	AmountOpRound = "round"
 )
 
-var amountConversionsMap = map[string]func(string) string{
-	fmt.Sprintf(ConversionMapKetFormat, Cent, Mill):      func(a string) string { return a + "0" },
-	fmt.Sprintf(ConversionMapKetFormat, Cent, MicroCent): func(a string) string { return a + "0000" },
-	fmt.Sprintf(ConversionMapKetFormat, Cent, Cent):      func(a string) string { return a },
-	fmt.Sprintf(ConversionMapKetFormat, Mill, Mill):      func(a string) string { return a },
-	fmt.Sprintf(ConversionMapKetFormat, Mill, Cent): func(a string) string {
-		if len(a) > 1 {
-			return a[0 : len(a)-1]
-		}
-
-		return "0"
-	},
-
-	fmt.Sprintf(ConversionMapKetFormat, MicroCent, Cent): func(a string) string {
-		if len(a) > 4 {
-			return a[0 : len(a)-4]
-		}
-
-		return "0"
-	},
-}
-
 func toDecimalFormat(s string) string {
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign = "-"
+		s = s[1:]
+	}
+
 	if len(s) < 3 {
 		s = "000" + s
 		s = s[len(s)-3:]
 	}
-	return s[:len(s)-2] + "." + s[len(s)-2:]
+	return sign + s[:len(s)-2] + "." + s[len(s)-2:]
+}
+
+func amtString(i int64, decimalFormat bool) string {
+	val := strconv.FormatInt(i, 10)
+	if decimalFormat {
+		val = toDecimalFormat(val)
+	}
+	return val
 }
 
 func AmtAdd(sourceUnit, targetUnit string, decimalFormat bool, amts ...interface{}) (string, error) {
@@ -64,6 +62,75 @@ func AmtDiff(sourceUnit, targetUnit string, decimalFormat bool, amts ...interfac
 	return Amt(AmountOpDiff, sourceUnit, targetUnit, decimalFormat, amts...)
 }
 
+// AmtMul multiplies the amount by a rate. The computation is exact and the result is rounded once in the target unit.
+func AmtMul(sourceUnit, targetUnit string, decimalFormat bool, amt interface{}, rate interface{}, rounding string) (string, error) {
+	return amtRate(AmountOpMul, sourceUnit, targetUnit, decimalFormat, amt, rate, rounding)
+}
+
+// AmtDiv divides the amount by a rate. The computation is exact and the result is rounded once in the target unit.
+func AmtDiv(sourceUnit, targetUnit string, decimalFormat bool, amt interface{}, rate interface{}, rounding string) (string, error) {
+	return amtRate(AmountOpDiv, sourceUnit, targetUnit, decimalFormat, amt, rate, rounding)
+}
+
+// AmtPct computes the pct percentage of the amount: AmtPct("cent", "cent", false, "1000", 22, "half-up") is 220.
+func AmtPct(sourceUnit, targetUnit string, decimalFormat bool, amt interface{}, pct interface{}, rounding string) (string, error) {
+	return amtRate(AmountOpPct, sourceUnit, targetUnit, decimalFormat, amt, pct, rounding)
+}
+
+// AmtRound converts the amount to the target unit with the given rounding instead of truncating it as AmtConv does.
+func AmtRound(sourceUnit, targetUnit string, decimalFormat bool, amt interface{}, rounding string) (string, error) {
+	return amtRate(AmountOpRound, sourceUnit, targetUnit, decimalFormat, amt, nil, rounding)
+}
+
+func amtRate(opType string, sourceUnit, targetUnit string, decimalFormat bool, amt interface{}, rate interface{}, rounding string) (string, error) {
+	const semLogContext = "funcs::amt-rate"
+
+	i, err := evaluateRate(opType, sourceUnit, targetUnit, amt, rate, rounding)
+	if err != nil {
+		val := amtString(0, decimalFormat)
+		log.Error().Err(err).Str("op", opType).Str("result", val).Interface("amount", amt).Interface("rate", rate).Msg(semLogContext)
+		return val, err
+	}
+
+	return amtString(i, decimalFormat), nil
+}
+
+func evaluateRate(opType string, sourceUnit, targetUnit string, amt interface{}, rate interface{}, rounding string) (int64, error) {
+	r, sourceUnit, err := evaluateDecimal(amt, sourceUnit)
+	if err != nil {
+		return 0, err
+	}
+
+	if opType != AmountOpRound {
+		rt, err := decimalValue(rate)
+		if err != nil {
+			return 0, err
+		}
+
+		switch opType {
+		case AmountOpMul:
+			r.Mul(r, rt)
+		case AmountOpDiv:
+			if rt.Sign() == 0 {
+				return 0, errors.New("amount division by zero")
+			}
+			r.Quo(r, rt)
+		case AmountOpPct:
+			r.Mul(r, rt)
+			r.Quo(r, pow10Rat(2))
+		default:
+			return 0, fmt.Errorf("amount op %s not supported", opType)
+		}
+	}
+
+	r, err = scaleAmount(r, sourceUnit, targetUnit)
+	if err != nil {
+		return 0, err
+	}
+
+	return roundAmount(r, rounding)
+}
+
 func AmtConv(sourceUnit, targetUnit string, decimalFormat bool, amt interface{}) (string, error) {
 	const semLogContext = "funcs::amt-conv"
 
@@ -88,22 +155,15 @@ func AmtConv(sourceUnit, targetUnit string, decimalFormat bool, amt interface{})
 		log.Info().Int64("total", iAmt).Msg("Op gives a negative result")
 	}
 
-	convName := fmt.Sprintf(ConversionMapKetFormat, exprSourceUnit, targetUnit)
-	if f, ok := amountConversionsMap[convName]; ok {
-		val := f(fmt.Sprintf("%d", iAmt))
-		if decimalFormat {
-			val = toDecimalFormat(val)
-		}
-		return val, nil
+	conv, err := convertAmount(iAmt, exprSourceUnit, targetUnit, RoundingDown)
+	if err != nil {
+		val := amtString(0, decimalFormat)
+		err = fmt.Errorf("conversion from %s to %s: %w", exprSourceUnit, targetUnit, err)
+		log.Error().Err(err).Str("result", val).Int64("total", iAmt).Msg(semLogContext)
+		return val, err
 	}
 
-	val := "0"
-	if decimalFormat {
-		val = toDecimalFormat(val)
-	}
-	err = fmt.Errorf("conversion not supported from %s to %s", string(exprSourceUnit), string(targetUnit))
-	log.Error().Err(err).Str("result", val).Int64("total", iAmt).Msg(semLogContext)
-	return val, err
+	return amtString(conv, decimalFormat), nil
 }
 
 func AmtCmp(cmpUnit string, amt1, amt1Unit string, amt2, amt2Unit string) (bool, error) {
@@ -156,93 +216,80 @@ func Amt(opType string, sourceUnit, targetUnit string, decimalFormat bool, amts
 			return val, err
 		}
 
-		total = amtOp(opType, total, aNdx, i)
+		total, err = amtOp(opType, total, aNdx, i)
+		if err != nil {
+			val := amtString(0, decimalFormat)
+			log.Error().Err(err).Str("result", val).Interface("amount", a).Msg(semLogContext)
+			return val, err
+		}
 	}
 
 	if total < 0 {
 		log.Info().Int64("total", total).Msg("Op gives a negative result")
 	}
 
-	convName := fmt.Sprintf(ConversionMapKetFormat, exprSourceUnit, targetUnit)
-	if f, ok := amountConversionsMap[convName]; ok {
-		val := f(fmt.Sprintf("%d", total))
-		if decimalFormat {
-			val = toDecimalFormat(val)
-		}
-		return val, nil
+	conv, err := convertAmount(total, exprSourceUnit, targetUnit, RoundingDown)
+	if err != nil {
+		val := amtString(0, decimalFormat)
+		err = fmt.Errorf("conversion from %s to %s: %w", exprSourceUnit, targetUnit, err)
+		log.Error().Err(err).Str("result", val).Int64("total", total).Msg(semLogContext)
+		return val, err
 	}
 
-	val := "0"
-	if decimalFormat {
-		val = toDecimalFormat(val)
-	}
-	err := fmt.Errorf("conversion not supported from %s to %s", string(exprSourceUnit), string(targetUnit))
-	log.Error().Err(err).Str("result", val).Int64("total", total).Msg(semLogContext)
-	return val, err
+	return amtString(conv, decimalFormat), nil
 }
 
+// evaluate returns the amount as an integer number of units. Amounts in the decimal formats are rounded half-up to cents or mills,
+// the fractional part of the others is truncated.
 func evaluate(a interface{}, sourceUnit string) (int64, string, error) {
-	var f float64
-	var i int64
-	var err error
-	switch ta := a.(type) {
-	case string:
-		if strings.Index(ta, ",") >= 0 {
-			ta = strings.ReplaceAll(ta, ",", ".")
-		}
+	rounding := RoundingDown
+	if sourceUnit == DecimalCent || sourceUnit == DecimalMillis {
+		rounding = RoundingHalfUp
+	}
 
-		if strings.Index(ta, ".") >= 0 {
-			f, err = strconv.ParseFloat(ta, 64)
-			if err == nil {
-				switch sourceUnit {
-				case Cent:
-					i = int64(f)
-				case DecimalCent:
-					f100 := math.Round(f * 100) // used a temp variable to better analyze in debug whats is going on in this case.
-					i = int64(f100)
-					sourceUnit = Cent
-				case DecimalMillis:
-					i = int64(math.Round(f * 1000))
-					sourceUnit = Mill
-				default:
-					i = int64(f)
-				}
-			}
-		} else {
-			i, err = strconv.ParseInt(ta, 10, 64)
-			if err == nil {
-				switch sourceUnit {
-				case DecimalCent:
-					i = i * 100
-					sourceUnit = Cent
-				case DecimalMillis:
-					i = i * 1000
-					sourceUnit = Mill
-				}
-			}
-		}
-	case int64:
-		i = ta
-	case int32:
-		i = int64(ta)
-	case int:
-		i = int64(ta)
+	r, sourceUnit, err := evaluateDecimal(a, sourceUnit)
+	if err != nil {
+		return 0, sourceUnit, err
 	}
+
+	i, err := roundAmount(r, rounding)
 	return i, sourceUnit, err
 }
 
-func amtOp(opType string, total int64, ndx int, i int64) int64 {
+// evaluateDecimal returns the exact value of the amount. The decimal formats are turned into cents and mills.
+func evaluateDecimal(a interface{}, sourceUnit string) (*big.Rat, string, error) {
+	r, err := decimalValue(a)
+	if err != nil {
+		return nil, sourceUnit, err
+	}
+
+	switch sourceUnit {
+	case DecimalCent:
+		r.Mul(r, pow10Rat(2))
+		sourceUnit = Cent
+	case DecimalMillis:
+		r.Mul(r, pow10Rat(3))
+		sourceUnit = Mill
+	}
+
+	return r, sourceUnit, nil
+}
+
+func amtOp(opType string, total int64, ndx int, i int64) (int64, error) {
 
 	switch opType {
 	case AmountOpAdd:
-		total = total + i
+		return addAmounts(total, i)
 	case AmountOpDiff:
 		if ndx == 0 {
-			total = i
-		} else {
-			total = total - i
+			return i, nil
+		}
+
+		if i == math.MinInt64 {
+			return 0, ErrAmountOverflow
 		}
+		return addAmounts(total, -i)
 	}
 
-	return total
+	return total, nil
 }
@@ -0,0 +1,115 @@
+package funcs_test
+
+import (
+	"testing"
+
+	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/expression/funcs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAmtConv(t *testing.T) {
+	arr := []struct {
+		sourceUnit    string
+		targetUnit    string
+		decimalFormat bool
+		amt           interface{}
+		expected      string
+	}{
+		{sourceUnit: funcs.Cent, targetUnit: funcs.Mill, amt: "123", expected: "1230"},
+		{sourceUnit: funcs.Cent, targetUnit: funcs.MicroCent, amt: "123", expected: "1230000"},
+		{sourceUnit: funcs.Mill, targetUnit: funcs.Cent, amt: "1239", expected: "123"},
+		{sourceUnit: funcs.MicroCent, targetUnit: funcs.Cent, amt: "1239999", expected: "123"},
+		{sourceUnit: funcs.Dime, targetUnit: funcs.Cent, amt: "12", expected: "120"},
+		{sourceUnit: funcs.Dime, targetUnit: funcs.DeciMill, amt: "12", expected: "12000"},
+		{sourceUnit: funcs.DeciMill, targetUnit: funcs.Dime, amt: "12999", expected: "12"},
+		{sourceUnit: funcs.DeciMill, targetUnit: funcs.MicroCent, amt: "5", expected: "500"},
+		{sourceUnit: funcs.DecimalCent, targetUnit: funcs.Cent, amt: "12,345", expected: "1235"},
+		{sourceUnit: funcs.DecimalCent, targetUnit: funcs.Cent, decimalFormat: true, amt: "0.07", expected: "0.07"},
+		{sourceUnit: funcs.DecimalMillis, targetUnit: funcs.Mill, amt: "1.2345", expected: "1235"},
+		{sourceUnit: funcs.Mill, targetUnit: funcs.Cent, decimalFormat: true, amt: "-1239", expected: "-1.23"},
+		{sourceUnit: funcs.Cent, targetUnit: funcs.Cent, amt: 250.0, expected: "250"},
+	}
+
+	for i, input := range arr {
+		v, err := funcs.AmtConv(input.sourceUnit, input.targetUnit, input.decimalFormat, input.amt)
+		require.NoError(t, err, "[%d] error", i)
+		require.Equal(t, input.expected, v, "[%d] expected doesn't match actual", i)
+	}
+
+	_, err := funcs.AmtConv(funcs.Cent, "lira", false, "100")
+	require.Error(t, err)
+}
+
+func TestAmtOps(t *testing.T) {
+	arr := []struct {
+		op         string
+		sourceUnit string
+		targetUnit string
+		amt        interface{}
+		rate       interface{}
+		rounding   string
+		expected   string
+		wantErr    bool
+	}{
+		{op: funcs.AmountOpMul, sourceUnit: funcs.Cent, targetUnit: funcs.Cent, amt: "1000", rate: "1.5", expected: "1500"},
+		{op: funcs.AmountOpMul, sourceUnit: funcs.Cent, targetUnit: funcs.Cent, amt: "333", rate: 0.1, expected: "33"},
+		{op: funcs.AmountOpMul, sourceUnit: funcs.Cent, targetUnit: funcs.Cent, amt: "5", rate: "0.5", rounding: funcs.RoundingHalfUp, expected: "3"},
+		{op: funcs.AmountOpMul, sourceUnit: funcs.Cent, targetUnit: funcs.Cent, amt: "5", rate: "0.5", rounding: funcs.RoundingHalfEven, expected: "2"},
+		{op: funcs.AmountOpMul, sourceUnit: funcs.Cent, targetUnit: funcs.Cent, amt: "7", rate: "0.5", rounding: funcs.RoundingHalfEven, expected: "4"},
+		{op: funcs.AmountOpMul, sourceUnit: funcs.Cent, targetUnit: funcs.Cent, amt: "-5", rate: "0.5", rounding: funcs.RoundingHalfUp, expected: "-3"},
+		{op: funcs.AmountOpMul, sourceUnit: funcs.Cent, targetUnit: funcs.Cent, amt: "-5", rate: "0.5", rounding: funcs.RoundingDown, expected: "-2"},
+		{op: funcs.AmountOpMul, sourceUnit: funcs.Cent, targetUnit: funcs.Mill, amt: "1001", rate: "0.333", expected: "3333"},
+		{op: funcs.AmountOpMul, sourceUnit: funcs.Cent, targetUnit: funcs.Cent, amt: "9223372036854775807", rate: 2, wantErr: true},
+		{op: funcs.AmountOpMul, sourceUnit: funcs.Cent, targetUnit: funcs.Cent, amt: "100", rate: "1.5", rounding: "ceiling", wantErr: true},
+		{op: funcs.AmountOpDiv, sourceUnit: funcs.Cent, targetUnit: funcs.Cent, amt: "1000", rate: "3", expected: "333"},
+		{op: funcs.AmountOpDiv, sourceUnit: funcs.Cent, targetUnit: funcs.MicroCent, amt: "1000", rate: "3", expected: "3333333"},
+		{op: funcs.AmountOpDiv, sourceUnit: funcs.Cent, targetUnit: funcs.Cent, amt: "1000", rate: "0", wantErr: true},
+		{op: funcs.AmountOpPct, sourceUnit: funcs.Cent, targetUnit: funcs.Cent, amt: "1000", rate: 22, expected: "220"},
+		{op: funcs.AmountOpPct, sourceUnit: funcs.DecimalCent, targetUnit: funcs.Cent, amt: "10.05", rate: "22", rounding: funcs.RoundingHalfEven, expected: "221"},
+		{op: funcs.AmountOpPct, sourceUnit: funcs.Cent, targetUnit: funcs.Cent, amt: "250", rate: "1", rounding: funcs.RoundingHalfEven, expected: "2"},
+		{op: funcs.AmountOpRound, sourceUnit: funcs.Mill, targetUnit: funcs.Cent, amt: "1235", rounding: funcs.RoundingHalfUp, expected: "124"},
+		{op: funcs.AmountOpRound, sourceUnit: funcs.Mill, targetUnit: funcs.Cent, amt: "1235", rounding: funcs.RoundingHalfEven, expected: "124"},
+		{op: funcs.AmountOpRound, sourceUnit: funcs.Mill, targetUnit: funcs.Cent, amt: "1225", rounding: funcs.RoundingHalfEven, expected: "122"},
+		{op: funcs.AmountOpRound, sourceUnit: funcs.MicroCent, targetUnit: funcs.Dime, amt: "150000", rounding: funcs.RoundingHalfUp, expected: "2"},
+		{op: funcs.AmountOpRound, sourceUnit: funcs.DeciMill, targetUnit: funcs.Cent, amt: "12349", rounding: funcs.RoundingDown, expected: "123"},
+	}
+
+	for i, input := range arr {
+		var v string
+		var err error
+		switch input.op {
+		case funcs.AmountOpMul:
+			v, err = funcs.AmtMul(input.sourceUnit, input.targetUnit, false, input.amt, input.rate, input.rounding)
+		case funcs.AmountOpDiv:
+			v, err = funcs.AmtDiv(input.sourceUnit, input.targetUnit, false, input.amt, input.rate, input.rounding)
+		case funcs.AmountOpPct:
+			v, err = funcs.AmtPct(input.sourceUnit, input.targetUnit, false, input.amt, input.rate, input.rounding)
+		case funcs.AmountOpRound:
+			v, err = funcs.AmtRound(input.sourceUnit, input.targetUnit, false, input.amt, input.rounding)
+		}
+
+		if input.wantErr {
+			require.Error(t, err, "[%d] expected error", i)
+			continue
+		}
+
+		require.NoError(t, err, "[%d] error", i)
+		require.Equal(t, input.expected, v, "[%d] expected doesn't match actual", i)
+	}
+}
+
+func TestAmtAddOverflow(t *testing.T) {
+	v, err := funcs.AmtAdd(funcs.Cent, funcs.Cent, true, "100", "250", 5)
+	require.NoError(t, err)
+	require.Equal(t, "3.55", v)
+
+	v, err = funcs.AmtDiff(funcs.Cent, funcs.Cent, false, "100", "250")
+	require.NoError(t, err)
+	require.Equal(t, "-150", v)
+
+	_, err = funcs.AmtAdd(funcs.Cent, funcs.Cent, false, "9223372036854775807", "1")
+	require.ErrorIs(t, err, funcs.ErrAmountOverflow)
+
+	_, err = funcs.AmtConv(funcs.Cent, funcs.MicroCent, false, "9223372036854775807")
+	require.ErrorIs(t, err, funcs.ErrAmountOverflow)
+}
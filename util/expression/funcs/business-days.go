@@ -0,0 +1,261 @@
+package funcs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultDateLayout is the layout of the business-day builtins when no layouts are provided.
+const DefaultDateLayout = "2006-01-02"
+
+const (
+	// AdjustFollowing moves a non business day to the next business day.
+	AdjustFollowing = "following"
+	// AdjustModifiedFollowing moves to the next business day unless it falls in the next month: in that case it moves to the previous one.
+	AdjustModifiedFollowing = "modified-following"
+	// AdjustPreceding moves a non business day to the previous business day.
+	AdjustPreceding = "preceding"
+)
+
+// BusinessCalendar is the business-day arithmetic on top of a holiday calendar. Saturdays and Sundays are never business days.
+type BusinessCalendar struct {
+	HolidayCalendar
+}
+
+func (bc BusinessCalendar) IsBusinessDay(t time.Time) bool {
+	if wd := t.Weekday(); wd == time.Saturday || wd == time.Sunday {
+		return false
+	}
+	return !bc.IsHoliday(t)
+}
+
+// AddBusinessDays moves n business days forward, or backward if n is negative. With n equal to 0 the date is returned as is.
+func (bc BusinessCalendar) AddBusinessDays(t time.Time, n int) time.Time {
+	step := 1
+	if n < 0 {
+		step, n = -1, -n
+	}
+
+	for n > 0 {
+		t = t.AddDate(0, 0, step)
+		if bc.IsBusinessDay(t) {
+			n--
+		}
+	}
+
+	return t
+}
+
+// NextBusinessDay is the first business day after t.
+func (bc BusinessCalendar) NextBusinessDay(t time.Time) time.Time {
+	return bc.AddBusinessDays(t, 1)
+}
+
+// BusinessDaysBetween counts the business days after from up to to included. It is negative if to precedes from.
+func (bc BusinessCalendar) BusinessDaysBetween(from, to time.Time) int {
+	from, to = truncateToDay(from), truncateToDay(to)
+	if to.Before(from) {
+		return -bc.BusinessDaysBetween(to, from)
+	}
+
+	n := 0
+	for d := from.AddDate(0, 0, 1); !d.After(to); d = d.AddDate(0, 0, 1) {
+		if bc.IsBusinessDay(d) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Adjust applies the business day convention to a date, as in the computation of the value date of a payment.
+func (bc BusinessCalendar) Adjust(t time.Time, convention string) (time.Time, error) {
+	if bc.IsBusinessDay(t) {
+		return t, nil
+	}
+
+	switch convention {
+	case AdjustFollowing, "":
+		return bc.AddBusinessDays(t, 1), nil
+	case AdjustPreceding:
+		return bc.AddBusinessDays(t, -1), nil
+	case AdjustModifiedFollowing:
+		adj := bc.AddBusinessDays(t, 1)
+		if adj.Month() != t.Month() {
+			adj = bc.AddBusinessDays(t, -1)
+		}
+		return adj, nil
+	}
+
+	return t, fmt.Errorf("business day convention %s not supported", convention)
+}
+
+// LastBusinessDayOfMonth is the last business day of the month of t.
+func (bc BusinessCalendar) LastBusinessDayOfMonth(t time.Time) time.Time {
+	eom := lastDayOfMonth(t)
+	if bc.IsBusinessDay(eom) {
+		return eom
+	}
+	return bc.AddBusinessDays(eom, -1)
+}
+
+func lastDayOfMonth(t time.Time) time.Time {
+	y, m, _ := t.Date()
+	return time.Date(y, m+1, 0, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+func truncateToDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+func lookupBusinessCalendar(name string) (BusinessCalendar, error) {
+	c, err := LookupCalendar(name)
+	if err != nil {
+		return BusinessCalendar{}, err
+	}
+	return BusinessCalendar{HolidayCalendar: c}, nil
+}
+
+// parseBusinessDate parses a time.Time or a string with the first matching layout. The returned layout is the one to format the results with.
+func parseBusinessDate(value interface{}, layouts []string) (time.Time, string, error) {
+	if len(layouts) == 0 {
+		layouts = []string{DefaultDateLayout}
+	}
+
+	switch t := value.(type) {
+	case time.Time:
+		return t, layouts[0], nil
+	case string:
+		for _, layout := range layouts {
+			if tm, err := time.ParseInLocation(layout, t, time.Local); err == nil {
+				return tm, layout, nil
+			}
+		}
+		return time.Time{}, "", fmt.Errorf("date %s doesn't match the layouts %v", t, layouts)
+	}
+
+	return time.Time{}, "", fmt.Errorf("unsupported date type %T", value)
+}
+
+// AddBusinessDays adds n business days of the calendar to the date. The result has the layout the date has been parsed with.
+func AddBusinessDays(value interface{}, n float64, calendar string, layouts ...string) (string, error) {
+	const semLogContext = "funcs::add-business-days"
+
+	bc, err := lookupBusinessCalendar(calendar)
+	if err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+		return "", err
+	}
+
+	t, layout, err := parseBusinessDate(value, layouts)
+	if err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+		return "", err
+	}
+
+	return bc.AddBusinessDays(t, int(n)).Format(layout), nil
+}
+
+func IsBusinessDay(value interface{}, calendar string, layouts ...string) (bool, error) {
+	const semLogContext = "funcs::is-business-day"
+
+	bc, err := lookupBusinessCalendar(calendar)
+	if err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+		return false, err
+	}
+
+	t, _, err := parseBusinessDate(value, layouts)
+	if err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+		return false, err
+	}
+
+	return bc.IsBusinessDay(t), nil
+}
+
+func NextBusinessDay(value interface{}, calendar string, layouts ...string) (string, error) {
+	return AddBusinessDays(value, 1, calendar, layouts...)
+}
+
+func BusinessDaysBetween(value1, value2 interface{}, calendar string, layouts ...string) (int, error) {
+	const semLogContext = "funcs::business-days-between"
+
+	bc, err := lookupBusinessCalendar(calendar)
+	if err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+		return 0, err
+	}
+
+	t1, _, err := parseBusinessDate(value1, layouts)
+	if err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+		return 0, err
+	}
+
+	t2, _, err := parseBusinessDate(value2, layouts)
+	if err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+		return 0, err
+	}
+
+	return bc.BusinessDaysBetween(t1, t2), nil
+}
+
+// ValueDate adjusts the date to a business day of the calendar with the convention: following, modified-following or preceding.
+func ValueDate(value interface{}, convention string, calendar string, layouts ...string) (string, error) {
+	const semLogContext = "funcs::value-date"
+
+	bc, err := lookupBusinessCalendar(calendar)
+	if err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+		return "", err
+	}
+
+	t, layout, err := parseBusinessDate(value, layouts)
+	if err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+		return "", err
+	}
+
+	t, err = bc.Adjust(t, convention)
+	if err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+		return "", err
+	}
+
+	return t.Format(layout), nil
+}
+
+func EndOfMonth(value interface{}, layouts ...string) (string, error) {
+	const semLogContext = "funcs::end-of-month"
+
+	t, layout, err := parseBusinessDate(value, layouts)
+	if err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+		return "", err
+	}
+
+	return lastDayOfMonth(t).Format(layout), nil
+}
+
+func LastBusinessDayOfMonth(value interface{}, calendar string, layouts ...string) (string, error) {
+	const semLogContext = "funcs::last-business-day-of-month"
+
+	bc, err := lookupBusinessCalendar(calendar)
+	if err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+		return "", err
+	}
+
+	t, layout, err := parseBusinessDate(value, layouts)
+	if err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+		return "", err
+	}
+
+	return bc.LastBusinessDayOfMonth(t).Format(layout), nil
+}
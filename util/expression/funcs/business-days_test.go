@@ -0,0 +1,113 @@
+package funcs_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/expression/funcs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEasterSunday(t *testing.T) {
+	arr := map[int]string{2000: "2000-04-23", 2024: "2024-03-31", 2025: "2025-04-20", 2026: "2026-04-05", 2038: "2038-04-25"}
+	for y, expected := range arr {
+		require.Equal(t, expected, funcs.EasterSunday(y).Format("2006-01-02"), "year %d", y)
+	}
+}
+
+func TestIsBusinessDay(t *testing.T) {
+	arr := []struct {
+		date     string
+		calendar string
+		expected bool
+	}{
+		{date: "2025-04-21", calendar: funcs.CalendarItaly, expected: false},
+		{date: "2025-04-21", calendar: funcs.CalendarTarget2, expected: false},
+		{date: "2025-04-18", calendar: funcs.CalendarItaly, expected: true},
+		{date: "2025-04-18", calendar: funcs.CalendarTarget2, expected: false},
+		{date: "2025-04-25", calendar: funcs.CalendarItaly, expected: false},
+		{date: "2025-04-25", calendar: funcs.CalendarTarget2, expected: true},
+		{date: "2025-12-08", calendar: funcs.CalendarItaly, expected: false},
+		{date: "2025-12-08", calendar: "target2", expected: true},
+		{date: "2024-10-04", calendar: funcs.CalendarItaly, expected: true},
+		{date: "2027-10-04", calendar: funcs.CalendarItaly, expected: false},
+		{date: "2025-04-19", calendar: "", expected: false},
+		{date: "2025-04-21", calendar: "", expected: true},
+	}
+
+	for i, input := range arr {
+		b, err := funcs.IsBusinessDay(input.date, input.calendar)
+		require.NoError(t, err, "[%d] error", i)
+		require.Equal(t, input.expected, b, "[%d] %s in %s", i, input.date, input.calendar)
+	}
+
+	_, err := funcs.IsBusinessDay("2025-04-21", "XX")
+	require.Error(t, err)
+
+	_, err = funcs.IsBusinessDay("21/04/2025", funcs.CalendarItaly)
+	require.Error(t, err)
+
+	funcs.RegisterCalendar(&funcs.RuleCalendar{CalendarName: "Roma", Fixed: []funcs.MonthDay{{Month: time.June, Day: 29}}})
+	b, err := funcs.IsBusinessDay("29/06/2026", "ROMA", "02/01/2006")
+	require.NoError(t, err)
+	require.False(t, b)
+}
+
+func TestBusinessDays(t *testing.T) {
+	arr := []struct {
+		fn       string
+		date     string
+		n        float64
+		calendar string
+		expected string
+	}{
+		{fn: "add", date: "2025-04-17", n: 1, calendar: funcs.CalendarItaly, expected: "2025-04-18"},
+		{fn: "add", date: "2025-04-17", n: 1, calendar: funcs.CalendarTarget2, expected: "2025-04-22"},
+		{fn: "add", date: "2025-04-24", n: 1, calendar: funcs.CalendarItaly, expected: "2025-04-28"},
+		{fn: "add", date: "2025-04-22", n: -1, calendar: funcs.CalendarTarget2, expected: "2025-04-17"},
+		{fn: "add", date: "2025-04-19", n: 0, calendar: funcs.CalendarItaly, expected: "2025-04-19"},
+		{fn: "next", date: "2025-12-31", calendar: funcs.CalendarTarget2, expected: "2026-01-02"},
+		{fn: "following", date: "2025-05-31", calendar: funcs.CalendarItaly, expected: "2025-06-03"},
+		{fn: "modified-following", date: "2025-05-31", calendar: funcs.CalendarItaly, expected: "2025-05-30"},
+		{fn: "modified-following", date: "2025-04-19", calendar: funcs.CalendarItaly, expected: "2025-04-22"},
+		{fn: "preceding", date: "2025-04-21", calendar: funcs.CalendarItaly, expected: "2025-04-18"},
+		{fn: "preceding", date: "2025-04-17", calendar: funcs.CalendarItaly, expected: "2025-04-17"},
+		{fn: "eom", date: "2024-02-10", expected: "2024-02-29"},
+		{fn: "last", date: "2025-05-10", calendar: funcs.CalendarItaly, expected: "2025-05-30"},
+	}
+
+	for i, input := range arr {
+		var s string
+		var err error
+		switch input.fn {
+		case "add":
+			s, err = funcs.AddBusinessDays(input.date, input.n, input.calendar)
+		case "next":
+			s, err = funcs.NextBusinessDay(input.date, input.calendar)
+		case "eom":
+			s, err = funcs.EndOfMonth(input.date)
+		case "last":
+			s, err = funcs.LastBusinessDayOfMonth(input.date, input.calendar)
+		default:
+			s, err = funcs.ValueDate(input.date, input.fn, input.calendar)
+		}
+
+		require.NoError(t, err, "[%d] error", i)
+		require.Equal(t, input.expected, s, "[%d] %s of %s", i, input.fn, input.date)
+	}
+
+	s, err := funcs.AddBusinessDays("20251224", 2, funcs.CalendarItaly, "20060102")
+	require.NoError(t, err)
+	require.Equal(t, "20251230", s)
+
+	n, err := funcs.BusinessDaysBetween("2025-04-17", "2025-04-22", funcs.CalendarTarget2)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	n, err = funcs.BusinessDaysBetween("2025-04-22", "2025-04-17", funcs.CalendarItaly)
+	require.NoError(t, err)
+	require.Equal(t, -2, n)
+
+	_, err = funcs.ValueDate("2025-04-19", "nearest", funcs.CalendarItaly)
+	require.Error(t, err)
+}
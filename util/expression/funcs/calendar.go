@@ -0,0 +1,162 @@
+package funcs
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CalendarItaly   = "IT"
+	CalendarTarget2 = "TARGET2"
+	CalendarWeekend = "WEEKEND"
+)
+
+// HolidayCalendar tells the holidays of a market. Weekends are handled separately by the business-day functions.
+type HolidayCalendar interface {
+	Name() string
+	IsHoliday(t time.Time) bool
+}
+
+type MonthDay struct {
+	Month time.Month
+	Day   int
+	// FromYear, when set, is the first year the holiday applies.
+	FromYear int
+}
+
+// RuleCalendar is a calendar made of yearly recurring dates, days relative to Easter Sunday and single dates.
+type RuleCalendar struct {
+	CalendarName  string
+	Fixed         []MonthDay
+	EasterOffsets []int
+	dates         map[string]struct{}
+}
+
+func (c *RuleCalendar) Name() string {
+	return c.CalendarName
+}
+
+// AddDates adds one-off holidays such as the closing days of a year.
+func (c *RuleCalendar) AddDates(dates ...time.Time) {
+	if c.dates == nil {
+		c.dates = make(map[string]struct{})
+	}
+
+	for _, d := range dates {
+		c.dates[d.Format("2006-01-02")] = struct{}{}
+	}
+}
+
+func (c *RuleCalendar) IsHoliday(t time.Time) bool {
+	for _, md := range c.Fixed {
+		if t.Month() == md.Month && t.Day() == md.Day && t.Year() >= md.FromYear {
+			return true
+		}
+	}
+
+	if len(c.EasterOffsets) > 0 {
+		y, m, d := t.Date()
+		day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+		easter := EasterSunday(y)
+		for _, offset := range c.EasterOffsets {
+			if day.Equal(easter.AddDate(0, 0, offset)) {
+				return true
+			}
+		}
+	}
+
+	if _, ok := c.dates[t.Format("2006-01-02")]; ok {
+		return true
+	}
+
+	return false
+}
+
+// EasterSunday computes the date of Easter in the Gregorian calendar (anonymous Gregorian algorithm). The time is midnight UTC.
+func EasterSunday(year int) time.Time {
+	a := year % 19
+	b := year / 100
+	c := year % 100
+	d := b / 4
+	e := b % 4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i := c / 4
+	k := c % 4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
+
+// NewItalianCalendar returns the Italian national holidays, Easter Monday included. Patron saints days are local and not part of it.
+func NewItalianCalendar() *RuleCalendar {
+	return &RuleCalendar{
+		CalendarName: CalendarItaly,
+		Fixed: []MonthDay{
+			{Month: time.January, Day: 1},
+			{Month: time.January, Day: 6},
+			{Month: time.April, Day: 25},
+			{Month: time.May, Day: 1},
+			{Month: time.June, Day: 2},
+			{Month: time.August, Day: 15},
+			{Month: time.October, Day: 4, FromYear: 2026},
+			{Month: time.November, Day: 1},
+			{Month: time.December, Day: 8},
+			{Month: time.December, Day: 25},
+			{Month: time.December, Day: 26},
+		},
+		EasterOffsets: []int{1},
+	}
+}
+
+// NewTarget2Calendar returns the closing days of the TARGET2 payment system: New Year's Day, Good Friday, Easter Monday, Labour Day, Christmas and Boxing Day.
+func NewTarget2Calendar() *RuleCalendar {
+	return &RuleCalendar{
+		CalendarName: CalendarTarget2,
+		Fixed: []MonthDay{
+			{Month: time.January, Day: 1},
+			{Month: time.May, Day: 1},
+			{Month: time.December, Day: 25},
+			{Month: time.December, Day: 26},
+		},
+		EasterOffsets: []int{-2, 1},
+	}
+}
+
+var calendars = struct {
+	mu   sync.RWMutex
+	cals map[string]HolidayCalendar
+}{
+	cals: map[string]HolidayCalendar{
+		CalendarItaly:   NewItalianCalendar(),
+		CalendarTarget2: NewTarget2Calendar(),
+		CalendarWeekend: &RuleCalendar{CalendarName: CalendarWeekend},
+	},
+}
+
+// RegisterCalendar makes a calendar available to the business-day builtins under its name. Names are case-insensitive.
+func RegisterCalendar(c HolidayCalendar) {
+	calendars.mu.Lock()
+	defer calendars.mu.Unlock()
+	calendars.cals[strings.ToUpper(c.Name())] = c
+}
+
+// LookupCalendar finds a registered calendar. The empty name is the WEEKEND calendar, the one without holidays.
+func LookupCalendar(name string) (HolidayCalendar, error) {
+	if name == "" {
+		name = CalendarWeekend
+	}
+
+	calendars.mu.RLock()
+	defer calendars.mu.RUnlock()
+	if c, ok := calendars.cals[strings.ToUpper(name)]; ok {
+		return c, nil
+	}
+
+	return nil, fmt.Errorf("holiday calendar %s not registered", name)
+}
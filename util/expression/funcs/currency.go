@@ -0,0 +1,326 @@
+package funcs
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/rs/zerolog/log"
+)
+
+type currencyInfo struct {
+	code       string
+	minorUnits int
+	symbol     string
+}
+
+// currencies is an excerpt of the ISO 4217 table with the number of digits of the minor unit of each currency.
+var currencies = map[string]currencyInfo{
+	"EUR": {code: "EUR", minorUnits: 2, symbol: "€"},
+	"USD": {code: "USD", minorUnits: 2, symbol: "$"},
+	"GBP": {code: "GBP", minorUnits: 2, symbol: "£"},
+	"CHF": {code: "CHF", minorUnits: 2},
+	"JPY": {code: "JPY", minorUnits: 0, symbol: "¥"},
+	"CNY": {code: "CNY", minorUnits: 2},
+	"CAD": {code: "CAD", minorUnits: 2},
+	"AUD": {code: "AUD", minorUnits: 2},
+	"SEK": {code: "SEK", minorUnits: 2},
+	"NOK": {code: "NOK", minorUnits: 2},
+	"DKK": {code: "DKK", minorUnits: 2},
+	"PLN": {code: "PLN", minorUnits: 2},
+	"CZK": {code: "CZK", minorUnits: 2},
+	"HUF": {code: "HUF", minorUnits: 2},
+	"RON": {code: "RON", minorUnits: 2},
+	"BGN": {code: "BGN", minorUnits: 2},
+	"RSD": {code: "RSD", minorUnits: 2},
+	"ALL": {code: "ALL", minorUnits: 2},
+	"TRY": {code: "TRY", minorUnits: 2},
+	"BRL": {code: "BRL", minorUnits: 2},
+	"MXN": {code: "MXN", minorUnits: 2},
+	"INR": {code: "INR", minorUnits: 2, symbol: "₹"},
+	"KRW": {code: "KRW", minorUnits: 0},
+	"ISK": {code: "ISK", minorUnits: 0},
+	"CLP": {code: "CLP", minorUnits: 0},
+	"BHD": {code: "BHD", minorUnits: 3},
+	"JOD": {code: "JOD", minorUnits: 3},
+	"KWD": {code: "KWD", minorUnits: 3},
+	"OMR": {code: "OMR", minorUnits: 3},
+	"TND": {code: "TND", minorUnits: 3},
+}
+
+type amountLocale struct {
+	groupSep    string
+	decimalSep  string
+	symbolFirst bool
+	symbolSpace bool
+	useCode     bool
+}
+
+// amountLocales are the supported formatting conventions. The empty locale is the neutral one: no grouping, the dot as decimal separator
+// and the ISO code in front of the number, as in EUR 1234.56.
+var amountLocales = map[string]amountLocale{
+	"":      {decimalSep: ".", symbolFirst: true, symbolSpace: true, useCode: true},
+	"it-it": {groupSep: ".", decimalSep: ",", symbolSpace: true},
+	"de-de": {groupSep: ".", decimalSep: ",", symbolSpace: true},
+	"en-us": {groupSep: ",", decimalSep: ".", symbolFirst: true},
+	"en-gb": {groupSep: ",", decimalSep: ".", symbolFirst: true},
+}
+
+func lookupAmountLocale(locale string) (amountLocale, error) {
+	n := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+	switch n {
+	case "it":
+		n = "it-it"
+	case "de":
+		n = "de-de"
+	case "en":
+		n = "en-us"
+	}
+
+	if loc, ok := amountLocales[n]; ok {
+		return loc, nil
+	}
+
+	return amountLocale{}, fmt.Errorf("amount locale %s not supported", locale)
+}
+
+func lookupCurrency(currency string) (currencyInfo, error) {
+	if c, ok := currencies[strings.ToUpper(strings.TrimSpace(currency))]; ok {
+		return c, nil
+	}
+
+	return currencyInfo{}, fmt.Errorf("currency %s not supported", currency)
+}
+
+// FormatAmount formats an amount expressed in unit (cent, mill, decimal-2 and so on) with the separators of the locale and the number of decimals
+// of the currency. The amount is rounded half-up to the minor unit of the currency. With an empty currency the amount gets two decimals and no symbol.
+// FormatAmount("123456", "cent", "it-IT", "EUR") is 1.234,56 €, FormatAmount("123456", "cent", "", "EUR") is EUR 1234.56.
+func FormatAmount(amt interface{}, unit string, locale string, currency string) (string, error) {
+	const semLogContext = "funcs::format-amount"
+
+	s, err := formatAmount(amt, unit, locale, currency)
+	if err != nil {
+		log.Error().Err(err).Interface("amount", amt).Str("unit", unit).Str("locale", locale).Str("currency", currency).Msg(semLogContext)
+		return "", err
+	}
+
+	return s, nil
+}
+
+func formatAmount(amt interface{}, unit string, locale string, currency string) (string, error) {
+	loc, err := lookupAmountLocale(locale)
+	if err != nil {
+		return "", err
+	}
+
+	cur := currencyInfo{minorUnits: 2}
+	if currency != "" {
+		cur, err = lookupCurrency(currency)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	r, unit, err := evaluateDecimal(amt, unit)
+	if err != nil {
+		return "", err
+	}
+
+	scale, err := unitScale(unit)
+	if err != nil {
+		return "", err
+	}
+
+	r.Mul(r, pow10Rat(cur.minorUnits))
+	r.Quo(r, pow10Rat(scale))
+	v, err := roundAmount(r, RoundingHalfUp)
+	if err != nil {
+		return "", err
+	}
+
+	digits := strconv.FormatInt(v, 10)
+	sign := ""
+	if strings.HasPrefix(digits, "-") {
+		sign = "-"
+		digits = digits[1:]
+	}
+
+	if len(digits) <= cur.minorUnits {
+		digits = strings.Repeat("0", cur.minorUnits-len(digits)+1) + digits
+	}
+
+	num := groupDigits(digits[:len(digits)-cur.minorUnits], loc.groupSep)
+	if cur.minorUnits > 0 {
+		num += loc.decimalSep + digits[len(digits)-cur.minorUnits:]
+	}
+
+	if cur.code == "" {
+		return sign + num, nil
+	}
+
+	symbol, space := cur.symbol, loc.symbolSpace
+	if symbol == "" || loc.useCode {
+		symbol, space = cur.code, true
+	}
+
+	sep := ""
+	if space {
+		sep = " "
+	}
+
+	if loc.symbolFirst {
+		return sign + symbol + sep + num, nil
+	}
+
+	return sign + num + sep + symbol, nil
+}
+
+func groupDigits(s string, sep string) string {
+	if sep == "" || len(s) <= 3 {
+		return s
+	}
+
+	var sb strings.Builder
+	head := len(s) % 3
+	if head > 0 {
+		sb.WriteString(s[:head])
+	}
+
+	for i := head; i < len(s); i += 3 {
+		if sb.Len() > 0 {
+			sb.WriteString(sep)
+		}
+		sb.WriteString(s[i : i+3])
+	}
+
+	return sb.String()
+}
+
+// ParseAmount parses an amount written with the separators of the locale and returns it in cents. The text can carry a currency
+// code or symbol before or after the number: 1.234,56 €, € 1.234,56 and EUR 1234,56 are all 123456 cents for the it-IT locale.
+// Digits beyond the cents are rounded half-up.
+func ParseAmount(text string, locale string) (string, error) {
+	const semLogContext = "funcs::parse-amount"
+
+	v, err := parseAmount(text, locale)
+	if err != nil {
+		log.Error().Err(err).Str("text", text).Str("locale", locale).Msg(semLogContext)
+		return "0", err
+	}
+
+	return strconv.FormatInt(v, 10), nil
+}
+
+func parseAmount(text string, locale string) (int64, error) {
+	loc, err := lookupAmountLocale(locale)
+	if err != nil {
+		return 0, err
+	}
+
+	var prefix, suffix, body strings.Builder
+	neg := false
+	for _, c := range strings.TrimSpace(text) {
+		switch {
+		case unicode.IsDigit(c) || strings.ContainsRune(loc.groupSep+loc.decimalSep, c):
+			if suffix.Len() > 0 {
+				return 0, fmt.Errorf("invalid amount: %q", text)
+			}
+			body.WriteRune(c)
+		case c == '-' || c == '+':
+			if body.Len() > 0 || neg {
+				return 0, fmt.Errorf("invalid amount: %q", text)
+			}
+			neg = c == '-'
+		case unicode.IsSpace(c):
+			if body.Len() > 0 {
+				suffix.WriteRune(' ')
+			}
+		default:
+			if body.Len() > 0 {
+				suffix.WriteRune(c)
+			} else {
+				prefix.WriteRune(c)
+			}
+		}
+	}
+
+	if err := checkCurrencyAffix(prefix.String()); err != nil {
+		return 0, err
+	}
+	if err := checkCurrencyAffix(suffix.String()); err != nil {
+		return 0, err
+	}
+
+	num, err := normalizeAmountText(body.String(), loc)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q: %w", text, err)
+	}
+
+	r, err := parseDecimal(num)
+	if err != nil {
+		return 0, err
+	}
+
+	if neg {
+		r.Neg(r)
+	}
+
+	return roundAmount(new(big.Rat).Mul(r, pow10Rat(2)), RoundingHalfUp)
+}
+
+func checkCurrencyAffix(s string) error {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+
+	if _, err := lookupCurrency(s); err == nil {
+		return nil
+	}
+
+	for _, c := range currencies {
+		if c.symbol != "" && c.symbol == s {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown currency %q", s)
+}
+
+// normalizeAmountText checks the grouping of the integer part and returns the number with the dot as decimal separator.
+func normalizeAmountText(s string, loc amountLocale) (string, error) {
+	if s == "" {
+		return "", errors.New("no digits")
+	}
+
+	intPart, fracPart := s, ""
+	if ndx := strings.Index(s, loc.decimalSep); ndx >= 0 {
+		intPart, fracPart = s[:ndx], s[ndx+len(loc.decimalSep):]
+		if fracPart == "" || strings.Contains(fracPart, loc.decimalSep) || (loc.groupSep != "" && strings.Contains(fracPart, loc.groupSep)) {
+			return "", errors.New("misplaced decimal separator")
+		}
+	}
+
+	if loc.groupSep != "" && strings.Contains(intPart, loc.groupSep) {
+		groups := strings.Split(intPart, loc.groupSep)
+		for i, g := range groups {
+			if (i == 0 && (len(g) == 0 || len(g) > 3)) || (i > 0 && len(g) != 3) {
+				return "", errors.New("misplaced group separator")
+			}
+		}
+		intPart = strings.Join(groups, "")
+	}
+
+	if intPart == "" {
+		intPart = "0"
+	}
+
+	if fracPart == "" {
+		return intPart, nil
+	}
+
+	return intPart + "." + fracPart, nil
+}
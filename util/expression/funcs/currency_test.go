@@ -0,0 +1,78 @@
+package funcs_test
+
+import (
+	"testing"
+
+	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/expression/funcs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatAmount(t *testing.T) {
+	arr := []struct {
+		amt      interface{}
+		unit     string
+		locale   string
+		currency string
+		expected string
+		wantErr  bool
+	}{
+		{amt: "123456", unit: funcs.Cent, locale: "it-IT", currency: "EUR", expected: "1.234,56 €"},
+		{amt: "123456", unit: funcs.Cent, locale: "", currency: "EUR", expected: "EUR 1234.56"},
+		{amt: "123456", unit: funcs.Cent, locale: "en-US", currency: "USD", expected: "$1,234.56"},
+		{amt: "123456", unit: funcs.Cent, locale: "en_US", currency: "CHF", expected: "CHF 1,234.56"},
+		{amt: "-5", unit: funcs.Cent, locale: "it-IT", currency: "EUR", expected: "-0,05 €"},
+		{amt: "123456789", unit: funcs.Cent, locale: "it-IT", currency: "", expected: "1.234.567,89"},
+		{amt: "1234.565", unit: funcs.DecimalMillis, locale: "it-IT", currency: "EUR", expected: "1.234,57 €"},
+		{amt: "123456", unit: funcs.Cent, locale: "it-IT", currency: "JPY", expected: "1.235 ¥"},
+		{amt: "123456", unit: funcs.Mill, locale: "en-US", currency: "KWD", expected: "KWD 123.456"},
+		{amt: 100.0, unit: funcs.Cent, locale: "it-IT", currency: "EUR", expected: "1,00 €"},
+		{amt: "100", unit: funcs.Cent, locale: "fr-CA", currency: "EUR", wantErr: true},
+		{amt: "100", unit: funcs.Cent, locale: "it-IT", currency: "XYZ", wantErr: true},
+	}
+
+	for i, input := range arr {
+		s, err := funcs.FormatAmount(input.amt, input.unit, input.locale, input.currency)
+		if input.wantErr {
+			require.Error(t, err, "[%d] expected error", i)
+			continue
+		}
+
+		require.NoError(t, err, "[%d] error", i)
+		require.Equal(t, input.expected, s, "[%d] expected doesn't match actual", i)
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	arr := []struct {
+		text     string
+		locale   string
+		expected string
+		wantErr  bool
+	}{
+		{text: "1.234,56 €", locale: "it-IT", expected: "123456"},
+		{text: "€ 1.234,56", locale: "it-IT", expected: "123456"},
+		{text: "EUR 1234,56", locale: "it-IT", expected: "123456"},
+		{text: "-1.234.567", locale: "it-IT", expected: "-123456700"},
+		{text: "12,345", locale: "it-IT", expected: "1235"},
+		{text: "$1,234.56", locale: "en-US", expected: "123456"},
+		{text: "-$0.5", locale: "en-US", expected: "-50"},
+		{text: "1234.56 USD", locale: "en-US", expected: "123456"},
+		{text: "EUR 1234.56", locale: "", expected: "123456"},
+		{text: "1.23.456,00", locale: "it-IT", wantErr: true},
+		{text: "1,234.56", locale: "it-IT", wantErr: true},
+		{text: "12 34", locale: "it-IT", wantErr: true},
+		{text: "ABC 12", locale: "it-IT", wantErr: true},
+		{text: "€", locale: "it-IT", wantErr: true},
+	}
+
+	for i, input := range arr {
+		s, err := funcs.ParseAmount(input.text, input.locale)
+		if input.wantErr {
+			require.Error(t, err, "[%d] expected error", i)
+			continue
+		}
+
+		require.NoError(t, err, "[%d] error", i)
+		require.Equal(t, input.expected, s, "[%d] expected doesn't match actual", i)
+	}
+}
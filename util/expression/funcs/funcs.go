@@ -31,11 +31,24 @@ func Builtins() map[string]interface{} {
 	builtins["parseDate"] = ParseDate
 	builtins["parseAndFormatDate"] = ParseAndFmtDate
 	builtins["dateDiff"] = DateDiff
+	builtins["addBusinessDays"] = AddBusinessDays
+	builtins["isBusinessDay"] = IsBusinessDay
+	builtins["nextBusinessDay"] = NextBusinessDay
+	builtins["businessDaysBetween"] = BusinessDaysBetween
+	builtins["valueDate"] = ValueDate
+	builtins["endOfMonth"] = EndOfMonth
+	builtins["lastBusinessDayOfMonth"] = LastBusinessDayOfMonth
 	builtins["printf"] = Printf
 	builtins["amtConv"] = AmtConv
 	builtins["amtCmp"] = AmtCmp
 	builtins["amtAdd"] = AmtAdd
 	builtins["amtDiff"] = AmtDiff
+	builtins["amtMul"] = AmtMul
+	builtins["amtDiv"] = AmtDiv
+	builtins["amtPct"] = AmtPct
+	builtins["amtRound"] = AmtRound
+	builtins["formatAmount"] = FormatAmount
+	builtins["parseAmount"] = ParseAmount
 	builtins["padLeft"] = PadLeft
 	builtins["left"] = Left
 	builtins["right"] = Right
@@ -0,0 +1,100 @@
+package expression
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// GlobalVars is a concurrency safe store of the variables referenced by the g: prefix. The values are meant to be shared constants
+// set at bootstrap and read by many contexts.
+type GlobalVars struct {
+	mu   sync.RWMutex
+	vars map[string]interface{}
+}
+
+var defaultGlobalVars = NewGlobalVars()
+
+// DefaultGlobalVars returns the process-wide store.
+func DefaultGlobalVars() *GlobalVars {
+	return defaultGlobalVars
+}
+
+func NewGlobalVars() *GlobalVars {
+	return &GlobalVars{vars: make(map[string]interface{})}
+}
+
+func (g *GlobalVars) Set(n string, v interface{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.vars[n] = v
+}
+
+func (g *GlobalVars) SetAll(m map[string]interface{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for n, v := range m {
+		g.vars[n] = v
+	}
+}
+
+func (g *GlobalVars) Get(n string) (interface{}, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	v, ok := g.vars[n]
+	return v, ok
+}
+
+func (g *GlobalVars) Delete(n string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.vars, n)
+}
+
+// LoadYaml sets the variables found in a yaml map. If resolveEnv the ${ENV_VAR} references in the content are resolved beforehand.
+func (g *GlobalVars) LoadYaml(b []byte, resolveEnv bool) error {
+	const semLogContext = "expression-global-vars::load-yaml"
+
+	if resolveEnv {
+		b = util.ResolveConfigValueToByteArray(b)
+	}
+
+	m := make(map[string]interface{})
+	err := yaml.Unmarshal(b, &m)
+	if err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+		return err
+	}
+
+	g.SetAll(m)
+	return nil
+}
+
+// LoadEnv sets a variable for each environment variable with the given prefix. The name of the variable is the name of the
+// environment variable without the prefix: with the prefix GLOBAL_ the env var GLOBAL_BANK_ABI sets the g:BANK_ABI variable.
+func (g *GlobalVars) LoadEnv(prefix string) int {
+	const semLogContext = "expression-global-vars::load-env"
+
+	numVars := 0
+	for _, v := range os.Environ() {
+		ndx := strings.Index(v, "=")
+		if ndx <= 0 || !strings.HasPrefix(v[:ndx], prefix) {
+			continue
+		}
+
+		n := strings.TrimPrefix(v[:ndx], prefix)
+		if n == "" {
+			continue
+		}
+
+		g.Set(n, v[ndx+1:])
+		numVars++
+	}
+
+	log.Trace().Str("prefix", prefix).Int("number-of-vars", numVars).Msg(semLogContext)
+	return numVars
+}
@@ -0,0 +1,81 @@
+package expression_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/expression"
+	"github.com/stretchr/testify/require"
+)
+
+var globalsYaml = []byte(`
+bank-abi: "03069"
+platform-id: ${GLOBALS_TEST_PLATFORM}
+limits:
+  max-amount: 1000
+`)
+
+func TestGlobalVars(t *testing.T) {
+	t.Setenv("GLOBALS_TEST_PLATFORM", "TPM")
+	t.Setenv("GTEST_CHANNEL", "APPP")
+
+	g := expression.NewGlobalVars()
+	err := g.LoadYaml(globalsYaml, true)
+	require.NoError(t, err)
+
+	n := g.LoadEnv("GTEST_")
+	require.Equal(t, 1, n)
+
+	g.Set("seq", 7)
+
+	exprCtx, err := expression.NewContext(expression.WithGlobalVars(g))
+	require.NoError(t, err)
+
+	arr := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{expr: `{g:bank-abi}`, expected: "03069"},
+		{expr: `{g:platform-id}-{g:CHANNEL}`, expected: "TPM-APPP"},
+		{expr: `{g:seq,03d}`, expected: "007"},
+		{expr: `{g:bank-abi,len=-8,pad=0}`, expected: "00003069"},
+		{expr: `"{g:platform-id}" == "TPM"`, expected: true},
+		{expr: `{g:not-present}`, expected: ""},
+	}
+
+	for i, input := range arr {
+		v, err := exprCtx.EvalOne(input.expr)
+		require.NoError(t, err, "[%d] error", i)
+		require.EqualValues(t, input.expected, v, "[%d] Expected doesn't match actual", i)
+	}
+
+	// Without a registered store the references resolve to empty values.
+	exprCtx, err = expression.NewContext()
+	require.NoError(t, err)
+	v, err := exprCtx.EvalOne(`{g:bank-abi}`)
+	require.NoError(t, err)
+	require.EqualValues(t, "", v)
+}
+
+func TestGlobalVarsConcurrency(t *testing.T) {
+	g := expression.DefaultGlobalVars()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			g.Set("counter", i)
+		}(i)
+		go func() {
+			defer wg.Done()
+			exprCtx, _ := expression.NewContext(expression.WithGlobalVars(g))
+			_, _ = exprCtx.EvalOne(`{g:counter}`)
+		}()
+	}
+	wg.Wait()
+
+	_, ok := g.Get("counter")
+	require.True(t, ok)
+	g.Delete("counter")
+}
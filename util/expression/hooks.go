@@ -0,0 +1,156 @@
+package expression
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// callHook intercepts the function calls of an evaluation to honor the cancellation of the context, enforce the limits and record the trace.
+type callHook struct {
+	trace  *Trace
+	limits Limits
+	err    error
+}
+
+// newCallHook returns nil when there is nothing to intercept and the functions can be called directly.
+func (pvr *Context) newCallHook(ctx context.Context) *callHook {
+	if pvr.trace == nil && pvr.limits.IsZero() && ctx.Done() == nil {
+		return nil
+	}
+	return &callHook{trace: pvr.trace, limits: pvr.limits}
+}
+
+// gvalParams are the parameters of the gval evaluation of the text.
+func (pvr *Context) gvalParams(h *callHook) interface{} {
+	if h == nil {
+		return pvr.vars
+	}
+	return &hookedParams{vars: pvr.vars, hook: h}
+}
+
+type hookedParams struct {
+	vars   map[string]interface{}
+	hook   *callHook
+	prefix string
+}
+
+func (p *hookedParams) SelectGVal(c context.Context, k string) (interface{}, error) {
+	if err := c.Err(); err != nil {
+		return nil, err
+	}
+	return p.hook.wrap(c, p.prefix+k, p.vars[k]), nil
+}
+
+// fail records the first error raised by the hook and aborts the call. The panic is recovered by gval and turned into an evaluation error.
+func (h *callHook) fail(err error) {
+	if h.err == nil {
+		h.err = err
+	}
+	panic(err)
+}
+
+// wrap returns a function that goes through the hook in place of a function, and a selector in place of a namespace of functions.
+func (h *callHook) wrap(c context.Context, name string, v interface{}) interface{} {
+
+	switch tv := v.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		for _, item := range tv {
+			if reflect.TypeOf(item) != nil && reflect.TypeOf(item).Kind() == reflect.Func {
+				return &hookedParams{vars: tv, hook: h, prefix: name + "."}
+			}
+		}
+		return v
+	}
+
+	fv := reflect.ValueOf(v)
+	if fv.Kind() != reflect.Func {
+		return v
+	}
+
+	ft := fv.Type()
+	return reflect.MakeFunc(ft, func(args []reflect.Value) []reflect.Value {
+		if err := c.Err(); err != nil {
+			h.fail(err)
+		}
+
+		if ndx, ok := regexFunctions[name]; ok && ndx < len(args) && args[ndx].Kind() == reflect.String {
+			if err := h.limits.checkRegex(args[ndx].String()); err != nil {
+				h.fail(err)
+			}
+		}
+
+		call := TraceCall{Function: name}
+		if h.trace != nil {
+			for n, a := range args {
+				if ft.IsVariadic() && n == len(args)-1 {
+					for i := 0; i < a.Len(); i++ {
+						call.Args = append(call.Args, a.Index(i).Interface())
+					}
+					continue
+				}
+				call.Args = append(call.Args, a.Interface())
+			}
+		}
+
+		start := time.Now()
+		var out []reflect.Value
+		if ft.IsVariadic() {
+			out = fv.CallSlice(args)
+		} else {
+			out = fv.Call(args)
+		}
+		call.Elapsed = time.Since(start)
+
+		var results []interface{}
+		for i, o := range out {
+			if i == len(out)-1 && ft.Out(i).Implements(errorInterface) {
+				if !o.IsNil() {
+					call.Error = o.Interface().(error).Error()
+				}
+				continue
+			}
+			results = append(results, o.Interface())
+		}
+
+		switch len(results) {
+		case 0:
+		case 1:
+			call.Result = results[0]
+		default:
+			call.Result = results
+		}
+
+		if h.trace != nil {
+			h.trace.Calls = append(h.trace.Calls, call)
+		}
+
+		for _, r := range results {
+			if err := h.limits.checkOutput(r); err != nil {
+				h.fail(err)
+			}
+		}
+
+		return out
+	}).Interface()
+}
+
+// evalErr returns the error to report for an evaluation: the cancellation of the context and the violations of the limits take precedence
+// over the errors gval built from them.
+func (h *callHook) evalErr(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+
+	if h != nil && h.err != nil {
+		return h.err
+	}
+
+	return err
+}
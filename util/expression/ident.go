@@ -0,0 +1,155 @@
+package expression
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"text/scanner"
+
+	"github.com/PaesslerAG/gval"
+)
+
+// compiledLanguage is the gval full language with the identifiers parsed by parseIdent.
+// The gval default implementation cannot call a function with a nil argument: in typed mode a missing value is a nil and
+// something like isDef({$.not-present}) has to work.
+var compiledLanguage = gval.Full(gval.PrefixMetaPrefix(scanner.Ident, parseIdent))
+
+var errorInterface = reflect.TypeOf((*error)(nil)).Elem()
+var emptyInterface = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// parseIdent mirrors the gval one: variables with dotted and bracket selectors and function calls.
+func parseIdent(c context.Context, p *gval.Parser) (call string, alternative func() (gval.Evaluable, error), err error) {
+	token := p.TokenText()
+	return token,
+		func() (gval.Evaluable, error) {
+			fullname := token
+
+			keys := []gval.Evaluable{p.Const(token)}
+			for {
+				switch p.Scan() {
+				case '.':
+					switch p.Scan() {
+					case scanner.Ident:
+						keys = append(keys, p.Const(p.TokenText()))
+					default:
+						return nil, p.Expected("field", scanner.Ident)
+					}
+				case '(':
+					args, err := parseArguments(c, p)
+					if err != nil {
+						return nil, err
+					}
+					return callFunction(fullname, p.Var(keys...), args...), nil
+				case '[':
+					key, err := p.ParseExpression(c)
+					if err != nil {
+						return nil, err
+					}
+					switch p.Scan() {
+					case ']':
+						keys = append(keys, key)
+					default:
+						return nil, p.Expected("array key", ']')
+					}
+				default:
+					p.Camouflage("variable", '.', '(', '[')
+					return p.Var(keys...), nil
+				}
+			}
+		}, nil
+}
+
+func parseArguments(c context.Context, p *gval.Parser) ([]gval.Evaluable, error) {
+	var args []gval.Evaluable
+	if p.Scan() == ')' {
+		return args, nil
+	}
+
+	p.Camouflage("scan arguments", ')')
+	for {
+		arg, err := p.ParseExpression(c)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+
+		switch p.Scan() {
+		case ')':
+			return args, nil
+		case ',':
+		default:
+			return nil, p.Expected("arguments", ')', ',')
+		}
+	}
+}
+
+// callFunction calls the function found in the parameters. Nil arguments are passed as the zero value of the parameter type.
+func callFunction(fullname string, fun gval.Evaluable, args ...gval.Evaluable) gval.Evaluable {
+	return func(c context.Context, v interface{}) (ret interface{}, err error) {
+		f, err := fun(c, v)
+		if err != nil {
+			return nil, fmt.Errorf("could not call function: %w", err)
+		}
+
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("failed to execute function '%s': %s", fullname, r)
+				ret = nil
+			}
+		}()
+
+		ff := reflect.ValueOf(f)
+		if ff.Kind() != reflect.Func {
+			return nil, fmt.Errorf("could not call '%s' type %T", fullname, f)
+		}
+
+		ft := ff.Type()
+		a := make([]reflect.Value, len(args))
+		for i := range args {
+			arg, err := args[i](c, v)
+			if err != nil {
+				return nil, err
+			}
+
+			if arg == nil {
+				a[i] = reflect.Zero(argumentType(ft, i))
+			} else {
+				a[i] = reflect.ValueOf(arg)
+			}
+		}
+
+		rr := ff.Call(a)
+
+		r := make([]interface{}, len(rr))
+		for i, e := range rr {
+			r[i] = e.Interface()
+		}
+
+		if len(r) > 0 && ft.Out(len(r)-1).Implements(errorInterface) {
+			if r[len(r)-1] != nil {
+				err = r[len(r)-1].(error)
+			}
+			r = r[0 : len(r)-1]
+		}
+
+		switch len(r) {
+		case 0:
+			return err, nil
+		case 1:
+			return r[0], err
+		default:
+			return r, err
+		}
+	}
+}
+
+func argumentType(ft reflect.Type, i int) reflect.Type {
+	switch {
+	case ft.IsVariadic() && i >= ft.NumIn()-1:
+		return ft.In(ft.NumIn() - 1).Elem()
+	case i < ft.NumIn():
+		return ft.In(i)
+	default:
+		return emptyInterface
+	}
+}
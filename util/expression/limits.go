@@ -0,0 +1,131 @@
+package expression
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp/syntax"
+)
+
+var ErrLimitExceeded = errors.New("expression limit exceeded")
+
+// Limits bounds the resources an expression can use. Zero values mean no limit.
+type Limits struct {
+	MaxExpressionLength int `yaml:"max-expression-length,omitempty" mapstructure:"max-expression-length,omitempty" json:"max-expression-length,omitempty"`
+	MaxNestingDepth     int `yaml:"max-nesting-depth,omitempty" mapstructure:"max-nesting-depth,omitempty" json:"max-nesting-depth,omitempty"`
+	// MaxRegexComplexity is the maximum number of instructions of the compiled pattern of the regex functions.
+	MaxRegexComplexity int `yaml:"max-regex-complexity,omitempty" mapstructure:"max-regex-complexity,omitempty" json:"max-regex-complexity,omitempty"`
+	// MaxOutputLength is the maximum length of the strings returned by the functions and by the evaluation.
+	MaxOutputLength int `yaml:"max-output-length,omitempty" mapstructure:"max-output-length,omitempty" json:"max-output-length,omitempty"`
+}
+
+func (l Limits) IsZero() bool {
+	return l == Limits{}
+}
+
+func WithLimits(l Limits) Option {
+	return func(r *Context) error {
+		r.limits = l
+		return nil
+	}
+}
+
+// regexFunctions maps the functions taking a regex to the position of the pattern argument.
+var regexFunctions = map[string]int{
+	"regexMatch":         0,
+	"regexExtractFirst":  0,
+	"regex.match":        0,
+	"regex.extractFirst": 0,
+}
+
+// checkExpression verifies the expression before evaluating it.
+func (pvr *Context) checkExpression(ctx context.Context, expr string, depth int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if pvr.limits.MaxExpressionLength > 0 && len(expr) > pvr.limits.MaxExpressionLength {
+		return fmt.Errorf("%w: expression length %d greater than %d", ErrLimitExceeded, len(expr), pvr.limits.MaxExpressionLength)
+	}
+
+	if pvr.limits.MaxNestingDepth > 0 {
+		if depth < 0 {
+			depth = nestingDepth(expr)
+		}
+
+		if depth > pvr.limits.MaxNestingDepth {
+			return fmt.Errorf("%w: nesting depth %d greater than %d", ErrLimitExceeded, depth, pvr.limits.MaxNestingDepth)
+		}
+	}
+
+	return nil
+}
+
+func (l Limits) checkOutput(v interface{}) error {
+	if s, ok := v.(string); ok && l.MaxOutputLength > 0 && len(s) > l.MaxOutputLength {
+		return fmt.Errorf("%w: output length %d greater than %d", ErrLimitExceeded, len(s), l.MaxOutputLength)
+	}
+	return nil
+}
+
+func (l Limits) checkRegex(pattern string) error {
+	if l.MaxRegexComplexity <= 0 {
+		return nil
+	}
+
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		var serr *syntax.Error
+		if errors.As(err, &serr) && (serr.Code == syntax.ErrLarge || serr.Code == syntax.ErrNestingDepth) {
+			return fmt.Errorf("%w: regex %s: %v", ErrLimitExceeded, pattern, err)
+		}
+		// Left to the function to report.
+		return nil
+	}
+
+	prog, err := syntax.Compile(re.Simplify())
+	if err != nil {
+		return nil
+	}
+
+	if len(prog.Inst) > l.MaxRegexComplexity {
+		return fmt.Errorf("%w: regex %s complexity %d greater than %d", ErrLimitExceeded, pattern, len(prog.Inst), l.MaxRegexComplexity)
+	}
+
+	return nil
+}
+
+// nestingDepth is the maximum depth of the parentheses and brackets found outside string literals.
+func nestingDepth(expr string) int {
+	depth, maxDepth := 0, 0
+	var quote byte
+	var escaped bool
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		if quote != 0 {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\' && quote != '`':
+				escaped = true
+			case c == quote:
+				quote = 0
+			}
+			continue
+		}
+
+		switch c {
+		case '"', '\'', '`':
+			quote = c
+		case '(', '[':
+			depth++
+			if depth > maxDepth {
+				maxDepth = depth
+			}
+		case ')', ']':
+			depth--
+		}
+	}
+
+	return maxDepth
+}
@@ -0,0 +1,74 @@
+package expression_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/expression"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextLimits(t *testing.T) {
+
+	for _, typed := range []bool{false, true} {
+		exprCtx, err := expression.NewContext(
+			expression.WithJsonInput(j),
+			expression.WithTypedReferences(typed),
+			expression.WithFuncMap(map[string]interface{}{
+				"slow": func(s string) string {
+					time.Sleep(50 * time.Millisecond)
+					return s
+				},
+				"repeat": func(s string, n float64) string {
+					return strings.Repeat(s, int(n))
+				},
+			}),
+			expression.WithLimits(expression.Limits{
+				MaxExpressionLength: 128,
+				MaxNestingDepth:     3,
+				MaxRegexComplexity:  64,
+				MaxOutputLength:     16,
+			}))
+		require.NoError(t, err)
+
+		v, err := exprCtx.EvalOne(`left("{$.ordinante.codiceFiscale}", 6)`)
+		require.NoError(t, err)
+		require.Equal(t, "LPRSPM", v)
+
+		b, err := exprCtx.BoolEvalOne(`regexMatch("^[A-Z]{6}", "{$.ordinante.codiceFiscale}")`)
+		require.NoError(t, err)
+		require.True(t, b)
+
+		_, err = exprCtx.EvalOne(`"` + strings.Repeat("a", 130) + `" == "a"`)
+		require.True(t, errors.Is(err, expression.ErrLimitExceeded), err)
+
+		_, err = exprCtx.EvalOne(`len(left(right(left("abc", 2), 1), 1)) == 1`)
+		require.True(t, errors.Is(err, expression.ErrLimitExceeded), err)
+
+		_, err = exprCtx.BoolEvalOne(`regexMatch("(abc|def){10,20}", "abc")`)
+		require.True(t, errors.Is(err, expression.ErrLimitExceeded), err)
+
+		_, err = exprCtx.EvalOne(`repeat("abc", 10)`)
+		require.True(t, errors.Is(err, expression.ErrLimitExceeded), err)
+
+		_, err = exprCtx.EvalOne(`"abc" + repeat("d", 16)`)
+		require.True(t, errors.Is(err, expression.ErrLimitExceeded), err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = exprCtx.EvalOneCtx(ctx, `left("{$.ordinante.codiceFiscale}", 6)`)
+		require.True(t, errors.Is(err, context.Canceled), err)
+
+		ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err = exprCtx.BoolEvalOneCtx(ctx, `slow("a") == "a" && slow("b") == "b"`)
+		cancel()
+		require.True(t, errors.Is(err, context.DeadlineExceeded), err)
+
+		b, err = exprCtx.BoolEvalOneCtx(context.Background(), `slow("a") == "a"`)
+		require.NoError(t, err)
+		require.True(t, b)
+	}
+}
@@ -0,0 +1,139 @@
+package expression
+
+import (
+	"sort"
+
+	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/expression/funcs"
+)
+
+type builtinDoc struct {
+	name string
+	args []string
+	doc  string
+}
+
+// builtinDocs documents the funcs.Builtins in the order they appear in the reference.
+var builtinDocs = []builtinDoc{
+	{name: "isDef", args: []string{"value"}, doc: "True if the value is not nil."},
+	{name: "printf", args: []string{"format", "values"}, doc: "Formats the values as fmt.Sprintf."},
+	{name: "len", args: []string{"value"}, doc: "Length of the value text."},
+	{name: "left", args: []string{"value", "length"}, doc: "The first length characters of the value text."},
+	{name: "right", args: []string{"value", "length"}, doc: "The last length characters of the value text."},
+	{name: "substr", args: []string{"value", "start", "end"}, doc: "The characters of the value text from start to end excluded."},
+	{name: "padLeft", args: []string{"value", "length", "padChar"}, doc: "Pads the value text on the left with padChar up to length."},
+	{name: "_pad", args: []string{"value", "length"}, doc: "Pads the value text on the left with zeros up to length."},
+	{name: "stringIn", args: []string{"value", "csvList", "caseInsensitive"}, doc: "True if the value text is one of the items of the comma separated list."},
+	{name: "firstOf", args: []string{"csvList"}, doc: "The first item of the comma separated list."},
+	{name: "b64", args: []string{"text"}, doc: "Base64 encoding of the text."},
+	{name: "uuid", doc: "A random UUID."},
+	{name: "regexMatch", args: []string{"pattern", "value"}, doc: "True if the value matches the pattern."},
+	{name: "regexExtractFirst", args: []string{"pattern", "value"}, doc: "The first match of the pattern in the value."},
+	{name: "lenJsonArray", args: []string{"value"}, doc: "Length of a json array, 0 if the value is not an array."},
+	{name: "isJsonArray", args: []string{"value"}, doc: "True if the value is a json array."},
+	{name: "now", args: []string{"layout"}, doc: "Current time formatted with the Go layout."},
+	{name: "_nowAfter", args: []string{"duration", "layout"}, doc: "Current time plus the Go duration, formatted with the layout."},
+	{name: "age", args: []string{"date", "layouts"}, doc: "Years elapsed since the date, parsed with the first matching layout."},
+	{name: "isDate", args: []string{"value", "layouts"}, doc: "True if the value is a time or parses with one of the layouts."},
+	{name: "parseDate", args: []string{"value", "location", "layouts"}, doc: "Parses the value with the first matching layout in the location."},
+	{name: "parseAndFormatDate", args: []string{"value", "location", "targetLayout", "layouts"}, doc: "Parses the value with the first matching layout and formats it with targetLayout."},
+	{name: "dateDiff", args: []string{"date1", "date2", "unit", "layouts"}, doc: "date1 - date2 in days, hours, minutes or seconds."},
+	{name: "addBusinessDays", args: []string{"date", "n", "calendar", "layouts"}, doc: "Adds n business days of the calendar (IT, TARGET2, WEEKEND) to the date. Layouts default to 2006-01-02."},
+	{name: "isBusinessDay", args: []string{"date", "calendar", "layouts"}, doc: "True if the date is neither a weekend day nor a holiday of the calendar."},
+	{name: "nextBusinessDay", args: []string{"date", "calendar", "layouts"}, doc: "The first business day after the date."},
+	{name: "businessDaysBetween", args: []string{"date1", "date2", "calendar", "layouts"}, doc: "The business days after date1 up to date2 included, negative if date2 precedes date1."},
+	{name: "valueDate", args: []string{"date", "convention", "calendar", "layouts"}, doc: "Adjusts the date to a business day with the following, modified-following or preceding convention."},
+	{name: "endOfMonth", args: []string{"date", "layouts"}, doc: "The last day of the month of the date."},
+	{name: "lastBusinessDayOfMonth", args: []string{"date", "calendar", "layouts"}, doc: "The last business day of the month of the date."},
+	{name: "amtConv", args: []string{"sourceUnit", "targetUnit", "decimalFormat", "amount"}, doc: "Converts the amount between units (dime, cent, mill, deci-mill, micro, decimal-2, decimal-3), truncating."},
+	{name: "amtCmp", args: []string{"cmpUnit", "amount1", "amount1Unit", "amount2", "amount2Unit"}, doc: "True if amount1 is greater than amount2 once both are expressed in cmpUnit."},
+	{name: "amtAdd", args: []string{"sourceUnit", "targetUnit", "decimalFormat", "amounts"}, doc: "Sum of the amounts."},
+	{name: "amtDiff", args: []string{"sourceUnit", "targetUnit", "decimalFormat", "amounts"}, doc: "The first amount minus the other ones."},
+	{name: "amtMul", args: []string{"sourceUnit", "targetUnit", "decimalFormat", "amount", "rate", "rounding"}, doc: "Amount times rate, rounded down, half-up or half-even."},
+	{name: "amtDiv", args: []string{"sourceUnit", "targetUnit", "decimalFormat", "amount", "rate", "rounding"}, doc: "Amount divided by rate, rounded down, half-up or half-even."},
+	{name: "amtPct", args: []string{"sourceUnit", "targetUnit", "decimalFormat", "amount", "pct", "rounding"}, doc: "The pct percentage of the amount, rounded down, half-up or half-even."},
+	{name: "amtRound", args: []string{"sourceUnit", "targetUnit", "decimalFormat", "amount", "rounding"}, doc: "Converts the amount between units with the given rounding."},
+	{name: "formatAmount", args: []string{"amount", "unit", "locale", "currency"}, doc: "Formats the amount for the locale (it-IT, en-US, empty for EUR 1234.56) with the decimals of the ISO 4217 currency."},
+	{name: "parseAmount", args: []string{"text", "locale"}, doc: "Parses an amount written for the locale and returns it in cents."},
+}
+
+// builtinNamespaces are the namespaced aliases of the builtins: namespace -> alias -> builtin name.
+var builtinNamespaces = []struct {
+	namespace string
+	doc       string
+	aliases   [][2]string
+}{
+	{namespace: "str", doc: "String functions.", aliases: [][2]string{
+		{"len", "len"}, {"left", "left"}, {"right", "right"}, {"substr", "substr"}, {"padLeft", "padLeft"},
+		{"in", "stringIn"}, {"firstOf", "firstOf"}, {"printf", "printf"}, {"b64", "b64"},
+	}},
+	{namespace: "regex", doc: "Regular expression functions.", aliases: [][2]string{
+		{"match", "regexMatch"}, {"extractFirst", "regexExtractFirst"},
+	}},
+	{namespace: "json", doc: "Json values functions.", aliases: [][2]string{
+		{"lenArray", "lenJsonArray"}, {"isArray", "isJsonArray"},
+	}},
+	// date is a function of the gval language and cannot be used as a namespace.
+	{namespace: "dates", doc: "Date functions. Layouts are Go time layouts.", aliases: [][2]string{
+		{"now", "now"}, {"nowAfter", "_nowAfter"}, {"age", "age"}, {"isDate", "isDate"}, {"parse", "parseDate"},
+		{"format", "parseAndFormatDate"}, {"diff", "dateDiff"}, {"addBusinessDays", "addBusinessDays"}, {"isBusinessDay", "isBusinessDay"},
+		{"nextBusinessDay", "nextBusinessDay"}, {"businessDaysBetween", "businessDaysBetween"}, {"valueDate", "valueDate"},
+		{"endOfMonth", "endOfMonth"}, {"lastBusinessDayOfMonth", "lastBusinessDayOfMonth"},
+	}},
+	{namespace: "amt", doc: "Amount functions. Amounts are integers in the source unit or decimal texts in the decimal-2 and decimal-3 units.", aliases: [][2]string{
+		{"conv", "amtConv"}, {"cmp", "amtCmp"}, {"add", "amtAdd"}, {"diff", "amtDiff"}, {"mul", "amtMul"}, {"div", "amtDiv"},
+		{"pct", "amtPct"}, {"round", "amtRound"}, {"format", "formatAmount"}, {"parse", "parseAmount"},
+	}},
+}
+
+// newBuiltinsRegistry registers the builtins both by their global name and in the namespaced libraries.
+func newBuiltinsRegistry() *FunctionRegistry {
+
+	builtins := funcs.Builtins()
+	documented := make(map[string]Function)
+
+	root := Library{Doc: "The builtins available without namespace."}
+	for _, d := range builtinDocs {
+		fn, ok := builtins[d.name]
+		if !ok {
+			continue
+		}
+
+		f := Function{Name: d.name, Fn: fn, Doc: d.doc}
+		for _, a := range d.args {
+			f.Args = append(f.Args, FunctionArg{Name: a})
+		}
+
+		root.Functions = append(root.Functions, f)
+		documented[d.name] = f
+	}
+
+	var undocumented []string
+	for n := range builtins {
+		if _, ok := documented[n]; !ok {
+			undocumented = append(undocumented, n)
+		}
+	}
+
+	sort.Strings(undocumented)
+	for _, n := range undocumented {
+		root.Functions = append(root.Functions, Function{Name: n, Fn: builtins[n]})
+	}
+
+	r := NewFunctionRegistry()
+	r.MustRegister(root)
+
+	for _, ns := range builtinNamespaces {
+		lib := Library{Namespace: ns.namespace, Doc: ns.doc}
+		for _, a := range ns.aliases {
+			f, ok := documented[a[1]]
+			if !ok {
+				continue
+			}
+			f.Name = a[0]
+			lib.Functions = append(lib.Functions, f)
+		}
+		r.MustRegister(lib)
+	}
+
+	return r
+}
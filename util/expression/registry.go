@@ -0,0 +1,337 @@
+package expression
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+type FunctionArg struct {
+	Name string `yaml:"name,omitempty" mapstructure:"name,omitempty" json:"name,omitempty"`
+	Type string `yaml:"type,omitempty" mapstructure:"type,omitempty" json:"type,omitempty"`
+}
+
+// Function is a function callable from the expressions. Arity, argument types and return type are taken from the signature of Fn
+// when not provided; Args names are documentation only.
+type Function struct {
+	Name     string        `yaml:"name,omitempty" mapstructure:"name,omitempty" json:"name,omitempty"`
+	Fn       interface{}   `yaml:"-" mapstructure:"-" json:"-"`
+	Doc      string        `yaml:"doc,omitempty" mapstructure:"doc,omitempty" json:"doc,omitempty"`
+	Args     []FunctionArg `yaml:"args,omitempty" mapstructure:"args,omitempty" json:"args,omitempty"`
+	Returns  string        `yaml:"returns,omitempty" mapstructure:"returns,omitempty" json:"returns,omitempty"`
+	Variadic bool          `yaml:"variadic,omitempty" mapstructure:"variadic,omitempty" json:"variadic,omitempty"`
+}
+
+// Arity is the number of declared arguments. The variadic one, if any, is counted once.
+func (f Function) Arity() int {
+	return len(f.Args)
+}
+
+// Signature renders the function as in name(arg1 type, arg2 ...type) type.
+func (f Function) Signature(namespace string) string {
+	var sb strings.Builder
+	if namespace != "" {
+		sb.WriteString(namespace)
+		sb.WriteString(".")
+	}
+	sb.WriteString(f.Name)
+	sb.WriteString("(")
+	for i, a := range f.Args {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(a.Name)
+		sb.WriteString(" ")
+		if f.Variadic && i == len(f.Args)-1 {
+			sb.WriteString("...")
+		}
+		sb.WriteString(a.Type)
+	}
+	sb.WriteString(")")
+	if f.Returns != "" {
+		sb.WriteString(" ")
+		sb.WriteString(f.Returns)
+	}
+	return sb.String()
+}
+
+// Library is a set of functions registered under a namespace. The functions of the library with the empty namespace are called by their name,
+// the other ones by the namespace-qualified name: str.left(...).
+type Library struct {
+	Namespace string     `yaml:"namespace,omitempty" mapstructure:"namespace,omitempty" json:"namespace,omitempty"`
+	Doc       string     `yaml:"doc,omitempty" mapstructure:"doc,omitempty" json:"doc,omitempty"`
+	Functions []Function `yaml:"functions,omitempty" mapstructure:"functions,omitempty" json:"functions,omitempty"`
+}
+
+// FunctionRegistry collects the libraries of functions available to the Contexts. It is safe for concurrent use.
+type FunctionRegistry struct {
+	mu        sync.RWMutex
+	libraries []*Library
+	funcMap   map[string]interface{}
+}
+
+var identifierRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+var defaultFunctionRegistry = newBuiltinsRegistry()
+
+// DefaultFunctionRegistry returns the process-wide registry picked up by NewContext. It holds the builtins and the libraries registered by the application.
+func DefaultFunctionRegistry() *FunctionRegistry {
+	return defaultFunctionRegistry
+}
+
+func NewFunctionRegistry() *FunctionRegistry {
+	return &FunctionRegistry{}
+}
+
+// Register adds the functions of the library to the registry. The functions of an already registered namespace are added to the existing library.
+func (r *FunctionRegistry) Register(lib Library) error {
+
+	if lib.Namespace != "" && !identifierRegexp.MatchString(lib.Namespace) {
+		return fmt.Errorf("invalid library namespace %s", lib.Namespace)
+	}
+
+	fns := make([]Function, 0, len(lib.Functions))
+	for _, f := range lib.Functions {
+		f, err := describeFunction(f)
+		if err != nil {
+			return fmt.Errorf("library %s: %w", lib.Namespace, err)
+		}
+		fns = append(fns, f)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if lib.Namespace != "" {
+		if root := r.library(""); root != nil && root.function(lib.Namespace) != nil {
+			return fmt.Errorf("library namespace %s clashes with a function of the same name", lib.Namespace)
+		}
+	}
+
+	target := r.library(lib.Namespace)
+	seen := make(map[string]struct{})
+	for _, f := range fns {
+		_, dup := seen[f.Name]
+		if dup || (target != nil && target.function(f.Name) != nil) {
+			return fmt.Errorf("function %s already registered", qualifiedName(lib.Namespace, f.Name))
+		}
+
+		if lib.Namespace == "" && r.library(f.Name) != nil {
+			return fmt.Errorf("function %s clashes with the library namespace of the same name", f.Name)
+		}
+		seen[f.Name] = struct{}{}
+	}
+
+	if target == nil {
+		target = &Library{Namespace: lib.Namespace}
+		r.libraries = append(r.libraries, target)
+	}
+
+	if target.Doc == "" {
+		target.Doc = lib.Doc
+	}
+
+	target.Functions = append(target.Functions, fns...)
+	r.funcMap = nil
+	return nil
+}
+
+// MustRegister is Register for package initialization: it panics on error.
+func (r *FunctionRegistry) MustRegister(lib Library) {
+	if err := r.Register(lib); err != nil {
+		panic(err)
+	}
+}
+
+// Lookup finds a function by its qualified name.
+func (r *FunctionRegistry) Lookup(name string) (Function, bool) {
+	ns, n := "", name
+	if ndx := strings.LastIndex(name, "."); ndx >= 0 {
+		ns, n = name[:ndx], name[ndx+1:]
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if lib := r.library(ns); lib != nil {
+		if f := lib.function(n); f != nil {
+			return *f, true
+		}
+	}
+
+	return Function{}, false
+}
+
+// Libraries returns a copy of the registered libraries in order of registration.
+func (r *FunctionRegistry) Libraries() []Library {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	libs := make([]Library, 0, len(r.libraries))
+	for _, lib := range r.libraries {
+		l := *lib
+		l.Functions = append([]Function(nil), lib.Functions...)
+		libs = append(libs, l)
+	}
+
+	return libs
+}
+
+// FuncMap returns the functions as gval parameters: the root library functions by name, the namespaces as nested maps.
+// The returned map is shared and must not be modified.
+func (r *FunctionRegistry) FuncMap() map[string]interface{} {
+
+	r.mu.RLock()
+	fm := r.funcMap
+	r.mu.RUnlock()
+	if fm != nil {
+		return fm
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.funcMap != nil {
+		return r.funcMap
+	}
+
+	fm = make(map[string]interface{})
+	for _, lib := range r.libraries {
+		target := fm
+		if lib.Namespace != "" {
+			target = make(map[string]interface{})
+			fm[lib.Namespace] = target
+		}
+
+		for _, f := range lib.Functions {
+			target[f.Name] = f.Fn
+		}
+	}
+
+	r.funcMap = fm
+	return fm
+}
+
+// WriteMarkdown writes the reference of the registered functions for the authors of the expressions.
+func (r *FunctionRegistry) WriteMarkdown(w io.Writer) error {
+
+	var sb strings.Builder
+	sb.WriteString("# Expression functions\n")
+	for _, lib := range r.Libraries() {
+		sb.WriteString("\n## ")
+		if lib.Namespace == "" {
+			sb.WriteString("Global functions")
+		} else {
+			sb.WriteString("Library `" + lib.Namespace + "`")
+		}
+		sb.WriteString("\n")
+
+		if lib.Doc != "" {
+			sb.WriteString("\n" + lib.Doc + "\n")
+		}
+
+		for _, f := range lib.Functions {
+			sb.WriteString("\n### `" + qualifiedName(lib.Namespace, f.Name) + "`\n\n")
+			sb.WriteString("```\n" + f.Signature(lib.Namespace) + "\n```\n")
+			if f.Doc != "" {
+				sb.WriteString("\n" + f.Doc + "\n")
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func (r *FunctionRegistry) library(ns string) *Library {
+	for _, lib := range r.libraries {
+		if lib.Namespace == ns {
+			return lib
+		}
+	}
+	return nil
+}
+
+func (lib *Library) function(n string) *Function {
+	for i := range lib.Functions {
+		if lib.Functions[i].Name == n {
+			return &lib.Functions[i]
+		}
+	}
+	return nil
+}
+
+func qualifiedName(ns, n string) string {
+	if ns == "" {
+		return n
+	}
+	return ns + "." + n
+}
+
+// describeFunction validates the function and fills in the metadata from the signature.
+func describeFunction(f Function) (Function, error) {
+
+	if !identifierRegexp.MatchString(f.Name) {
+		return f, fmt.Errorf("invalid function name %s", f.Name)
+	}
+
+	ft := reflect.TypeOf(f.Fn)
+	if ft == nil || ft.Kind() != reflect.Func {
+		return f, fmt.Errorf("function %s is a %T and not a func", f.Name, f.Fn)
+	}
+
+	if len(f.Args) > 0 && len(f.Args) != ft.NumIn() {
+		return f, fmt.Errorf("function %s declares %d args but takes %d", f.Name, len(f.Args), ft.NumIn())
+	}
+
+	args := make([]FunctionArg, ft.NumIn())
+	for i := 0; i < ft.NumIn(); i++ {
+		at := ft.In(i)
+		if ft.IsVariadic() && i == ft.NumIn()-1 {
+			at = at.Elem()
+		}
+
+		args[i] = FunctionArg{Name: fmt.Sprintf("arg%d", i+1), Type: typeName(at)}
+		if len(f.Args) > 0 {
+			if f.Args[i].Name != "" {
+				args[i].Name = f.Args[i].Name
+			}
+			if f.Args[i].Type != "" {
+				args[i].Type = f.Args[i].Type
+			}
+		}
+	}
+
+	f.Args = args
+	f.Variadic = ft.IsVariadic()
+
+	if f.Returns == "" {
+		var outs []string
+		for i := 0; i < ft.NumOut(); i++ {
+			if i == ft.NumOut()-1 && ft.Out(i).Implements(errorInterface) {
+				continue
+			}
+			outs = append(outs, typeName(ft.Out(i)))
+		}
+		f.Returns = strings.Join(outs, ", ")
+	}
+
+	return f, nil
+}
+
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			return "any"
+		}
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice:
+		return "[]" + typeName(t.Elem())
+	}
+	return t.String()
+}
@@ -0,0 +1,100 @@
+package expression_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/expression"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFunctionRegistry(t *testing.T) {
+
+	r := expression.NewFunctionRegistry()
+	err := r.Register(expression.Library{
+		Namespace: "bank",
+		Doc:       "Bank codes functions.",
+		Functions: []expression.Function{
+			{
+				Name: "abiOf",
+				Fn:   func(iban string) string { return iban[5:10] },
+				Doc:  "The ABI code of an italian IBAN.",
+				Args: []expression.FunctionArg{{Name: "iban"}},
+			},
+			{
+				Name: "isItalian",
+				Fn:   func(iban string) bool { return strings.HasPrefix(iban, "IT") },
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	f, ok := r.Lookup("bank.abiOf")
+	require.True(t, ok)
+	require.Equal(t, 1, f.Arity())
+	require.Equal(t, "bank.abiOf(iban string) string", f.Signature("bank"))
+
+	err = r.Register(expression.Library{Namespace: "bank", Functions: []expression.Function{{Name: "abiOf", Fn: strings.ToUpper}}})
+	require.Error(t, err)
+
+	err = r.Register(expression.Library{Functions: []expression.Function{{Name: "bank", Fn: strings.ToUpper}}})
+	require.Error(t, err)
+
+	err = r.Register(expression.Library{Functions: []expression.Function{{Name: "notAFunc", Fn: "text"}}})
+	require.Error(t, err)
+
+	err = r.Register(expression.Library{Functions: []expression.Function{{Name: "upper", Fn: strings.ToUpper, Args: []expression.FunctionArg{{Name: "s"}, {Name: "t"}}}}})
+	require.Error(t, err)
+
+	exprCtx, err := expression.NewContext(expression.WithFunctionRegistry(r), expression.WithVars(map[string]interface{}{"iban": "IT60X0542811101000000123456"}))
+	require.NoError(t, err)
+
+	for _, typed := range []bool{false, true} {
+		exprCtx, err := expression.NewContext(
+			expression.WithFunctionRegistry(r),
+			expression.WithTypedReferences(typed),
+			expression.WithVars(map[string]interface{}{"iban": "IT60X0542811101000000123456"}))
+		require.NoError(t, err)
+
+		v, err := exprCtx.EvalOne(`:bank.abiOf("{v:iban}")`)
+		require.NoError(t, err)
+		require.Equal(t, "05428", v)
+
+		b, err := exprCtx.BoolEvalOne(`bank.isItalian(iban) && str.left("{v:iban}", 2) == "IT" && str.in("IT", "IT,FR", false)`)
+		require.NoError(t, err)
+		require.True(t, b)
+	}
+
+	b, err := exprCtx.BoolEvalOne(`amt.add("cent", "cent", false, "100", "5") == amtAdd("cent", "cent", false, "100", "5")`)
+	require.NoError(t, err)
+	require.True(t, b)
+
+	// a namespace of the default registry gets the functions of the registry added.
+	sr := expression.NewFunctionRegistry()
+	err = sr.Register(expression.Library{Namespace: "str", Functions: []expression.Function{{Name: "twice", Fn: func(s string) string { return s + s }}}})
+	require.NoError(t, err)
+
+	exprCtx, err = expression.NewContext(expression.WithFunctionRegistry(sr))
+	require.NoError(t, err)
+
+	v, err := exprCtx.EvalOne(`:str.left("abc", 1) + str.twice("d")`)
+	require.NoError(t, err)
+	require.Equal(t, "add", v)
+
+	exprCtx, err = expression.NewContext()
+	require.NoError(t, err)
+	_, err = exprCtx.EvalOne(`:str.twice("d")`)
+	require.Error(t, err)
+
+	var sb strings.Builder
+	err = r.WriteMarkdown(&sb)
+	require.NoError(t, err)
+	require.Contains(t, sb.String(), "### `bank.abiOf`")
+	require.Contains(t, sb.String(), "bank.isItalian(arg1 string) bool")
+	t.Log(sb.String())
+
+	sb.Reset()
+	err = expression.DefaultFunctionRegistry().WriteMarkdown(&sb)
+	require.NoError(t, err)
+	require.Contains(t, sb.String(), "amt.add(sourceUnit string, targetUnit string, decimalFormat bool, amounts ...any) string")
+}
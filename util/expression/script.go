@@ -0,0 +1,239 @@
+package expression
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	ScriptAssignOperator = ":="
+	ScriptCommentPrefix  = "#"
+)
+
+// ScriptError tells the line of the script a parsing or evaluation error comes from.
+type ScriptError struct {
+	Line      int    `yaml:"line,omitempty" mapstructure:"line,omitempty" json:"line,omitempty"`
+	Statement string `yaml:"statement,omitempty" mapstructure:"statement,omitempty" json:"statement,omitempty"`
+	Err       error  `yaml:"-" mapstructure:"-" json:"-"`
+}
+
+func (e *ScriptError) Error() string {
+	return fmt.Sprintf("script line %d (%s): %v", e.Line, e.Statement, e.Err)
+}
+
+func (e *ScriptError) Unwrap() error {
+	return e.Err
+}
+
+var scriptVarNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_\-]*$`)
+
+type scriptStatement struct {
+	line int
+	text string
+
+	// Assignments have a name and an expression, conditionals a condition and the statements of the two branches.
+	name      string
+	expr      string
+	cond      string
+	then      []scriptStatement
+	otherwise []scriptStatement
+}
+
+// Script is a list of statements evaluated in order against a Context. A statement is either an assignment or a conditional:
+//
+//	# the value of the expression is stored in the var amount, referenced by the statements that follow as {v:amount}
+//	amount := amtAdd("cent", "cent", false, "{$.importo}", "100")
+//	if "{v:amount}" != "0" {
+//	    flag := true
+//	} else if "{$.natura}" == "PP" {
+//	    flag := false
+//	} else {
+//	    flag := {$.natura}
+//	}
+//
+// Empty lines and lines starting with # are skipped. Conditions are evaluated with BoolEvalOne, expressions with EvalOne: a text template
+// such as {$.natura} stores the resolved text.
+type Script struct {
+	statements []scriptStatement
+}
+
+// ParseScript parses the text of a script. The parsed script can be executed any number of times.
+func ParseScript(text string) (*Script, error) {
+	const semLogContext = "expression-script::parse"
+
+	p := scriptParser{lines: strings.Split(text, "\n")}
+	stmts, closer, err := p.parseBlock()
+	if err == nil && closer != "" {
+		err = p.errorf("unexpected %s", closer)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+		return nil, err
+	}
+
+	return &Script{statements: stmts}, nil
+}
+
+type scriptParser struct {
+	lines []string
+	ndx   int
+}
+
+func (p *scriptParser) errorf(format string, args ...interface{}) error {
+	return &ScriptError{Line: p.ndx, Statement: strings.TrimSpace(p.lines[p.ndx-1]), Err: fmt.Errorf(format, args...)}
+}
+
+// parseBlock reads statements up to the end of the text or to the line closing the block, which is returned.
+func (p *scriptParser) parseBlock() ([]scriptStatement, string, error) {
+	var stmts []scriptStatement
+	for p.ndx < len(p.lines) {
+		line := strings.TrimSpace(p.lines[p.ndx])
+		p.ndx++
+
+		if line == "" || strings.HasPrefix(line, ScriptCommentPrefix) {
+			continue
+		}
+
+		if strings.HasPrefix(line, "}") {
+			return stmts, line, nil
+		}
+
+		if cond, ok := ifCondition(line); ok {
+			stmt, err := p.parseIf(line, cond)
+			if err != nil {
+				return nil, "", err
+			}
+			stmts = append(stmts, stmt)
+			continue
+		}
+
+		name, expr, ok := strings.Cut(line, ScriptAssignOperator)
+		name, expr = strings.TrimSpace(name), strings.TrimSpace(expr)
+		if !ok {
+			return nil, "", p.errorf("statement is neither an assignment nor an if")
+		}
+
+		if !scriptVarNameRegexp.MatchString(name) {
+			return nil, "", p.errorf("invalid var name %q", name)
+		}
+
+		if expr == "" {
+			return nil, "", p.errorf("missing expression")
+		}
+
+		stmts = append(stmts, scriptStatement{line: p.ndx, text: line, name: name, expr: expr})
+	}
+
+	return stmts, "", nil
+}
+
+func (p *scriptParser) parseIf(line string, cond string) (scriptStatement, error) {
+	stmt := scriptStatement{line: p.ndx, text: line, cond: cond}
+	if cond == "" {
+		return stmt, p.errorf("missing condition")
+	}
+
+	var closer string
+	var err error
+	stmt.then, closer, err = p.parseBlock()
+	if err != nil {
+		return stmt, err
+	}
+
+	switch {
+	case closer == "":
+		return stmt, &ScriptError{Line: stmt.line, Statement: line, Err: errors.New("if not closed")}
+	case closer == "}":
+		return stmt, nil
+	case closer == "} else {":
+		stmt.otherwise, closer, err = p.parseBlock()
+		if err != nil {
+			return stmt, err
+		}
+		if closer != "}" {
+			return stmt, &ScriptError{Line: stmt.line, Statement: line, Err: errors.New("else not closed")}
+		}
+		return stmt, nil
+	}
+
+	if cond, ok := ifCondition(strings.TrimSpace(strings.TrimPrefix(closer, "} else"))); ok && strings.HasPrefix(closer, "} else ") {
+		elseIf, err := p.parseIf(closer, cond)
+		if err != nil {
+			return stmt, err
+		}
+		stmt.otherwise = []scriptStatement{elseIf}
+		return stmt, nil
+	}
+
+	return stmt, p.errorf("unexpected %s", closer)
+}
+
+// ifCondition extracts the condition of the lines like 'if cond {'.
+func ifCondition(line string) (string, bool) {
+	if !strings.HasPrefix(line, "if ") || !strings.HasSuffix(line, "{") {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "if "), "{")), true
+}
+
+// Exec runs the statements of the script storing the value of each assignment in the vars of the context.
+// The first failing statement stops the execution and is reported as a ScriptError.
+func (s *Script) Exec(pvr *Context) error {
+	return s.ExecCtx(context.Background(), pvr)
+}
+
+// ExecCtx is Exec with the evaluations bound to ctx as in EvalOneCtx.
+func (s *Script) ExecCtx(ctx context.Context, pvr *Context) error {
+	const semLogContext = "expression-script::exec"
+
+	err := execStatements(ctx, pvr, s.statements)
+	if err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+	}
+	return err
+}
+
+func execStatements(ctx context.Context, pvr *Context, stmts []scriptStatement) error {
+	for _, stmt := range stmts {
+		if stmt.name != "" {
+			v, err := pvr.EvalOneCtx(ctx, stmt.expr)
+			if err != nil {
+				return &ScriptError{Line: stmt.line, Statement: stmt.text, Err: err}
+			}
+			if err = pvr.SetVar(stmt.name, v); err != nil {
+				return &ScriptError{Line: stmt.line, Statement: stmt.text, Err: err}
+			}
+			continue
+		}
+
+		b, err := pvr.BoolEvalOneCtx(ctx, stmt.cond)
+		if err != nil {
+			return &ScriptError{Line: stmt.line, Statement: stmt.text, Err: err}
+		}
+
+		branch := stmt.otherwise
+		if b {
+			branch = stmt.then
+		}
+
+		if err = execStatements(ctx, pvr, branch); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExecScript parses and runs a script in one go.
+func (pvr *Context) ExecScript(text string) error {
+	s, err := ParseScript(text)
+	if err != nil {
+		return err
+	}
+	return s.Exec(pvr)
+}
@@ -0,0 +1,62 @@
+package expression_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/expression"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScript(t *testing.T) {
+
+	script := `
+# process vars of the payment
+natura := {$.beneficiario.natura}
+cf := left("{$.ordinante.codiceFiscale}", 6)
+importo := amtAdd("cent", "cent", false, "{$.beneficiario.numero}", "5")
+
+if "{v:natura}" == "PP" {
+    tipo := persona
+    if "{v:cf}" == "XXXXXX" {
+        check := false
+    } else {
+        check := true
+    }
+} else if "{v:natura}" == "PG" {
+    tipo := impresa
+} else {
+    tipo := altro
+}
+`
+
+	s, err := expression.ParseScript(script)
+	require.NoError(t, err)
+
+	exprCtx, err := expression.NewContext(expression.WithJsonInput(j))
+	require.NoError(t, err)
+
+	err = s.Exec(exprCtx)
+	require.NoError(t, err)
+
+	v, err := exprCtx.EvalOne("{v:cf}-{v:importo}-{v:tipo}-{v:check}")
+	require.NoError(t, err)
+	require.Equal(t, "LPRSPM-8188607-persona-true", v)
+
+	err = exprCtx.ExecScript("a := 1\n\nb := unknownFunc(1)\n")
+	var scriptErr *expression.ScriptError
+	require.True(t, errors.As(err, &scriptErr))
+	require.Equal(t, 3, scriptErr.Line)
+
+	err = exprCtx.ExecScript("a := 1\nif \"{v:natura}\" == 1 {\nb := 2\n")
+	require.True(t, errors.As(err, &scriptErr))
+	require.Equal(t, 2, scriptErr.Line)
+
+	_, err = expression.ParseScript("a := 1\nb = 2\n")
+	require.True(t, errors.As(err, &scriptErr))
+	require.Equal(t, 2, scriptErr.Line)
+
+	_, err = expression.ParseScript("a := 1\n}\n")
+	require.True(t, errors.As(err, &scriptErr))
+	require.Equal(t, 2, scriptErr.Line)
+}
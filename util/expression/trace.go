@@ -0,0 +1,118 @@
+package expression
+
+import (
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type TraceVariable struct {
+	Reference string      `yaml:"reference,omitempty" mapstructure:"reference,omitempty" json:"reference,omitempty"`
+	Value     interface{} `yaml:"value,omitempty" mapstructure:"value,omitempty" json:"value,omitempty"`
+	Text      string      `yaml:"text,omitempty" mapstructure:"text,omitempty" json:"text,omitempty"`
+	Deferred  bool        `yaml:"deferred,omitempty" mapstructure:"deferred,omitempty" json:"deferred,omitempty"`
+	Error     string      `yaml:"error,omitempty" mapstructure:"error,omitempty" json:"error,omitempty"`
+}
+
+type TraceCall struct {
+	Function string        `yaml:"function,omitempty" mapstructure:"function,omitempty" json:"function,omitempty"`
+	Args     []interface{} `yaml:"args,omitempty" mapstructure:"args,omitempty" json:"args,omitempty"`
+	Result   interface{}   `yaml:"result,omitempty" mapstructure:"result,omitempty" json:"result,omitempty"`
+	Error    string        `yaml:"error,omitempty" mapstructure:"error,omitempty" json:"error,omitempty"`
+	Elapsed  time.Duration `yaml:"elapsed,omitempty" mapstructure:"elapsed,omitempty" json:"elapsed,omitempty"`
+}
+
+// Trace is the account of an evaluation recorded in explain mode: the variable values, the text handed over to gval, the function calls and the outcome.
+type Trace struct {
+	Expression   string          `yaml:"expression,omitempty" mapstructure:"expression,omitempty" json:"expression,omitempty"`
+	Text         string          `yaml:"text,omitempty" mapstructure:"text,omitempty" json:"text,omitempty"`
+	IsExpression bool            `yaml:"is-expression,omitempty" mapstructure:"is-expression,omitempty" json:"is-expression,omitempty"`
+	Variables    []TraceVariable `yaml:"variables,omitempty" mapstructure:"variables,omitempty" json:"variables,omitempty"`
+	Calls        []TraceCall     `yaml:"calls,omitempty" mapstructure:"calls,omitempty" json:"calls,omitempty"`
+	Value        interface{}     `yaml:"value,omitempty" mapstructure:"value,omitempty" json:"value,omitempty"`
+	Error        string          `yaml:"error,omitempty" mapstructure:"error,omitempty" json:"error,omitempty"`
+	Elapsed      time.Duration   `yaml:"elapsed,omitempty" mapstructure:"elapsed,omitempty" json:"elapsed,omitempty"`
+	start        time.Time
+}
+
+// MarshalZerologObject makes the trace loggable as in log.Info().Object("trace", tr).
+func (tr *Trace) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("expression", tr.Expression).
+		Str("text", tr.Text).
+		Bool("is-expression", tr.IsExpression).
+		Interface("value", tr.Value).
+		Dur("elapsed", tr.Elapsed)
+
+	if tr.Error != "" {
+		e.Str("error", tr.Error)
+	}
+
+	if len(tr.Variables) > 0 {
+		e.Interface("variables", tr.Variables)
+	}
+
+	if len(tr.Calls) > 0 {
+		e.Interface("calls", tr.Calls)
+	}
+}
+
+// WithExplain enables the explain mode: each evaluation records a Trace retrieved by Context.Traces.
+func WithExplain(b bool) Option {
+	return func(r *Context) error {
+		r.explain = b
+		return nil
+	}
+}
+
+// Traces returns the traces recorded in explain mode since the creation of the context or the last ResetTraces, in order of evaluation.
+// With BoolEvalMany there is a trace for each evaluated expression.
+func (pvr *Context) Traces() []*Trace {
+	return pvr.traces
+}
+
+func (pvr *Context) ResetTraces() {
+	pvr.traces = nil
+}
+
+// startTrace begins the trace of an evaluation. Nested evaluations, as the compiled one in typed mode, contribute to the trace already started.
+func (pvr *Context) startTrace(expr string) *Trace {
+	if !pvr.explain || pvr.trace != nil {
+		return nil
+	}
+
+	pvr.trace = &Trace{Expression: expr, start: time.Now()}
+	return pvr.trace
+}
+
+func (pvr *Context) endTrace(tr *Trace, value interface{}, err error) {
+	if tr == nil {
+		return
+	}
+
+	tr.Value = value
+	if err != nil {
+		tr.Error = err.Error()
+	}
+	tr.Elapsed = time.Since(tr.start)
+	pvr.traces = append(pvr.traces, tr)
+	pvr.trace = nil
+}
+
+func (pvr *Context) traceText(text string, isExpr bool) {
+	if pvr.trace != nil {
+		pvr.trace.Text = text
+		pvr.trace.IsExpression = isExpr
+	}
+}
+
+func (pvr *Context) traceVariable(ref string, value interface{}, text string, deferred bool, err error) {
+	if pvr.trace == nil {
+		return
+	}
+
+	tv := TraceVariable{Reference: ref, Value: value, Text: text, Deferred: deferred}
+	if err != nil {
+		tv.Error = err.Error()
+	}
+	pvr.trace.Variables = append(pvr.trace.Variables, tv)
+}
@@ -0,0 +1,67 @@
+package expression_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/expression"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextExplain(t *testing.T) {
+
+	for _, typed := range []bool{false, true} {
+		exprCtx, err := expression.NewContext(
+			expression.WithJsonInput(j),
+			expression.WithVars(map[string]interface{}{"var01": "OK"}),
+			expression.WithTypedReferences(typed),
+			expression.WithExplain(true))
+		require.NoError(t, err)
+
+		b, ndx, err := exprCtx.BoolEvalMany([]string{
+			`"{$.beneficiario.natura}" == "PP"`,
+			`left("{$.ordinante.codiceFiscale}", 6) == "LPRSPM" && str.left("{v:var01}", 1) == "O"`,
+			`amtAdd("cent", "cent", false, "{$.beneficiario.numero}", "5") == "6"`,
+		}, expression.AllMustMatch)
+		require.NoError(t, err)
+		require.False(t, b)
+		require.Equal(t, 2, ndx)
+
+		traces := exprCtx.Traces()
+		require.Len(t, traces, 3)
+
+		require.Equal(t, true, traces[0].Value)
+		require.Len(t, traces[0].Variables, 1)
+		require.Equal(t, "$.beneficiario.natura", traces[0].Variables[0].Reference)
+		require.Equal(t, "PP", traces[0].Variables[0].Value)
+
+		require.Len(t, traces[1].Calls, 2)
+		require.Equal(t, "left", traces[1].Calls[0].Function)
+		require.Equal(t, "LPRSPM", traces[1].Calls[0].Result)
+		require.Equal(t, "str.left", traces[1].Calls[1].Function)
+
+		require.Equal(t, false, traces[2].Value)
+		require.Len(t, traces[2].Calls, 1)
+		require.Equal(t, []interface{}{"cent", "cent", false, "8188602", "5"}, traces[2].Calls[0].Args)
+		require.Equal(t, "8188607", traces[2].Calls[0].Result)
+
+		_, err = json.Marshal(traces)
+		require.NoError(t, err)
+		log.Info().Object("trace", traces[2]).Bool("typed", typed).Msg("explain")
+
+		exprCtx.ResetTraces()
+		v, err := exprCtx.EvalOne(`{v:var01,len=4,pad=.} and {$.missing,defer}`)
+		require.NoError(t, err)
+		require.Equal(t, "OK.. and {$.missing}", v)
+		require.Len(t, exprCtx.Traces(), 1)
+		require.Len(t, exprCtx.Traces()[0].Variables, 2)
+		require.True(t, exprCtx.Traces()[0].Variables[1].Deferred)
+	}
+
+	exprCtx, err := expression.NewContext(expression.WithJsonInput(j))
+	require.NoError(t, err)
+	_, err = exprCtx.BoolEvalOne(`"{$.beneficiario.natura}" == "PP"`)
+	require.NoError(t, err)
+	require.Empty(t, exprCtx.Traces())
+}
@@ -0,0 +1,178 @@
+package fixedlengthfile
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	PackedSignPositive = 0x0C
+	PackedSignNegative = 0x0D
+	PackedSignUnsigned = 0x0F
+)
+
+// IsBinary tells if the field holds a comp-3 or comp value: such fields are not text and are not converted by the code page.
+func (fd FixedLengthFieldDefinition) IsBinary() bool {
+	ft, err := fd.FieldType()
+	return err == nil && (ft.Kind == FixedLengthFieldPacked || ft.Kind == FixedLengthFieldBinary)
+}
+
+// DecodeBinary decodes the bytes of a comp-3 or comp field to the text of its value, as in -123.45.
+// A comp-3 field holds two digits per byte with the sign in the last nibble: C and F are positive, D negative. A comp field is a big endian
+// two's complement integer of 2, 4 or 8 bytes.
+func (fd FixedLengthFieldDefinition) DecodeBinary(b []byte) (string, error) {
+	ft, err := fd.FieldType()
+	if err != nil {
+		return "", err
+	}
+
+	unscaled := new(big.Int)
+	switch ft.Kind {
+	case FixedLengthFieldPacked:
+		var digits string
+		digits, err = decodePacked(b)
+		if err == nil {
+			unscaled.SetString(digits, 10)
+		}
+	case FixedLengthFieldBinary:
+		var v int64
+		v, err = decodeBinary(b)
+		unscaled.SetInt64(v)
+	default:
+		return "", fmt.Errorf("%w: %s is not binary", ErrFieldTypeMismatch, ft.Kind)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return decimal.NewFromBigInt(unscaled, int32(-ft.Scale)).StringFixed(int32(ft.Scale)), nil
+}
+
+// EncodeBinary encodes the text of a value to the bytes of a comp-3 or comp field of the field length. The value is rounded to the scale;
+// an empty value is zero and a value not fitting the field is an error.
+func (fd FixedLengthFieldDefinition) EncodeBinary(value string) ([]byte, error) {
+	ft, err := fd.FieldType()
+	if err != nil {
+		return nil, err
+	}
+
+	d := decimal.Zero
+	if value = strings.TrimSpace(value); value != "" {
+		d, err = decimal.NewFromString(strings.ReplaceAll(value, ",", "."))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	unscaled := d.Shift(int32(ft.Scale)).Round(0).BigInt()
+	switch ft.Kind {
+	case FixedLengthFieldPacked:
+		return encodePacked(unscaled, fd.Length)
+	case FixedLengthFieldBinary:
+		if !unscaled.IsInt64() {
+			return nil, fmt.Errorf("value %s out of range of field %s", value, fd.Name)
+		}
+		return encodeBinary(unscaled.Int64(), fd.Length)
+	}
+
+	return nil, fmt.Errorf("%w: %s is not binary", ErrFieldTypeMismatch, ft.Kind)
+}
+
+// decodePacked gives the digits of a comp-3 value, preceded by the minus sign if negative.
+func decodePacked(b []byte) (string, error) {
+	if len(b) == 0 {
+		return "", fmt.Errorf("invalid comp-3 length %d", len(b))
+	}
+
+	var sb strings.Builder
+	sb.Grow(2*len(b) + 1)
+	sb.WriteByte('+')
+	for i, c := range b {
+		hi, lo := c>>4, c&0x0F
+		if hi > 9 {
+			return "", fmt.Errorf("invalid comp-3 digit %X", hi)
+		}
+		sb.WriteByte('0' + hi)
+
+		if i < len(b)-1 {
+			if lo > 9 {
+				return "", fmt.Errorf("invalid comp-3 digit %X", lo)
+			}
+			sb.WriteByte('0' + lo)
+			continue
+		}
+
+		switch lo {
+		case PackedSignNegative:
+			return "-" + sb.String()[1:], nil
+		case PackedSignPositive, PackedSignUnsigned:
+		default:
+			return "", fmt.Errorf("invalid comp-3 sign %X", lo)
+		}
+	}
+
+	return sb.String(), nil
+}
+
+func encodePacked(v *big.Int, length int) ([]byte, error) {
+	sign := byte(PackedSignPositive)
+	if v.Sign() < 0 {
+		sign = PackedSignNegative
+	}
+
+	digits := new(big.Int).Abs(v).String()
+	if len(digits) > 2*length-1 {
+		return nil, fmt.Errorf("value %s exceeds the %d digits of a comp-3 of %d bytes", v, 2*length-1, length)
+	}
+
+	digits = strings.Repeat("0", 2*length-1-len(digits)) + digits
+	b := make([]byte, length)
+	for i := 0; i < length; i++ {
+		hi := digits[2*i] - '0'
+		lo := sign
+		if 2*i+1 < len(digits) {
+			lo = digits[2*i+1] - '0'
+		}
+		b[i] = hi<<4 | lo
+	}
+
+	return b, nil
+}
+
+func decodeBinary(b []byte) (int64, error) {
+	switch len(b) {
+	case 2:
+		return int64(int16(binary.BigEndian.Uint16(b))), nil
+	case 4:
+		return int64(int32(binary.BigEndian.Uint32(b))), nil
+	case 8:
+		return int64(binary.BigEndian.Uint64(b)), nil
+	}
+	return 0, fmt.Errorf("invalid comp length %d", len(b))
+}
+
+func encodeBinary(n int64, length int) ([]byte, error) {
+	b := make([]byte, length)
+	switch length {
+	case 2:
+		if n < -1<<15 || n >= 1<<15 {
+			return nil, fmt.Errorf("value %d out of range of a comp of 2 bytes", n)
+		}
+		binary.BigEndian.PutUint16(b, uint16(n))
+	case 4:
+		if n < -1<<31 || n >= 1<<31 {
+			return nil, fmt.Errorf("value %d out of range of a comp of 4 bytes", n)
+		}
+		binary.BigEndian.PutUint32(b, uint32(n))
+	case 8:
+		binary.BigEndian.PutUint64(b, uint64(n))
+	default:
+		return nil, fmt.Errorf("invalid comp length %d", length)
+	}
+	return b, nil
+}
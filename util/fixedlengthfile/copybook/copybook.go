@@ -0,0 +1,714 @@
+package copybook
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/fixedlengthfile"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	FillerName = "FILLER"
+
+	// SequenceAreaLength is the length of the sequence area preceding the indicator column of the fixed format.
+	SequenceAreaLength = 6
+	// ProgramTextEndColumn is the last column of the program text of the fixed format: the columns after it are ignored.
+	ProgramTextEndColumn = 72
+
+	UsageDisplay = "DISPLAY"
+	UsageComp    = "COMP"
+	UsageComp1   = "COMP-1"
+	UsageComp2   = "COMP-2"
+	UsageComp3   = "COMP-3"
+)
+
+var ErrNoRecords = errors.New("copybook without 01 level records")
+
+// Issue is a construct of the copybook that has been skipped or translated approximately. Line is the 1-based line where the statement starts.
+type Issue struct {
+	Line      int    `yaml:"line,omitempty" mapstructure:"line,omitempty" json:"line,omitempty"`
+	Statement string `yaml:"statement,omitempty" mapstructure:"statement,omitempty" json:"statement,omitempty"`
+	Message   string `yaml:"message,omitempty" mapstructure:"message,omitempty" json:"message,omitempty"`
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%d: %s: %s", i.Line, i.Statement, i.Message)
+}
+
+type Config struct {
+	FreeFormat bool `yaml:"free-format,omitempty" mapstructure:"free-format,omitempty" json:"free-format,omitempty"`
+}
+
+type Option func(cfg *Config)
+
+// WithFreeFormat reads the copybook as free format text: by default the lines are in the fixed format, with the sequence area in the columns 1-6,
+// the indicator in the column 7 and the text ending at the column 72.
+func WithFreeFormat(b bool) Option {
+	return func(cfg *Config) {
+		cfg.FreeFormat = b
+	}
+}
+
+// item is a data description entry.
+type item struct {
+	line           int
+	statement      string
+	level          int
+	name           string
+	pic            string
+	usage          string
+	occurs         int
+	redefines      string
+	signLeading    bool
+	signSeparate   bool
+	justifiedRight bool
+	children       []*item
+}
+
+func (it *item) isFiller() bool {
+	return it.name == "" || strings.EqualFold(it.name, FillerName)
+}
+
+// ParseFile parses the copybook of a file.
+func ParseFile(fn string, opts ...Option) ([]fixedlengthfile.FixedLengthRecordDefinition, []Issue, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	return Parse(f, opts...)
+}
+
+// Parse translates the 01 levels of a copybook to record definitions. Elementary items become fields with the type of their picture:
+// X and A are alpha, 9 is numeric, 9 with V is decimal(scale) and S9 signed-trailing(scale), or decimal(scale) with a leading separate sign.
+// FILLER items are dropped fields, OCCURS are expanded with the 1-based index appended to the ids, 88 levels are ignored and an 01 level
+// REDEFINES is a record of its own. COMP-3 and COMP items are comp-3(scale) and comp(scale) fields. The other REDEFINES, the COMP-1 and COMP-2
+// usages, the variable OCCURS and the levels 66 and 77 cannot be represented and are reported as issues.
+func Parse(r io.Reader, opts ...Option) ([]fixedlengthfile.FixedLengthRecordDefinition, []Issue, error) {
+	const semLogContext = "copybook::parse"
+
+	var cfg Config
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	p := parser{}
+	stmts, err := readStatements(r, cfg.FreeFormat)
+	if err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+		return nil, nil, err
+	}
+
+	var roots []*item
+	var stack []*item
+	for _, st := range stmts {
+		it, err := p.parseEntry(st)
+		if err != nil {
+			log.Error().Err(err).Msg(semLogContext)
+			return nil, p.issues, err
+		}
+
+		if it == nil {
+			continue
+		}
+
+		if it.level == 1 {
+			roots = append(roots, it)
+			stack = []*item{it}
+			continue
+		}
+
+		for len(stack) > 0 && stack[len(stack)-1].level >= it.level {
+			stack = stack[:len(stack)-1]
+		}
+
+		if len(stack) == 0 {
+			err = fmt.Errorf("line %d: level %02d outside of an 01 level record", it.line, it.level)
+			log.Error().Err(err).Msg(semLogContext)
+			return nil, p.issues, err
+		}
+
+		parent := stack[len(stack)-1]
+		if parent.pic != "" {
+			err = fmt.Errorf("line %d: elementary item %s with subordinate items", parent.line, parent.name)
+			log.Error().Err(err).Msg(semLogContext)
+			return nil, p.issues, err
+		}
+
+		parent.children = append(parent.children, it)
+		stack = append(stack, it)
+	}
+
+	if len(roots) == 0 {
+		return nil, p.issues, ErrNoRecords
+	}
+
+	var recs []fixedlengthfile.FixedLengthRecordDefinition
+	for _, root := range roots {
+		rec := fixedlengthfile.FixedLengthRecordDefinition{Id: toId(root.name)}
+		ids := map[string]bool{}
+		if err = p.appendFields(&rec, root, "", "", ids); err != nil {
+			log.Error().Err(err).Msg(semLogContext)
+			return nil, p.issues, err
+		}
+
+		if len(rec.Fields) == 0 {
+			p.issue(root, "record without fields")
+			continue
+		}
+
+		if err = rec.AdjustFieldInfoIndex(); err != nil {
+			log.Error().Err(err).Msg(semLogContext)
+			return nil, p.issues, err
+		}
+
+		recs = append(recs, rec)
+	}
+
+	return recs, p.issues, nil
+}
+
+type statement struct {
+	line int
+	text string
+}
+
+// readStatements splits the text in the period terminated statements. A period is a separator when followed by a space or by the end of the text.
+func readStatements(r io.Reader, freeFormat bool) ([]statement, error) {
+	var stmts []statement
+	var sb strings.Builder
+	startLine := 0
+
+	scanner := bufio.NewScanner(r)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		l := scanner.Text()
+		if !freeFormat {
+			if len(l) <= SequenceAreaLength {
+				continue
+			}
+
+			indicator := l[SequenceAreaLength]
+			if indicator == '*' || indicator == '/' {
+				continue
+			}
+
+			if len(l) > ProgramTextEndColumn {
+				l = l[:ProgramTextEndColumn]
+			}
+			l = l[SequenceAreaLength+1:]
+		} else if strings.HasPrefix(strings.TrimSpace(l), "*") {
+			continue
+		}
+
+		for l != "" {
+			if strings.TrimSpace(l) != "" && strings.TrimSpace(sb.String()) == "" {
+				startLine = lineno
+			}
+
+			ndx := statementEnd(l)
+			if ndx < 0 {
+				sb.WriteString(l)
+				sb.WriteString(" ")
+				break
+			}
+
+			sb.WriteString(l[:ndx])
+			if s := strings.TrimSpace(sb.String()); s != "" {
+				stmts = append(stmts, statement{line: startLine, text: s})
+			}
+			sb.Reset()
+			l = l[ndx+1:]
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if s := strings.TrimSpace(sb.String()); s != "" {
+		return nil, fmt.Errorf("line %d: statement not terminated by a period: %s", startLine, s)
+	}
+
+	return stmts, nil
+}
+
+func statementEnd(l string) int {
+	quote := byte(0)
+	for i := 0; i < len(l); i++ {
+		c := l[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '.' && (i == len(l)-1 || l[i+1] == ' ' || l[i+1] == '\t'):
+			return i
+		}
+	}
+	return -1
+}
+
+func tokenize(s string) []string {
+	var tokens []string
+	var sb strings.Builder
+	quote := byte(0)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			sb.WriteByte(c)
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			sb.WriteByte(c)
+		case c == ' ' || c == '\t' || (c == ',' || c == ';') && (i == len(s)-1 || s[i+1] == ' '):
+			if sb.Len() > 0 {
+				tokens = append(tokens, sb.String())
+				sb.Reset()
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	if sb.Len() > 0 {
+		tokens = append(tokens, sb.String())
+	}
+	return tokens
+}
+
+var clauseKeywords = map[string]bool{
+	"PIC": true, "PICTURE": true, "REDEFINES": true, "OCCURS": true, "VALUE": true, "VALUES": true, "USAGE": true,
+	"SIGN": true, "LEADING": true, "TRAILING": true, "JUSTIFIED": true, "JUST": true, "BLANK": true, "SYNC": true,
+	"SYNCHRONIZED": true, "GLOBAL": true, "EXTERNAL": true, "RENAMES": true,
+}
+
+var usages = map[string]string{
+	"DISPLAY": UsageDisplay, "COMP": UsageComp, "COMPUTATIONAL": UsageComp, "BINARY": UsageComp, "COMP-4": UsageComp,
+	"COMPUTATIONAL-4": UsageComp, "COMP-5": UsageComp, "COMPUTATIONAL-5": UsageComp, "COMP-1": UsageComp1,
+	"COMPUTATIONAL-1": UsageComp1, "COMP-2": UsageComp2, "COMPUTATIONAL-2": UsageComp2, "COMP-3": UsageComp3,
+	"COMPUTATIONAL-3": UsageComp3, "PACKED-DECIMAL": UsageComp3, "POINTER": "POINTER", "INDEX": "INDEX",
+}
+
+func isKeyword(t string) bool {
+	t = strings.ToUpper(t)
+	_, isUsage := usages[t]
+	return clauseKeywords[t] || isUsage
+}
+
+type parser struct {
+	issues []Issue
+}
+
+func (p *parser) issue(it *item, format string, args ...interface{}) {
+	p.issues = append(p.issues, Issue{Line: it.line, Statement: it.statement, Message: fmt.Sprintf(format, args...)})
+}
+
+// parseEntry parses a data description entry. The 88, 66 and 77 levels are not items of the records and give a nil item.
+func (p *parser) parseEntry(st statement) (*item, error) {
+	tokens := tokenize(st.text)
+	it := &item{line: st.line, statement: st.text, usage: UsageDisplay, occurs: 1}
+
+	level, err := strconv.Atoi(tokens[0])
+	if err != nil {
+		return nil, fmt.Errorf("line %d: invalid level number %s", st.line, tokens[0])
+	}
+	it.level = level
+
+	switch {
+	case level == 88:
+		return nil, nil
+	case level == 66 || level == 77:
+		p.issue(it, "level %02d not supported", level)
+		return nil, nil
+	case level < 1 || level > 49:
+		return nil, fmt.Errorf("line %d: invalid level number %s", st.line, tokens[0])
+	}
+
+	i := 1
+	if i < len(tokens) && !isKeyword(tokens[i]) {
+		it.name = tokens[i]
+		i++
+	}
+
+	for i < len(tokens) {
+		t := strings.ToUpper(tokens[i])
+		i++
+		switch t {
+		case "PIC", "PICTURE":
+			i = skip(tokens, i, "IS")
+			if i >= len(tokens) {
+				return nil, fmt.Errorf("line %d: picture string missing", st.line)
+			}
+			it.pic = strings.ToUpper(tokens[i])
+			i++
+
+		case "REDEFINES":
+			if i >= len(tokens) {
+				return nil, fmt.Errorf("line %d: redefined item missing", st.line)
+			}
+			it.redefines = tokens[i]
+			i++
+
+		case "OCCURS":
+			if i >= len(tokens) {
+				return nil, fmt.Errorf("line %d: occurs count missing", st.line)
+			}
+			n, err := strconv.Atoi(tokens[i])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("line %d: invalid occurs count %s", st.line, tokens[i])
+			}
+			it.occurs = n
+			i++
+			i, err = p.parseOccursTail(it, tokens, i)
+			if err != nil {
+				return nil, err
+			}
+
+		case "USAGE":
+			i = skip(tokens, i, "IS")
+			if i >= len(tokens) {
+				return nil, fmt.Errorf("line %d: usage missing", st.line)
+			}
+			u, ok := usages[strings.ToUpper(tokens[i])]
+			if !ok {
+				return nil, fmt.Errorf("line %d: unknown usage %s", st.line, tokens[i])
+			}
+			it.usage = u
+			i++
+
+		case "SIGN", "LEADING", "TRAILING":
+			if t == "SIGN" {
+				i = skip(tokens, i, "IS")
+				if i >= len(tokens) {
+					return nil, fmt.Errorf("line %d: sign position missing", st.line)
+				}
+				t = strings.ToUpper(tokens[i])
+				i++
+			}
+			it.signLeading = t == "LEADING"
+			if i < len(tokens) && strings.EqualFold(tokens[i], "SEPARATE") {
+				it.signSeparate = true
+				i = skip(tokens, i+1, "CHARACTER")
+			}
+
+		case "JUSTIFIED", "JUST":
+			it.justifiedRight = true
+			i = skip(tokens, i, "RIGHT")
+
+		case "VALUE", "VALUES":
+			for i < len(tokens) && !isKeyword(tokens[i]) {
+				i++
+			}
+
+		case "BLANK":
+			i = skip(tokens, skip(tokens, i, "WHEN"), "ZERO", "ZEROS", "ZEROES")
+
+		case "SYNC", "SYNCHRONIZED":
+			i = skip(tokens, i, "LEFT", "RIGHT")
+
+		case "GLOBAL", "EXTERNAL":
+
+		default:
+			if u, ok := usages[t]; ok {
+				it.usage = u
+				continue
+			}
+			p.issue(it, "clause %s not supported", tokens[i-1])
+		}
+	}
+
+	return it, nil
+}
+
+// parseOccursTail parses the clauses following the count of an OCCURS. The variable OCCURS are taken at their maximum.
+func (p *parser) parseOccursTail(it *item, tokens []string, i int) (int, error) {
+	for i < len(tokens) {
+		switch strings.ToUpper(tokens[i]) {
+		case "TO":
+			if i+1 >= len(tokens) {
+				return i, fmt.Errorf("line %d: occurs maximum missing", it.line)
+			}
+			n, err := strconv.Atoi(tokens[i+1])
+			if err != nil {
+				return i, fmt.Errorf("line %d: invalid occurs maximum %s", it.line, tokens[i+1])
+			}
+			it.occurs = n
+			p.issue(it, "variable occurs taken at its maximum %d", n)
+			i += 2
+		case "TIMES":
+			i++
+		case "DEPENDING":
+			i = skip(tokens, i+1, "ON") + 1
+		case "ASCENDING", "DESCENDING", "INDEXED":
+			i = skip(tokens, i+1, "KEY", "IS", "BY")
+			for i < len(tokens) && !isKeyword(tokens[i]) && !strings.EqualFold(tokens[i], "INDEXED") {
+				i++
+			}
+		default:
+			return i, nil
+		}
+	}
+	return i, nil
+}
+
+func skip(tokens []string, i int, words ...string) int {
+	for i < len(tokens) {
+		found := false
+		for _, w := range words {
+			if strings.EqualFold(tokens[i], w) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+		i++
+	}
+	return i
+}
+
+func (p *parser) appendFields(rec *fixedlengthfile.FixedLengthRecordDefinition, it *item, suffix string, parentId string, ids map[string]bool) error {
+	if it.level != 1 && it.redefines != "" {
+		p.issue(it, "redefines %s not supported: the item is skipped", it.redefines)
+		return nil
+	}
+
+	if it.level != 1 && len(it.children) == 0 && it.pic == "" && it.usage != UsageComp1 && it.usage != UsageComp2 {
+		return fmt.Errorf("line %d: elementary item %s without picture", it.line, it.name)
+	}
+
+	for n := 1; n <= it.occurs; n++ {
+		sfx := suffix
+		if it.occurs > 1 {
+			sfx = fmt.Sprintf("%s-%d", suffix, n)
+		}
+
+		if len(it.children) > 0 || it.level == 1 && it.pic == "" {
+			id := parentId
+			if !it.isFiller() && it.level != 1 {
+				id = toId(it.name) + sfx
+			}
+			for _, c := range it.children {
+				if err := p.appendFields(rec, c, sfx, id, ids); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		fd, err := p.field(it)
+		if err != nil {
+			return err
+		}
+
+		if fd.Drop {
+			fd.Id = fmt.Sprintf("filler-%d", len(rec.Fields)+1)
+			fd.Name = fd.Id
+		} else {
+			fd.Id = uniqueId(toId(it.name)+sfx, parentId, ids)
+		}
+		ids[fd.Id] = true
+		rec.Fields = append(rec.Fields, fd)
+	}
+
+	return nil
+}
+
+// uniqueId qualifies an id already taken with the id of the parent group and then with a counter.
+func uniqueId(id string, parentId string, ids map[string]bool) string {
+	if !ids[id] {
+		return id
+	}
+
+	if parentId != "" && !ids[parentId+"."+id] {
+		return parentId + "." + id
+	}
+
+	for n := 2; ; n++ {
+		if c := fmt.Sprintf("%s-%d", id, n); !ids[c] {
+			return c
+		}
+	}
+}
+
+func (p *parser) field(it *item) (fixedlengthfile.FixedLengthFieldDefinition, error) {
+	fd := fixedlengthfile.FixedLengthFieldDefinition{
+		Name:   it.name,
+		Drop:   it.isFiller(),
+		Format: fixedlengthfile.FieldFormat{Trim: true},
+	}
+
+	switch it.usage {
+	case UsageComp1:
+		fd.Length, fd.Type = 4, fixedlengthfile.FixedLengthFieldAlpha
+		p.issue(it, "usage %s not supported: taken as alpha", it.usage)
+		return fd, nil
+	case UsageComp2:
+		fd.Length, fd.Type = 8, fixedlengthfile.FixedLengthFieldAlpha
+		p.issue(it, "usage %s not supported: taken as alpha", it.usage)
+		return fd, nil
+	}
+
+	pic, err := parsePicture(it.pic)
+	if err != nil {
+		return fd, fmt.Errorf("line %d: %w", it.line, err)
+	}
+
+	fd.Help = "PIC " + it.pic
+	fd.Length = pic.length
+	switch {
+	case pic.edited:
+		fd.Type = fixedlengthfile.FixedLengthFieldAlpha
+		p.issue(it, "edited picture %s taken as alpha", it.pic)
+	case pic.alpha:
+		fd.Type = fixedlengthfile.FixedLengthFieldAlpha
+		if it.justifiedRight {
+			fd.Format.Alignment = fixedlengthfile.AlignmentRight
+		}
+	default:
+		fd.Format.PadCharacter = "0"
+		fd.Format.Alignment = fixedlengthfile.AlignmentRight
+		switch {
+		case pic.signed && it.signLeading && !it.signSeparate:
+			fd.Type = fixedlengthfile.FixedLengthFieldAlpha
+			p.issue(it, "leading overpunched sign not supported: taken as alpha")
+		case pic.signed && it.signLeading:
+			fd.Type = decimalType(fixedlengthfile.FixedLengthFieldDecimal, pic.scale)
+		case pic.signed:
+			fd.Type = decimalType(fixedlengthfile.FixedLengthFieldSignedTrailing, pic.scale)
+		case pic.scale > 0:
+			fd.Type = decimalType(fixedlengthfile.FixedLengthFieldDecimal, pic.scale)
+		default:
+			fd.Type = fixedlengthfile.FixedLengthFieldNumeric
+		}
+
+		if pic.signed && it.signSeparate {
+			fd.Length++
+		}
+	}
+
+	switch it.usage {
+	case UsageDisplay:
+	case UsageComp3, UsageComp:
+		if pic.alpha || pic.edited {
+			return fd, fmt.Errorf("line %d: usage %s of a non numeric picture %s", it.line, it.usage, it.pic)
+		}
+
+		fd.Format = fixedlengthfile.FieldFormat{}
+		if it.usage == UsageComp3 {
+			fd.Length = pic.digits/2 + 1
+			fd.Type = decimalType(fixedlengthfile.FixedLengthFieldPacked, pic.scale)
+		} else {
+			fd.Length = binaryLength(pic.digits)
+			fd.Type = decimalType(fixedlengthfile.FixedLengthFieldBinary, pic.scale)
+		}
+	default:
+		return fd, fmt.Errorf("line %d: usage %s not supported", it.line, it.usage)
+	}
+
+	return fd, nil
+}
+
+func decimalType(kind string, scale int) string {
+	if scale == 0 {
+		return kind
+	}
+	return fmt.Sprintf("%s(%d)", kind, scale)
+}
+
+func binaryLength(digits int) int {
+	switch {
+	case digits <= 4:
+		return 2
+	case digits <= 9:
+		return 4
+	default:
+		return 8
+	}
+}
+
+type picture struct {
+	alpha  bool
+	edited bool
+	signed bool
+	digits int
+	scale  int
+	length int
+}
+
+// parsePicture expands the repetitions of a picture string, as in 9(5), and tells its category and sizes.
+func parsePicture(s string) (picture, error) {
+	var pic picture
+	if s == "" {
+		return pic, errors.New("empty picture")
+	}
+
+	afterV := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		n := 1
+		if i+1 < len(s) && s[i+1] == '(' {
+			end := strings.IndexByte(s[i:], ')')
+			if end < 0 {
+				return pic, fmt.Errorf("malformed picture %s", s)
+			}
+			rep, err := strconv.Atoi(s[i+2 : i+end])
+			if err != nil || rep <= 0 {
+				return pic, fmt.Errorf("malformed picture %s", s)
+			}
+			n = rep
+			i += end
+		}
+
+		switch c {
+		case 'X', 'A':
+			pic.alpha = true
+			pic.length += n
+		case '9':
+			pic.digits += n
+			pic.length += n
+			if afterV {
+				pic.scale += n
+			}
+		case 'S':
+			if i != 0 {
+				return pic, fmt.Errorf("sign not leading in picture %s", s)
+			}
+			pic.signed = true
+		case 'V':
+			if afterV {
+				return pic, fmt.Errorf("more than one V in picture %s", s)
+			}
+			afterV = true
+		case 'P':
+			return pic, fmt.Errorf("scaling position P not supported in picture %s", s)
+		case 'Z', '*', '+', '-', '.', ',', 'B', '0', '/', '$', 'C', 'R', 'D':
+			pic.edited = true
+			pic.length += n
+		default:
+			return pic, fmt.Errorf("invalid symbol %c in picture %s", c, s)
+		}
+	}
+
+	return pic, nil
+}
+
+// toId lowers the COBOL names: CUST-NAME is cust-name.
+func toId(name string) string {
+	return strings.ToLower(name)
+}
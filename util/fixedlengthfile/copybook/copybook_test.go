@@ -0,0 +1,97 @@
+package copybook_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/fixedlengthfile"
+	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/fixedlengthfile/copybook"
+	"github.com/stretchr/testify/require"
+)
+
+const customerCopybook = `
+000100* CUSTOMER MASTER RECORD                                          CUST0001
+000200 01  CUSTOMER-REC.                                                CUST0002
+000300     05  CUST-ID               PIC 9(8).                          CUST0003
+000400     05  CUST-NAME             PIC X(30).                         CUST0004
+000500     05  CUST-STATUS           PIC X.                             CUST0005
+000600         88  CUST-ACTIVE       VALUE 'A'.                         CUST0006
+000700         88  CUST-CLOSED       VALUE 'C' 'X'.                     CUST0007
+000800     05  FILLER                PIC X(2).                          CUST0008
+000900     05  CUST-BALANCE          PIC S9(7)V99.                      CUST0009
+001000     05  CUST-RATE             PIC 9V9(4).                        CUST0010
+001100     05  CUST-ADJ              PIC S9(5) SIGN LEADING SEPARATE.   CUST0011
+001200     05  CUST-PHONES OCCURS 2 TIMES.                              CUST0012
+001300         10  PHONE-TYPE        PIC X.                             CUST0013
+001400         10  PHONE-NUMBER      PIC X(12).                         CUST0014
+001500     05  CUST-ALT-ID REDEFINES CUST-ID PIC X(8).                  CUST0015
+001600     05  CUST-PACKED           PIC S9(5) COMP-3.                  CUST0016
+001700     05  CUST-DISPLAY-AMT      PIC Z,ZZ9.99.                      CUST0017
+001800 01  CUSTOMER-TRAILER REDEFINES CUSTOMER-REC.                     CUST0018
+001900     05  TRL-COUNT             PIC 9(6).                          CUST0019
+002000     05  FILLER                PIC X(40).                         CUST0020
+`
+
+func TestParse(t *testing.T) {
+
+	recs, issues, err := copybook.Parse(strings.NewReader(customerCopybook))
+	require.NoError(t, err)
+	require.Len(t, recs, 2)
+
+	for _, i := range issues {
+		t.Log(i.String())
+	}
+
+	rec := recs[0]
+	require.Equal(t, "customer-rec", rec.Id)
+
+	type expected struct {
+		id     string
+		offset int
+		length int
+		typ    string
+		drop   bool
+	}
+
+	exp := []expected{
+		{"cust-id", 0, 8, fixedlengthfile.FixedLengthFieldNumeric, false},
+		{"cust-name", 8, 30, fixedlengthfile.FixedLengthFieldAlpha, false},
+		{"cust-status", 38, 1, fixedlengthfile.FixedLengthFieldAlpha, false},
+		{"filler-4", 39, 2, fixedlengthfile.FixedLengthFieldAlpha, true},
+		{"cust-balance", 41, 9, "signed-trailing(2)", false},
+		{"cust-rate", 50, 5, "decimal(4)", false},
+		{"cust-adj", 55, 6, fixedlengthfile.FixedLengthFieldDecimal, false},
+		{"phone-type-1", 61, 1, fixedlengthfile.FixedLengthFieldAlpha, false},
+		{"phone-number-1", 62, 12, fixedlengthfile.FixedLengthFieldAlpha, false},
+		{"phone-type-2", 74, 1, fixedlengthfile.FixedLengthFieldAlpha, false},
+		{"phone-number-2", 75, 12, fixedlengthfile.FixedLengthFieldAlpha, false},
+		{"cust-packed", 87, 3, fixedlengthfile.FixedLengthFieldPacked, false},
+		{"cust-display-amt", 90, 8, fixedlengthfile.FixedLengthFieldAlpha, false},
+	}
+
+	require.Len(t, rec.Fields, len(exp))
+	for i, e := range exp {
+		f := rec.Fields[i]
+		require.Equal(t, e.id, f.Id)
+		require.Equal(t, e.offset, f.Offset, e.id)
+		require.Equal(t, e.length, f.Length, e.id)
+		require.Equal(t, e.typ, f.Type, e.id)
+		require.Equal(t, e.drop, f.Drop, e.id)
+	}
+	require.Equal(t, 98, rec.Len)
+
+	require.Equal(t, "customer-trailer", recs[1].Id)
+	require.Equal(t, 46, recs[1].Len)
+
+	var lines []int
+	for _, i := range issues {
+		lines = append(lines, i.Line)
+	}
+	require.Equal(t, []int{16, 18}, lines)
+
+	_, _, err = copybook.Parse(strings.NewReader("05 A PIC X(3)."), copybook.WithFreeFormat(true))
+	require.Error(t, err)
+
+	_, _, err = copybook.Parse(strings.NewReader("01 R.\n 05 A PIC 9(3)P."), copybook.WithFreeFormat(true))
+	require.Error(t, err)
+}
@@ -0,0 +1,243 @@
+package fixedlengthfile
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	FixedLengthFieldDecimal        = "decimal"
+	FixedLengthFieldSignedTrailing = "signed-trailing"
+	FixedLengthFieldDate           = "date"
+	FixedLengthFieldBool           = "bool"
+	FixedLengthFieldPacked         = "comp-3"
+	FixedLengthFieldBinary         = "comp"
+
+	DefaultBoolTrueValue  = "Y"
+	DefaultBoolFalseValue = "N"
+)
+
+var ErrFieldTypeMismatch = errors.New("field type mismatch")
+
+// FieldType is the parsed form of the type of a field: alpha, numeric, decimal(scale), signed-trailing(scale), date(layout), bool(true/false)
+// and the binary comp-3(scale) and comp(scale).
+// The arguments are optional: the scale defaults to zero, the layout to DDMMYY and the bool values to Y/N.
+type FieldType struct {
+	Kind       string
+	Scale      int
+	Layout     string
+	TrueValue  string
+	FalseValue string
+}
+
+func ParseFieldType(s string) (FieldType, error) {
+	kind, arg, hasArg := strings.Cut(strings.TrimSpace(s), "(")
+	if hasArg {
+		if !strings.HasSuffix(arg, ")") {
+			return FieldType{}, fmt.Errorf("malformed field type %s", s)
+		}
+		arg = strings.TrimSuffix(arg, ")")
+	}
+
+	ft := FieldType{Kind: strings.TrimSpace(kind)}
+	switch ft.Kind {
+	case "":
+		ft.Kind = FixedLengthFieldAlpha
+	case FixedLengthFieldAlpha, FixedLengthFieldNumeric:
+		if hasArg {
+			return FieldType{}, fmt.Errorf("field type %s doesn't take arguments", ft.Kind)
+		}
+	case FixedLengthFieldDecimal, FixedLengthFieldSignedTrailing, FixedLengthFieldPacked, FixedLengthFieldBinary:
+		if hasArg {
+			scale, err := strconv.Atoi(strings.TrimSpace(arg))
+			if err != nil || scale < 0 {
+				return FieldType{}, fmt.Errorf("invalid scale of field type %s", s)
+			}
+			ft.Scale = scale
+		}
+	case FixedLengthFieldDate:
+		ft.Layout = DateLayout(arg)
+		if ft.Layout == "" {
+			ft.Layout = DateLayout("DDMMYY")
+		}
+	case FixedLengthFieldBool:
+		ft.TrueValue, ft.FalseValue = DefaultBoolTrueValue, DefaultBoolFalseValue
+		if hasArg {
+			t, f, ok := strings.Cut(arg, "/")
+			if !ok || t == "" || t == f {
+				return FieldType{}, fmt.Errorf("invalid values of field type %s", s)
+			}
+			ft.TrueValue, ft.FalseValue = t, f
+		}
+	default:
+		return FieldType{}, fmt.Errorf("unknown field type %s", s)
+	}
+
+	return ft, nil
+}
+
+// DateLayout converts the DD, MM, YY, YYYY, hh, mm and ss elements of a layout to the ones of the time package: DDMMYY is 020106.
+// Layouts of the time package are left as they are.
+func DateLayout(layout string) string {
+	r := strings.NewReplacer("YYYY", "2006", "YY", "06", "MM", "01", "DD", "02", "hh", "15", "mm", "04", "ss", "05")
+	return r.Replace(strings.TrimSpace(layout))
+}
+
+// FieldType parses the Type of the field.
+func (fd FixedLengthFieldDefinition) FieldType() (FieldType, error) {
+	return ParseFieldType(fd.Type)
+}
+
+// Decimal decodes the value of a numeric, decimal or signed-trailing field. Values with an explicit decimal separator, comma or dot,
+// keep their decimals, the other ones get the implied decimals of the scale. Decimal values may have a leading sign, signed-trailing values
+// have a trailing sign, either + or - or overpunched on the last digit. The values of the binary fields are the ones
+// given by DecodeBinary, with the decimals already applied. An empty value is zero.
+func (fd FixedLengthFieldDefinition) Decimal(value string) (decimal.Decimal, error) {
+	ft, err := fd.FieldType()
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return decimal.Zero, nil
+	}
+
+	neg := false
+	scale := ft.Scale
+	switch ft.Kind {
+	case FixedLengthFieldPacked, FixedLengthFieldBinary:
+		scale = 0
+		fallthrough
+	case FixedLengthFieldNumeric, FixedLengthFieldDecimal:
+		if value[0] == '+' || value[0] == '-' {
+			neg = value[0] == '-'
+			value = value[1:]
+		}
+	case FixedLengthFieldSignedTrailing:
+		value, neg, err = trailingSign(value)
+		if err != nil {
+			return decimal.Zero, err
+		}
+	default:
+		return decimal.Zero, fmt.Errorf("%w: %s is not numeric", ErrFieldTypeMismatch, ft.Kind)
+	}
+
+	explicit := strings.ContainsAny(value, ",.")
+	if strings.Count(value, ",")+strings.Count(value, ".") > 1 || strings.Trim(strings.NewReplacer(",", "", ".", "").Replace(value), "0123456789") != "" || value == "" {
+		return decimal.Zero, fmt.Errorf("invalid numeric value %s", value)
+	}
+
+	d, err := decimal.NewFromString(strings.ReplaceAll(value, ",", "."))
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	if !explicit {
+		d = d.Shift(int32(-scale))
+	}
+
+	if neg {
+		d = d.Neg()
+	}
+
+	return d, nil
+}
+
+// overpunch maps the overpunched last character of a signed-trailing value to its digit: { and A-I are positive, } and J-R negative.
+var overpunch = map[byte]struct {
+	digit byte
+	neg   bool
+}{
+	'{': {'0', false}, 'A': {'1', false}, 'B': {'2', false}, 'C': {'3', false}, 'D': {'4', false},
+	'E': {'5', false}, 'F': {'6', false}, 'G': {'7', false}, 'H': {'8', false}, 'I': {'9', false},
+	'}': {'0', true}, 'J': {'1', true}, 'K': {'2', true}, 'L': {'3', true}, 'M': {'4', true},
+	'N': {'5', true}, 'O': {'6', true}, 'P': {'7', true}, 'Q': {'8', true}, 'R': {'9', true},
+}
+
+func trailingSign(value string) (string, bool, error) {
+	last := value[len(value)-1]
+	switch {
+	case last == '+' || last == '-':
+		return strings.TrimSpace(value[:len(value)-1]), last == '-', nil
+	case last >= '0' && last <= '9':
+		return value, false, nil
+	}
+
+	if op, ok := overpunch[last]; ok {
+		return value[:len(value)-1] + string(op.digit), op.neg, nil
+	}
+
+	r, _ := utf8.DecodeLastRuneInString(value)
+	return "", false, fmt.Errorf("invalid trailing sign %q", r)
+}
+
+// IsSignedTrailing tells if the field is a zoned decimal with the sign on the last digit.
+func (fd FixedLengthFieldDefinition) IsSignedTrailing() bool {
+	ft, err := fd.FieldType()
+	return err == nil && ft.Kind == FixedLengthFieldSignedTrailing
+}
+
+// Time decodes the value of a date field. An empty value or a value of zeros is the zero time.
+func (fd FixedLengthFieldDefinition) Time(value string) (time.Time, error) {
+	ft, err := fd.FieldType()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if ft.Kind != FixedLengthFieldDate {
+		return time.Time{}, fmt.Errorf("%w: %s is not a date", ErrFieldTypeMismatch, ft.Kind)
+	}
+
+	value = strings.TrimSpace(value)
+	if strings.Trim(value, "0") == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(ft.Layout, value)
+}
+
+// Bool decodes the value of a bool field. An empty value is false, any other value not matching the true or false ones is an error.
+func (fd FixedLengthFieldDefinition) Bool(value string) (bool, error) {
+	ft, err := fd.FieldType()
+	if err != nil {
+		return false, err
+	}
+
+	if ft.Kind != FixedLengthFieldBool {
+		return false, fmt.Errorf("%w: %s is not a bool", ErrFieldTypeMismatch, ft.Kind)
+	}
+
+	value = strings.TrimSpace(value)
+	switch value {
+	case ft.TrueValue:
+		return true, nil
+	case ft.FalseValue, "":
+		return false, nil
+	}
+
+	return false, fmt.Errorf("invalid bool value %s", value)
+}
+
+// FieldError is a decoding error of a field of a record.
+type FieldError struct {
+	LineNo   int
+	RecordId string
+	Field    string
+	Value    string
+	Err      error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("line %d: record %s: field %s: value '%s': %v", e.LineNo, e.RecordId, e.Field, e.Value, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
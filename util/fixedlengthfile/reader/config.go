@@ -22,6 +22,14 @@ type Config struct {
 	EmptyLinesMode EmptyLinesMode                                `yaml:"empty-lines,omitempty" mapstructure:"empty-lines,omitempty" json:"empty-lines,omitempty"`
 	Discriminator  string                                        `yaml:"line-discriminator,omitempty" mapstructure:"line-discriminator,omitempty" json:"line-discriminator,omitempty"`
 	Records        []fixedlengthfile.FixedLengthRecordDefinition `yaml:"records,omitempty" mapstructure:"records,omitempty" json:"records,omitempty"`
+	RecordLength   int                                           `yaml:"record-length,omitempty" mapstructure:"record-length,omitempty" json:"record-length,omitempty"`
+	Encoding       string                                        `yaml:"encoding,omitempty" mapstructure:"encoding,omitempty" json:"encoding,omitempty"`
+	// CollectViolations collects the violations of the validation in the report of the reader: otherwise they are the error of the Read.
+	CollectViolations bool `yaml:"collect-violations,omitempty" mapstructure:"collect-violations,omitempty" json:"collect-violations,omitempty"`
+	// Grammar is the sequence of the records read by the group reader, as in RH (61 (62 63*)* 64)* EF. GrammarSymbols maps the symbols of
+	// the grammar to the ids of the records they stand for: the symbols not mapped are record ids.
+	Grammar        string              `yaml:"grammar,omitempty" mapstructure:"grammar,omitempty" json:"grammar,omitempty"`
+	GrammarSymbols map[string][]string `yaml:"grammar-symbols,omitempty" mapstructure:"grammar-symbols,omitempty" json:"grammar-symbols,omitempty"`
 	ioReader       io.Reader
 }
 
@@ -39,6 +47,41 @@ func WithFilename(fn string) Option {
 	}
 }
 
+// WithRecordLength reads records of the given length not separated by new lines, as the fixed block files of the host.
+func WithRecordLength(l int) Option {
+	return func(cfg *Config) {
+		cfg.RecordLength = l
+	}
+}
+
+// WithEncoding decodes the text fields with an EBCDIC code page, such as fixedlengthfile.CodePage280. It requires a record length.
+func WithEncoding(cp string) Option {
+	return func(cfg *Config) {
+		cfg.Encoding = cp
+	}
+}
+
+func WithCollectViolations(b bool) Option {
+	return func(cfg *Config) {
+		cfg.CollectViolations = b
+	}
+}
+
+func WithGrammar(g string) Option {
+	return func(cfg *Config) {
+		cfg.Grammar = g
+	}
+}
+
+func WithGrammarSymbol(symbol string, recordIds ...string) Option {
+	return func(cfg *Config) {
+		if cfg.GrammarSymbols == nil {
+			cfg.GrammarSymbols = make(map[string][]string)
+		}
+		cfg.GrammarSymbols[symbol] = recordIds
+	}
+}
+
 func WithRecord(r fixedlengthfile.FixedLengthRecordDefinition) Option {
 	return func(cfg *Config) {
 		cfg.Records = append(cfg.Records, r)
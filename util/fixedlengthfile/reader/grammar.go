@@ -0,0 +1,300 @@
+package reader
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	grammarOne      = ' '
+	grammarOptional = '?'
+	grammarStar     = '*'
+	grammarPlus     = '+'
+)
+
+type grammarNodeKind int
+
+const (
+	grammarSymbol grammarNodeKind = iota
+	grammarSequence
+	grammarAlternative
+)
+
+// grammarNode is a symbol, a sequence or an alternative of a grammar with its cardinality. The parenthesized expressions are groups.
+type grammarNode struct {
+	kind        grammarNodeKind
+	symbol      string
+	children    []*grammarNode
+	cardinality byte
+	group       bool
+	name        string
+	first       []string
+	nullable    bool
+}
+
+// Grammar is the parsed form of a grammar of records: a sequence of symbols, parenthesized groups and alternatives separated by |,
+// each one optionally followed by one of the ?, * and + cardinalities. A group can be named, as in statement:(61 (62 63*)* 64).
+type Grammar struct {
+	root    *grammarNode
+	symbols map[string][]string
+}
+
+func ParseGrammar(expr string) (*Grammar, error) {
+	tokens, err := tokenizeGrammar(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := grammarParser{tokens: tokens}
+	n, err := p.alternative()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %s at position %d of grammar %s", p.tokens[p.pos], p.pos+1, expr)
+	}
+
+	g := &Grammar{root: &grammarNode{kind: grammarSequence, children: []*grammarNode{n}, cardinality: grammarOne, group: true}, symbols: make(map[string][]string)}
+	g.root.computeFirst()
+	return g, nil
+}
+
+// Symbols are the symbols of the grammar in order of appearance.
+func (g *Grammar) Symbols() []string {
+	var symbols []string
+	g.root.walk(func(n *grammarNode) {
+		if n.kind == grammarSymbol && !containsString(symbols, n.symbol) {
+			symbols = append(symbols, n.symbol)
+		}
+	})
+	return symbols
+}
+
+// bind maps the symbols to the record ids.
+func (g *Grammar) bind(symbols map[string][]string, recordIds []string) error {
+	for _, s := range g.Symbols() {
+		ids, ok := symbols[s]
+		if !ok {
+			ids = []string{s}
+		}
+
+		for _, id := range ids {
+			if !containsString(recordIds, id) {
+				return fmt.Errorf("symbol %s of grammar refers to unknown record %s", s, id)
+			}
+		}
+
+		g.symbols[s] = ids
+	}
+
+	return nil
+}
+
+// matches tells if the record id is one of the first ones of the node.
+func (g *Grammar) matches(n *grammarNode, recordId string) bool {
+	for _, s := range n.first {
+		if containsString(g.symbols[s], recordId) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *grammarNode) walk(f func(n *grammarNode)) {
+	f(n)
+	for _, c := range n.children {
+		c.walk(f)
+	}
+}
+
+// computeFirst computes the symbols a node can start with and if it can match no record, without regard to its cardinality.
+func (n *grammarNode) computeFirst() {
+	for _, c := range n.children {
+		c.computeFirst()
+	}
+
+	switch n.kind {
+	case grammarSymbol:
+		n.first = []string{n.symbol}
+	case grammarSequence:
+		n.nullable = true
+		for _, c := range n.children {
+			n.first = appendStrings(n.first, c.first...)
+			if !c.canSkip() {
+				n.nullable = false
+				break
+			}
+		}
+	case grammarAlternative:
+		for _, c := range n.children {
+			n.first = appendStrings(n.first, c.first...)
+			n.nullable = n.nullable || c.canSkip()
+		}
+	}
+}
+
+// canSkip tells if the node, with its cardinality, can match no record.
+func (n *grammarNode) canSkip() bool {
+	return n.nullable || n.cardinality == grammarOptional || n.cardinality == grammarStar
+}
+
+type grammarParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *grammarParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *grammarParser) alternative() (*grammarNode, error) {
+	var branches []*grammarNode
+	for {
+		n, err := p.sequence()
+		if err != nil {
+			return nil, err
+		}
+		branches = append(branches, n)
+
+		if p.peek() != "|" {
+			break
+		}
+		p.pos++
+	}
+
+	if len(branches) == 1 {
+		return branches[0], nil
+	}
+
+	return &grammarNode{kind: grammarAlternative, children: branches, cardinality: grammarOne}, nil
+}
+
+func (p *grammarParser) sequence() (*grammarNode, error) {
+	var items []*grammarNode
+	for {
+		t := p.peek()
+		if t == "" || t == "|" || t == ")" {
+			break
+		}
+
+		n, err := p.item()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, n)
+	}
+
+	if len(items) == 0 {
+		return nil, errors.New("empty sequence in grammar")
+	}
+
+	if len(items) == 1 {
+		return items[0], nil
+	}
+
+	return &grammarNode{kind: grammarSequence, children: items, cardinality: grammarOne}, nil
+}
+
+func (p *grammarParser) item() (*grammarNode, error) {
+	var n *grammarNode
+
+	t := p.peek()
+	switch {
+	case t == "(":
+		p.pos++
+		inner, err := p.alternative()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.peek() != ")" {
+			return nil, errors.New("missing closing parenthesis in grammar")
+		}
+		p.pos++
+		n = &grammarNode{kind: grammarSequence, children: []*grammarNode{inner}, group: true}
+	case isGrammarOperator(t):
+		return nil, fmt.Errorf("unexpected %s in grammar", t)
+	default:
+		p.pos++
+		if p.peek() == ":" {
+			p.pos++
+			if p.peek() != "(" {
+				return nil, fmt.Errorf("group name %s not followed by a parenthesized expression", t)
+			}
+
+			g, err := p.item()
+			if err != nil {
+				return nil, err
+			}
+			g.name = t
+			return g, nil
+		}
+		n = &grammarNode{kind: grammarSymbol, symbol: t}
+	}
+
+	n.cardinality = grammarOne
+	if t := p.peek(); t == "?" || t == "*" || t == "+" {
+		n.cardinality = t[0]
+		p.pos++
+	}
+
+	return n, nil
+}
+
+func isGrammarOperator(t string) bool {
+	return len(t) == 1 && strings.Contains("()|?*+:", t)
+}
+
+func tokenizeGrammar(expr string) ([]string, error) {
+	var tokens []string
+	var sb strings.Builder
+	flush := func() {
+		if sb.Len() > 0 {
+			tokens = append(tokens, sb.String())
+			sb.Reset()
+		}
+	}
+
+	for _, c := range expr {
+		switch {
+		case unicode.IsSpace(c):
+			flush()
+		case isGrammarOperator(string(c)):
+			flush()
+			tokens = append(tokens, string(c))
+		default:
+			sb.WriteRune(c)
+		}
+	}
+	flush()
+
+	if len(tokens) == 0 {
+		return nil, errors.New("empty grammar")
+	}
+
+	return tokens, nil
+}
+
+func containsString(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func appendStrings(a []string, s ...string) []string {
+	for _, v := range s {
+		if !containsString(a, v) {
+			a = append(a, v)
+		}
+	}
+	return a
+}
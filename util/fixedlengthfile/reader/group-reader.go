@@ -0,0 +1,340 @@
+package reader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/textfile/validation"
+	"github.com/rs/zerolog/log"
+)
+
+var ErrStructure = errors.New("structural error")
+
+// StructureError is a record, or the end of the file, not allowed by the grammar at its position. It matches ErrStructure.
+type StructureError struct {
+	LineNo   int
+	RecordId string
+	Expected []string
+}
+
+func (e *StructureError) Unwrap() error {
+	return ErrStructure
+}
+
+func (e *StructureError) Error() string {
+	if e.RecordId == "" {
+		return fmt.Sprintf("unexpected end of file, expected %s", strings.Join(e.Expected, " | "))
+	}
+	return fmt.Sprintf("line %d: unexpected record %s, expected %s", e.LineNo, e.RecordId, strings.Join(e.Expected, " | "))
+}
+
+// Group is a match of the grammar, or of one of its parenthesized expressions, with the records and the nested groups in file order.
+type Group struct {
+	Name  string
+	Items []GroupItem
+}
+
+// GroupItem is either a record or a nested group.
+type GroupItem struct {
+	Record *Record
+	Group  *Group
+}
+
+// Records are the records of the group, without the ones of the nested groups.
+func (g *Group) Records() []Record {
+	var recs []Record
+	for _, it := range g.Items {
+		if it.Record != nil {
+			recs = append(recs, *it.Record)
+		}
+	}
+	return recs
+}
+
+// Groups are the nested groups, optionally restricted to the ones with the given name.
+func (g *Group) Groups(name ...string) []*Group {
+	var groups []*Group
+	for _, it := range g.Items {
+		if it.Group != nil && (len(name) == 0 || it.Group.Name == name[0]) {
+			groups = append(groups, it.Group)
+		}
+	}
+	return groups
+}
+
+// Flatten are all the records of the group, nested groups included, in file order.
+func (g *Group) Flatten() []Record {
+	var recs []Record
+	for _, it := range g.Items {
+		if it.Record != nil {
+			recs = append(recs, *it.Record)
+		} else {
+			recs = append(recs, it.Group.Flatten()...)
+		}
+	}
+	return recs
+}
+
+// GroupReader reads the records as groups matching the grammar of the config.
+type GroupReader interface {
+	Close()
+	Filename() string
+	Read() (Group, error)
+	LineNumber() int
+	Report() *validation.Report
+}
+
+type groupReaderImpl struct {
+	rdr     Reader
+	grammar *Grammar
+
+	peeked     *Record
+	peekedErr  *validation.Error
+	violations []validation.Violation
+	eof        bool
+	expected   []string
+	resync     bool
+}
+
+// NewGroupReader reads a whole match of the grammar on each Read. After a StructureError the following Read skips the records up to
+// the first one that can start the grammar. The invalid records are kept in the group: unless the violations are collected,
+// the Read returns the group together with a validation.Error of the violations of its records.
+func NewGroupReader(cfg Config, opts ...Option) (GroupReader, error) {
+	const semLogContext = "fixed-length-group-reader::new"
+
+	config := cfg
+	for _, o := range opts {
+		o(&config)
+	}
+
+	g, err := ParseGrammar(config.Grammar)
+	if err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+		return nil, err
+	}
+
+	recordIds := make([]string, 0, len(config.Records))
+	for _, r := range config.Records {
+		recordIds = append(recordIds, r.Id)
+	}
+
+	if err = g.bind(config.GrammarSymbols, recordIds); err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+		return nil, err
+	}
+
+	rdr, err := NewReader(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &groupReaderImpl{rdr: rdr, grammar: g}, nil
+}
+
+func (r *groupReaderImpl) Close() {
+	r.rdr.Close()
+}
+
+func (r *groupReaderImpl) Filename() string {
+	return r.rdr.Filename()
+}
+
+func (r *groupReaderImpl) LineNumber() int {
+	return r.rdr.LineNumber()
+}
+
+func (r *groupReaderImpl) Report() *validation.Report {
+	return r.rdr.Report()
+}
+
+func (r *groupReaderImpl) Read() (Group, error) {
+	const semLogContext = "fixed-length-group-reader::read"
+
+	rec, err := r.peek()
+	for err == nil && r.resync && rec != nil && !r.grammar.matches(r.grammar.root, rec.RecordId) {
+		log.Warn().Int("line-no", rec.LineNo).Str("record-id", rec.RecordId).Msg(semLogContext + " - record skipped")
+		r.peeked, r.peekedErr = nil, nil
+		rec, err = r.peek()
+	}
+	r.resync = false
+	r.violations = nil
+
+	if err != nil {
+		return Group{}, err
+	}
+
+	if rec == nil {
+		return Group{}, io.EOF
+	}
+
+	var g Group
+	r.expected = nil
+	err = r.matchOnce(r.grammar.root, &g)
+	if err != nil {
+		var serr *StructureError
+		if errors.As(err, &serr) {
+			log.Error().Err(err).Msg(semLogContext)
+			r.resync = true
+		}
+
+		if len(g.Items) > 0 && g.Items[0].Group != nil {
+			return *g.Items[0].Group, err
+		}
+		return Group{}, err
+	}
+
+	if len(r.violations) > 0 {
+		return *g.Items[0].Group, &validation.Error{Violations: r.violations}
+	}
+
+	return *g.Items[0].Group, nil
+}
+
+// peek returns the next record without consuming it, nil at the end of the file. Empty lines are skipped. An invalid record is
+// returned as well: its violations are kept up to the consumption of the record.
+func (r *groupReaderImpl) peek() (*Record, error) {
+	for r.peeked == nil && !r.eof {
+		rec, err := r.rdr.Read()
+		if err != nil {
+			var verr *validation.Error
+			switch {
+			case err == io.EOF:
+				r.eof = true
+				continue
+			case errors.As(err, &verr):
+				r.peekedErr = verr
+			default:
+				return nil, err
+			}
+		}
+
+		if !rec.IsEmpty() {
+			r.peeked = &rec
+		}
+	}
+
+	return r.peeked, nil
+}
+
+func (r *groupReaderImpl) matchCardinality(n *grammarNode, parent *Group) error {
+	switch n.cardinality {
+	case grammarOptional:
+		if ok, err := r.starts(n); !ok || err != nil {
+			return err
+		}
+		return r.matchOnce(n, parent)
+	case grammarStar, grammarPlus:
+		if n.cardinality == grammarPlus {
+			if err := r.matchOnce(n, parent); err != nil {
+				return err
+			}
+		}
+
+		for {
+			ok, err := r.starts(n)
+			if !ok || err != nil {
+				return err
+			}
+
+			lineNo := r.peeked.LineNo
+			if err = r.matchOnce(n, parent); err != nil {
+				return err
+			}
+
+			// a node matching no record would loop forever.
+			if r.peeked != nil && r.peeked.LineNo == lineNo {
+				return nil
+			}
+		}
+	}
+
+	return r.matchOnce(n, parent)
+}
+
+// starts tells if the next record can start the node. If not, the first symbols of the node are remembered as expected ones.
+func (r *groupReaderImpl) starts(n *grammarNode) (bool, error) {
+	rec, err := r.peek()
+	if err != nil {
+		return false, err
+	}
+
+	if rec != nil && r.grammar.matches(n, rec.RecordId) {
+		return true, nil
+	}
+
+	r.expected = appendStrings(r.expected, n.first...)
+	return false, nil
+}
+
+func (r *groupReaderImpl) matchOnce(n *grammarNode, parent *Group) error {
+	target := parent
+	if n.group {
+		target = &Group{Name: n.name}
+		parent.Items = append(parent.Items, GroupItem{Group: target})
+	}
+
+	switch n.kind {
+	case grammarSymbol:
+		rec, err := r.peek()
+		if err != nil {
+			return err
+		}
+
+		if rec == nil || !containsString(r.grammar.symbols[n.symbol], rec.RecordId) {
+			return r.structureError(rec, n.symbol)
+		}
+
+		target.Items = append(target.Items, GroupItem{Record: rec})
+		if r.peekedErr != nil {
+			r.violations = append(r.violations, r.peekedErr.Violations...)
+		}
+		r.peeked, r.peekedErr = nil, nil
+		r.expected = nil
+
+	case grammarSequence:
+		for _, c := range n.children {
+			if err := r.matchCardinality(c, target); err != nil {
+				return err
+			}
+		}
+
+	case grammarAlternative:
+		rec, err := r.peek()
+		if err != nil {
+			return err
+		}
+
+		var branch *grammarNode
+		for _, c := range n.children {
+			if rec != nil && r.grammar.matches(c, rec.RecordId) {
+				branch = c
+				break
+			}
+		}
+
+		if branch == nil {
+			for _, c := range n.children {
+				if c.canSkip() {
+					r.expected = appendStrings(r.expected, n.first...)
+					return nil
+				}
+			}
+			return r.structureError(rec, n.first...)
+		}
+
+		return r.matchCardinality(branch, target)
+	}
+
+	return nil
+}
+
+func (r *groupReaderImpl) structureError(rec *Record, expected ...string) error {
+	err := &StructureError{Expected: appendStrings(r.expected, expected...)}
+	if rec != nil {
+		err.LineNo = rec.LineNo
+		err.RecordId = rec.RecordId
+	}
+	return err
+}
@@ -4,13 +4,17 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util"
 	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/fixedlengthfile"
+	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/textfile/validation"
 	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
 )
 
 type Reader interface {
@@ -18,6 +22,7 @@ type Reader interface {
 	Filename() string
 	Read() (Record, error)
 	LineNumber() int
+	Report() *validation.Report
 }
 
 const (
@@ -35,6 +40,7 @@ type Record struct {
 	LineNo   int      `yaml:"line-no,omitempty" mapstructure:"line-no,omitempty" json:"line-no,omitempty"`
 	Fields   []string `yaml:"fields,omitempty" mapstructure:"fields,omitempty" json:"fields,omitempty"`
 	fieldMap map[string]int
+	defs     []fixedlengthfile.FixedLengthFieldDefinition
 }
 
 func (r *Record) String() string {
@@ -106,6 +112,71 @@ func (r *Record) GetAsInt(n string, opts ...GetPropertyOption) int {
 	return i
 }
 
+// GetDecimal decodes a numeric, decimal or signed-trailing field. A missing field is zero.
+func (r *Record) GetDecimal(n string, opts ...GetPropertyOption) (decimal.Decimal, error) {
+	v, fd, ok := r.getTyped(n, opts...)
+	if !ok {
+		return decimal.Zero, nil
+	}
+
+	d, err := fd.Decimal(v)
+	if err != nil {
+		return decimal.Zero, r.fieldError(n, v, err)
+	}
+	return d, nil
+}
+
+// GetTime decodes a date field. A missing field is the zero time.
+func (r *Record) GetTime(n string, opts ...GetPropertyOption) (time.Time, error) {
+	v, fd, ok := r.getTyped(n, opts...)
+	if !ok {
+		return time.Time{}, nil
+	}
+
+	t, err := fd.Time(v)
+	if err != nil {
+		return time.Time{}, r.fieldError(n, v, err)
+	}
+	return t, nil
+}
+
+// GetBool decodes a bool field. A missing field is false.
+func (r *Record) GetBool(n string, opts ...GetPropertyOption) (bool, error) {
+	v, fd, ok := r.getTyped(n, opts...)
+	if !ok {
+		return false, nil
+	}
+
+	b, err := fd.Bool(v)
+	if err != nil {
+		return false, r.fieldError(n, v, err)
+	}
+	return b, nil
+}
+
+func (r *Record) getTyped(n string, opts ...GetPropertyOption) (string, fixedlengthfile.FixedLengthFieldDefinition, bool) {
+	v, ok := r.GetWithIndicator(n, opts...)
+	if !ok {
+		return v, fixedlengthfile.FixedLengthFieldDefinition{}, false
+	}
+	return v, r.defs[r.fieldMap[n]], true
+}
+
+func (r *Record) fieldError(n string, v string, err error) error {
+	return &fixedlengthfile.FieldError{LineNo: r.LineNo, RecordId: r.RecordId, Field: n, Value: v, Err: err}
+}
+
+// Map is the map of the values of the fields by id.
+func (r *Record) Map() map[string]interface{} {
+	m := make(map[string]interface{}, len(r.fieldMap))
+	for k, i := range r.fieldMap {
+		if i < len(r.Fields) {
+			m[k] = r.Fields[i]
+		}
+	}
+	return m
+}
+
 func (r *Record) GetWithIndicator(n string, opts ...GetPropertyOption) (string, bool) {
 	options := GerPropertyOptions{defaultValueOnEmpty: true}
 	for _, o := range opts {
@@ -135,9 +206,17 @@ func (r *Record) GetWithIndicator(n string, opts ...GetPropertyOption) (string,
 	return v, ok
 }
 
-func (pr *Record) parse(l []byte, definition fixedlengthfile.FixedLengthRecordDefinition) error {
+// parse splits the fields of the record. The binary fields are decoded to the text of their value, the other ones with the code page, if any.
+func (pr *Record) parse(l []byte, definition fixedlengthfile.FixedLengthRecordDefinition, cp *fixedlengthfile.CodePage) error {
 
 	pr.Fields = make([]string, len(definition.Fields)-definition.NumOfDroppedFields(), len(definition.Fields)-definition.NumOfDroppedFields())
+	pr.defs = make([]fixedlengthfile.FixedLengthFieldDefinition, 0, len(pr.Fields))
+	for _, f := range definition.Fields {
+		if !f.Drop {
+			pr.defs = append(pr.defs, f)
+		}
+	}
+
 	fndx := 0
 	for _, f := range definition.Fields {
 
@@ -154,8 +233,21 @@ func (pr *Record) parse(l []byte, definition fixedlengthfile.FixedLengthRecordDe
 			lenField = len(l) - f.Offset
 		}
 
-		res := string(l[f.Offset : f.Offset+lenField])
-		pr.Fields[fndx] = f.Sscanf(res)
+		b := l[f.Offset : f.Offset+lenField]
+		switch {
+		case f.IsBinary():
+			v, err := f.DecodeBinary(b)
+			if err != nil {
+				return &fixedlengthfile.FieldError{LineNo: pr.LineNo, RecordId: pr.RecordId, Field: f.Id, Value: fmt.Sprintf("%X", b), Err: err}
+			}
+			pr.Fields[fndx] = v
+		case cp != nil && f.IsSignedTrailing():
+			pr.Fields[fndx] = f.Sscanf(cp.DecodeZoned(b))
+		case cp != nil:
+			pr.Fields[fndx] = f.Sscanf(cp.Decode(b))
+		default:
+			pr.Fields[fndx] = f.Sscanf(string(b))
+		}
 		fndx++
 	}
 
@@ -173,6 +265,9 @@ type readerImpl struct {
 	osFile        *os.File
 	lineNumber    int
 	discriminator Discriminator
+	codePage      *fixedlengthfile.CodePage
+	validator     *validation.Validator
+	report        validation.Report
 	logger        util.GeometricTraceLogger
 }
 
@@ -202,24 +297,48 @@ func NewReader(cfg Config, opts ...Option) (Reader, error) {
 		return nil, err
 	}
 
+	if config.RecordLength < 0 {
+		err = fmt.Errorf("invalid record length %d", config.RecordLength)
+		log.Error().Err(err).Msg(semLogContext)
+		return nil, err
+	}
+
+	// the EBCDIC files have no new lines.
+	if config.Encoding != "" && config.RecordLength == 0 {
+		err = fmt.Errorf("encoding %s without record length", config.Encoding)
+		log.Error().Err(err).Msg(semLogContext)
+		return nil, err
+	}
+
 	r := &readerImpl{
-		cfg:    config,
-		logger: util.GeometricTraceLogger{},
+		cfg:       config,
+		validator: validation.NewValidator(),
+		logger:    util.GeometricTraceLogger{},
+	}
+
+	r.codePage, err = fixedlengthfile.LookupCodePage(config.Encoding)
+	if err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+		return nil, err
 	}
 
 	if config.Discriminator == DiscriminatorModePrefix {
 		r.discriminator = DiscriminatorFunc(PrefixDiscriminator)
 	}
 
-	for i := 0; i < len(cfg.Records); i++ {
-		err = cfg.Records[i].AdjustFieldInfoIndex()
+	for i := 0; i < len(config.Records); i++ {
+		err = config.Records[i].AdjustFieldInfoIndex()
 		if err != nil {
 			log.Error().Err(err).Msg(semLogContext)
 			return nil, err
 		}
 
-		cfg.Records[i].ComputeFieldMap()
-		log.Info().Str("rec-id", cfg.Records[i].Id).Int("number-of-fields", len(cfg.Records[i].Fields)).Msg(semLogContext)
+		config.Records[i].ComputeFieldMap()
+		if err = r.validator.AddRecordRules(config.Records[i].Id, config.Records[i].Rules); err != nil {
+			log.Error().Err(err).Msg(semLogContext)
+			return nil, err
+		}
+		log.Info().Str("rec-id", config.Records[i].Id).Int("number-of-fields", len(config.Records[i].Fields)).Msg(semLogContext)
 	}
 
 	if config.ioReader != nil {
@@ -278,11 +397,11 @@ func (w *readerImpl) Read() (Record, error) {
 
 func (w *readerImpl) read() (Record, error) {
 
-	l, _, err := w.ioReader.ReadLine()
+	l, err := w.readRecord()
 	if err == nil {
 		w.lineNumber++
 
-		rId, err := w.discriminateLine(w.lineNumber, string(l))
+		rId, err := w.discriminateLine(w.lineNumber, w.decode(l))
 		if err != nil {
 			return Record{RecordId: ErrRecordId, LineNo: w.lineNumber}, err
 		}
@@ -305,17 +424,71 @@ func (w *readerImpl) read() (Record, error) {
 			fieldMap: r.FieldMap,
 		}
 
-		err = pr.parse(l, r)
+		err = pr.parse(l, r, w.codePage)
 		if err != nil {
 			return Record{RecordId: ErrRecordId, LineNo: w.lineNumber}, err
 		}
 
+		violations := w.validate(pr, r)
+		w.report.Add(violations)
+		if len(violations) > 0 && !w.cfg.CollectViolations {
+			return pr, &validation.Error{Violations: violations}
+		}
+
 		return pr, nil
 	}
 
 	return EofRecord, err
 }
 
+// Report is the validation report of the records read so far.
+func (w *readerImpl) Report() *validation.Report {
+	return &w.report
+}
+
+// validate checks the validation tags of the fields and then the rules of the record.
+func (w *readerImpl) validate(pr Record, def fixedlengthfile.FixedLengthRecordDefinition) []validation.Violation {
+	var violations []validation.Violation
+	for i, f := range pr.defs {
+		fId := f.Id
+		if fId == "" {
+			fId = f.Name
+		}
+
+		if violation, ok := w.validator.ValidateField(pr.LineNo, pr.RecordId, validation.FieldRule{Field: fId, Tag: f.Validation, Help: f.Help}, pr.Fields[i]); !ok {
+			violations = append(violations, violation)
+		}
+	}
+
+	if w.validator.HasRules(def.Id) {
+		violations = append(violations, w.validator.ValidateRecord(pr.LineNo, pr.RecordId, pr.Map())...)
+	}
+
+	return violations
+}
+
+// readRecord reads a line or, in record length mode, the bytes of a record.
+func (w *readerImpl) readRecord() ([]byte, error) {
+	if w.cfg.RecordLength == 0 {
+		l, _, err := w.ioReader.ReadLine()
+		return l, err
+	}
+
+	l := make([]byte, w.cfg.RecordLength)
+	n, err := io.ReadFull(w.ioReader, l)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = fmt.Errorf("truncated record of %d bytes at record %d", n, w.lineNumber+1)
+	}
+	return l, err
+}
+
+func (w *readerImpl) decode(l []byte) string {
+	if w.codePage == nil {
+		return string(l)
+	}
+	return w.codePage.Decode(l)
+}
+
 func (w *readerImpl) discriminateLine(lineno int, l string) (string, error) {
 
 	var err error
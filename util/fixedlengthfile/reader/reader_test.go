@@ -6,9 +6,12 @@ import (
 	"fmt"
 	"io"
 	"testing"
+	"time"
 
 	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/fixedlengthfile"
 	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/fixedlengthfile/reader"
+	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/fixedlengthfile/writer"
+	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/textfile/validation"
 	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/require"
 )
@@ -73,3 +76,451 @@ func TestNewReader(t *testing.T) {
 
 	rdr.Close()
 }
+
+func TestGroupReader(t *testing.T) {
+
+	cfg := reader.Config{
+		Discriminator:  reader.DiscriminatorModePrefix,
+		EmptyLinesMode: reader.EmptyLinesModeSkip,
+		Records: []fixedlengthfile.FixedLengthRecordDefinition{
+			reader.RHDefinition,
+			reader.RHEFDefinition,
+			reader.RH61Definition,
+			reader.RH62Definition,
+			reader.RH63Definition_KKK,
+			reader.RH63Definition_YYY,
+			reader.RH63Definition_YY2,
+			reader.RH63Definition_ZZ1,
+			reader.RH63Definition_ZZ2,
+			reader.RH63Definition_ZZ3,
+			reader.RH63Definition_ID1,
+			reader.RH63Definition_RI1,
+			reader.RH63Definition_RI2,
+			reader.RH63Definition_Else,
+			reader.RH64Definition,
+			reader.RH65Definition,
+		},
+		Grammar:        reader.RHGrammar,
+		GrammarSymbols: reader.RHGrammarSymbols,
+	}
+
+	rdr, err := reader.NewGroupReader(cfg, reader.WithIoReader(bytes.NewReader(example)))
+	require.NoError(t, err)
+	defer rdr.Close()
+
+	var movements []int
+	g, err := rdr.Read()
+	for err == nil {
+		recs := g.Records()
+		require.Len(t, recs, 2)
+		require.Equal(t, "RH", recs[0].RecordId)
+		require.Equal(t, "RH-EF", recs[1].RecordId)
+
+		statements := g.Groups("statement")
+		require.Len(t, statements, 1)
+		require.Equal(t, "RH-61", statements[0].Records()[0].RecordId)
+		movements = append(movements, len(statements[0].Groups("movement")))
+
+		for _, m := range statements[0].Groups("movement") {
+			require.Equal(t, "RH-62", m.Items[0].Record.RecordId)
+		}
+
+		g, err = rdr.Read()
+	}
+
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, []int{10, 45}, movements)
+}
+
+func TestGroupReaderStructureErrors(t *testing.T) {
+
+	var recs []fixedlengthfile.FixedLengthRecordDefinition
+	for _, id := range []string{"H", "O", "M", "D", "C", "T"} {
+		recs = append(recs, fixedlengthfile.FixedLengthRecordDefinition{
+			Id:                  id,
+			PrefixDiscriminator: id,
+			Fields:              []fixedlengthfile.FixedLengthFieldDefinition{{Id: "record-type", Length: 1}, {Id: "data", Length: 3}},
+		})
+	}
+
+	cfg := reader.Config{Discriminator: reader.DiscriminatorModePrefix, Records: recs}
+
+	_, err := reader.NewGroupReader(cfg, reader.WithIoReader(bytes.NewReader(nil)), reader.WithGrammar("H (O (M D*)* C)* X"))
+	require.Error(t, err)
+
+	_, err = reader.NewGroupReader(cfg, reader.WithIoReader(bytes.NewReader(nil)), reader.WithGrammar("H (O (M D*)* C* T"))
+	require.Error(t, err)
+
+	lines := "H001\n" + "O001\n" + "M001\n" + "D001\n" + "D002\n" + "C001\n" + "T001\n" +
+		"H002\n" + "M002\n" + "D003\n" + "C002\n" + "T002\n" +
+		"H003\n" + "O003\n" + "C003\n" + "T003\n" +
+		"H004\n" + "O004\n"
+
+	rdr, err := reader.NewGroupReader(cfg, reader.WithIoReader(bytes.NewReader([]byte(lines))), reader.WithGrammar("H file:(O mov:(M D*)* C)* T"))
+	require.NoError(t, err)
+	defer rdr.Close()
+
+	g, err := rdr.Read()
+	require.NoError(t, err)
+	require.Len(t, g.Flatten(), 7)
+	require.Len(t, g.Groups("file")[0].Groups("mov")[0].Records(), 3)
+
+	var serr *reader.StructureError
+	g, err = rdr.Read()
+	require.ErrorIs(t, err, reader.ErrStructure)
+	require.ErrorAs(t, err, &serr)
+	require.Equal(t, 9, serr.LineNo)
+	require.Equal(t, "M", serr.RecordId)
+	require.Equal(t, []string{"O", "T"}, serr.Expected)
+	require.Len(t, g.Records(), 1)
+
+	g, err = rdr.Read()
+	require.NoError(t, err)
+	require.Equal(t, "003", g.Records()[0].Get("data"))
+
+	_, err = rdr.Read()
+	require.ErrorAs(t, err, &serr)
+	require.Equal(t, "", serr.RecordId)
+	require.Equal(t, []string{"M", "C"}, serr.Expected)
+
+	_, err = rdr.Read()
+	require.Equal(t, io.EOF, err)
+}
+
+func TestGroupReaderViolations(t *testing.T) {
+
+	var recs []fixedlengthfile.FixedLengthRecordDefinition
+	for _, id := range []string{"H", "D", "T"} {
+		recs = append(recs, fixedlengthfile.FixedLengthRecordDefinition{
+			Id:                  id,
+			PrefixDiscriminator: id,
+			Fields:              []fixedlengthfile.FixedLengthFieldDefinition{{Id: "record-type", Length: 1}, {Id: "data", Length: 3, Validation: "numeric"}},
+		})
+	}
+
+	cfg := reader.Config{Discriminator: reader.DiscriminatorModePrefix, Records: recs, Grammar: "H D* T"}
+	lines := "H001\n" + "D001\n" + "D0X2\n" + "T001\n" + "H002\n" + "D003\n" + "T00X\n"
+
+	rdr, err := reader.NewGroupReader(cfg, reader.WithIoReader(bytes.NewReader([]byte(lines))))
+	require.NoError(t, err)
+	defer rdr.Close()
+
+	var verr *validation.Error
+	g, err := rdr.Read()
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Violations, 1)
+	require.Equal(t, 3, verr.Violations[0].LineNo)
+	require.Len(t, g.Flatten(), 4)
+
+	g, err = rdr.Read()
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Violations, 1)
+	require.Equal(t, 7, verr.Violations[0].LineNo)
+	require.Len(t, g.Flatten(), 3)
+
+	_, err = rdr.Read()
+	require.Equal(t, io.EOF, err)
+
+	rdr, err = reader.NewGroupReader(cfg, reader.WithIoReader(bytes.NewReader([]byte(lines))), reader.WithCollectViolations(true))
+	require.NoError(t, err)
+	defer rdr.Close()
+
+	for _, err = rdr.Read(); err == nil; _, err = rdr.Read() {
+	}
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, 2, rdr.Report().InvalidRecords)
+}
+
+func TestTypedFields(t *testing.T) {
+
+	cfg := reader.Config{
+		Discriminator: reader.DiscriminatorModePrefix,
+		Records: []fixedlengthfile.FixedLengthRecordDefinition{
+			reader.RH62Definition,
+			{
+				Id:                  "TYPED",
+				PrefixDiscriminator: "T",
+				Fields: []fixedlengthfile.FixedLengthFieldDefinition{
+					{Id: "record-type", Length: 1, Drop: true},
+					{Id: "amount", Length: 6, Type: "decimal(2)"},
+					{Id: "signed", Length: 5, Type: "signed-trailing(1)"},
+					{Id: "overpunched", Length: 4, Type: "signed-trailing(2)"},
+					{Id: "date", Length: 8, Type: "date(YYYYMMDD)"},
+					{Id: "flag", Length: 1, Type: "bool(S/N)"},
+				},
+			},
+		},
+	}
+
+	lines := " 620000001001110523110523C000000006000,0048                                           Bonifico SEPA Italia a Vs. favore \n" +
+		"T0001251234-002J20230511S\n" +
+		"T00A25001234000020231341X\n"
+
+	rdr, err := reader.NewReader(cfg, reader.WithIoReader(bytes.NewReader([]byte(lines))))
+	require.NoError(t, err)
+	defer rdr.Close()
+
+	r, err := rdr.Read()
+	require.NoError(t, err)
+
+	amount, err := r.GetDecimal("movmntamount")
+	require.NoError(t, err)
+	require.Equal(t, "6000", amount.String())
+
+	valueDate, err := r.GetTime("value-date")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2023, time.May, 11, 0, 0, 0, 0, time.UTC), valueDate)
+
+	_, err = r.GetTime("movmntamount")
+	require.ErrorIs(t, err, fixedlengthfile.ErrFieldTypeMismatch)
+
+	r, err = rdr.Read()
+	require.NoError(t, err)
+
+	amount, err = r.GetDecimal("amount")
+	require.NoError(t, err)
+	require.Equal(t, "1.25", amount.String())
+
+	signed, err := r.GetDecimal("signed")
+	require.NoError(t, err)
+	require.Equal(t, "-123.4", signed.String())
+
+	overpunched, err := r.GetDecimal("overpunched")
+	require.NoError(t, err)
+	require.Equal(t, "-0.21", overpunched.String())
+
+	flag, err := r.GetBool("flag")
+	require.NoError(t, err)
+	require.True(t, flag)
+
+	r, err = rdr.Read()
+	require.NoError(t, err)
+
+	var fe *fixedlengthfile.FieldError
+	_, err = r.GetDecimal("amount")
+	require.ErrorAs(t, err, &fe)
+	require.Equal(t, 3, fe.LineNo)
+	require.Equal(t, "amount", fe.Field)
+
+	_, err = r.GetTime("date")
+	require.ErrorAs(t, err, &fe)
+	require.Equal(t, "date", fe.Field)
+
+	_, err = r.GetBool("flag")
+	require.Error(t, err)
+}
+
+func TestValidation(t *testing.T) {
+
+	cfg := reader.Config{
+		Discriminator: reader.DiscriminatorModePrefix,
+		Records: []fixedlengthfile.FixedLengthRecordDefinition{
+			{
+				Id:                  "MOV",
+				PrefixDiscriminator: "M",
+				Fields: []fixedlengthfile.FixedLengthFieldDefinition{
+					{Id: "record-type", Length: 1, Drop: true},
+					{Id: "code", Length: 5, Validation: "numeric"},
+					{Id: "sign", Length: 1},
+					{Id: "currency", Length: 3, Validation: "oneof=EUR USD", Help: "currency not supported"},
+				},
+				Rules: []validation.RecordRule{
+					{Id: "sign", Expression: `$.sign == "C" || $.sign == "D"`},
+					{Id: "usd-credit", Expression: `{$.currency} != "USD" || {$.sign} == "C"`, Message: "USD movements must be credits"},
+				},
+			},
+		},
+	}
+
+	lines := "M00001CEUR\n" +
+		"M0000XDEUR\n" +
+		"M00003XGBP\n" +
+		"M00004DUSD\n"
+
+	rdr, err := reader.NewReader(cfg, reader.WithIoReader(bytes.NewReader([]byte(lines))))
+	require.NoError(t, err)
+
+	_, err = rdr.Read()
+	require.NoError(t, err)
+
+	var verr *validation.Error
+	r, err := rdr.Read()
+	require.ErrorIs(t, err, validation.ErrInvalidRecord)
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Violations, 1)
+	require.Equal(t, "code", verr.Violations[0].Field)
+	require.Equal(t, "MOV", r.RecordId)
+	rdr.Close()
+
+	rdr, err = reader.NewReader(cfg, reader.WithIoReader(bytes.NewReader([]byte(lines))), reader.WithCollectViolations(true))
+	require.NoError(t, err)
+	defer rdr.Close()
+
+	for _, err = rdr.Read(); err == nil; _, err = rdr.Read() {
+	}
+	require.Equal(t, io.EOF, err)
+
+	report := rdr.Report()
+	t.Log(report.String())
+	require.Equal(t, 4, report.NumOfRecords)
+	require.Equal(t, 3, report.InvalidRecords)
+
+	byLine := report.ByLine()
+	require.Len(t, byLine[2], 1)
+	require.Len(t, byLine[3], 2)
+	require.Equal(t, "currency not supported", byLine[3][0].Message)
+	require.Equal(t, "sign", byLine[3][1].Rule)
+	require.Len(t, byLine[4], 1)
+	require.Equal(t, "USD movements must be credits", byLine[4][0].Message)
+
+	// the records of the options have their rules too.
+	rdr, err = reader.NewReader(reader.Config{Discriminator: reader.DiscriminatorModePrefix}, reader.WithRecord(cfg.Records[0]),
+		reader.WithIoReader(bytes.NewReader([]byte(lines))), reader.WithCollectViolations(true))
+	require.NoError(t, err)
+	defer rdr.Close()
+
+	for _, err = rdr.Read(); err == nil; _, err = rdr.Read() {
+	}
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, 3, rdr.Report().InvalidRecords)
+}
+
+func TestEbcdicRecords(t *testing.T) {
+
+	rec := fixedlengthfile.FixedLengthRecordDefinition{
+		Id:         "HOST",
+		LengthMode: fixedlengthfile.FixedLengthRecordModeAtLeast,
+		Fields: []fixedlengthfile.FixedLengthFieldDefinition{
+			{Id: "name", Length: 6, Format: fixedlengthfile.FieldFormat{Trim: true}},
+			{Id: "amount", Length: 3, Type: "comp-3(2)"},
+			{Id: "count", Length: 4, Type: "comp"},
+		},
+	}
+
+	var buf bytes.Buffer
+	w, err := writer.NewWriter(writer.Config{Records: []fixedlengthfile.FixedLengthRecordDefinition{rec}}, writer.WithIoWriter(&buf), writer.WithRecordLength(16), writer.WithEncoding(fixedlengthfile.CodePage280))
+	require.NoError(t, err)
+
+	for _, v := range [][]interface{}{{"città", "-123.45", -2}, {"perché", "10", 70000}} {
+		r, err := w.NewRecord("HOST")
+		require.NoError(t, err)
+		require.NoError(t, r.Set("name", v[0]))
+		require.NoError(t, r.Set("amount", v[1]))
+		require.NoError(t, r.Set("count", v[2]))
+		require.NoError(t, w.WriteRecord(r))
+	}
+
+	r, err := w.NewRecord("HOST")
+	require.NoError(t, err)
+	require.Error(t, r.Set("amount", "123456"))
+	w.Close(false)
+
+	b := buf.Bytes()
+	require.Len(t, b, 32)
+	require.Equal(t, []byte{0x83, 0x89, 0xA3, 0xA3, 0xC0, 0x40}, b[:6])
+	require.Equal(t, []byte{0x12, 0x34, 0x5D, 0xFF, 0xFF, 0xFF, 0xFE, 0x40, 0x40, 0x40}, b[6:16])
+
+	rdr, err := reader.NewReader(reader.Config{Records: []fixedlengthfile.FixedLengthRecordDefinition{rec}}, reader.WithIoReader(bytes.NewReader(b)), reader.WithRecordLength(16), reader.WithEncoding(fixedlengthfile.CodePage280))
+	require.NoError(t, err)
+	defer rdr.Close()
+
+	type expected struct {
+		name   string
+		amount string
+		count  string
+	}
+
+	for _, e := range []expected{{"città", "-123.45", "-2"}, {"perché", "10", "70000"}} {
+		r, err := rdr.Read()
+		require.NoError(t, err)
+		require.Equal(t, e.name, r.Get("name"))
+
+		amount, err := r.GetDecimal("amount")
+		require.NoError(t, err)
+		require.Equal(t, e.amount, amount.String())
+		require.Equal(t, e.count, r.Get("count"))
+	}
+
+	_, err = rdr.Read()
+	require.ErrorIs(t, err, io.EOF)
+
+	_, err = writer.NewWriter(writer.Config{Records: []fixedlengthfile.FixedLengthRecordDefinition{rec}}, writer.WithIoWriter(&buf), writer.WithEncoding(fixedlengthfile.CodePage280))
+	require.Error(t, err)
+
+	_, err = reader.NewReader(reader.Config{Records: []fixedlengthfile.FixedLengthRecordDefinition{rec}}, reader.WithIoReader(bytes.NewReader(b)), reader.WithEncoding(fixedlengthfile.CodePage280))
+	require.Error(t, err)
+
+	rdr, err = reader.NewReader(reader.Config{Records: []fixedlengthfile.FixedLengthRecordDefinition{rec}}, reader.WithIoReader(bytes.NewReader(b[:20])), reader.WithRecordLength(16))
+	require.NoError(t, err)
+	_, err = rdr.Read()
+	require.NoError(t, err)
+	_, err = rdr.Read()
+	require.Error(t, err)
+	require.NotErrorIs(t, err, io.EOF)
+}
+
+func TestEbcdicZonedDecimals(t *testing.T) {
+
+	rec := fixedlengthfile.FixedLengthRecordDefinition{
+		Id:     "ZONED",
+		Fields: []fixedlengthfile.FixedLengthFieldDefinition{{Id: "amount", Length: 5, Type: "signed-trailing(2)"}},
+	}
+
+	// the sign bytes 0xC0 and 0xD0 are à and è in cp280.
+	b := []byte{
+		0xF1, 0xF0, 0xF0, 0xF0, 0xD0,
+		0xF1, 0xF0, 0xF0, 0xF0, 0xC0,
+		0xF1, 0xF0, 0xF0, 0xF2, 0xD5,
+		0xF1, 0xF0, 0xF0, 0xF2, 0xF5,
+	}
+
+	rdr, err := reader.NewReader(reader.Config{Records: []fixedlengthfile.FixedLengthRecordDefinition{rec}}, reader.WithIoReader(bytes.NewReader(b)), reader.WithRecordLength(5), reader.WithEncoding(fixedlengthfile.CodePage280))
+	require.NoError(t, err)
+	defer rdr.Close()
+
+	for _, e := range []string{"-100", "100", "-100.25", "100.25"} {
+		r, err := rdr.Read()
+		require.NoError(t, err)
+
+		amount, err := r.GetDecimal("amount")
+		require.NoError(t, err)
+		require.Equal(t, e, amount.String())
+	}
+
+	_, err = rec.Fields[0].Decimal("100à")
+	require.EqualError(t, err, `invalid trailing sign 'à'`)
+}
+
+func TestValidationDashedFieldIds(t *testing.T) {
+
+	for expr, wanted := range map[string]string{
+		`$.movmnt-sign == "C"`: `{$["movmnt-sign"]} == "C"`,
+		`$.amount-1 > 0`:       `{$.amount}-1 > 0`,
+		`$.a-$.b`:              `{$.a}-{$.b}`,
+		`$.a - b`:              `{$.a} - b`,
+	} {
+		require.Equal(t, wanted, validation.BareJsonPathToReference(expr), expr)
+	}
+
+	rh62 := reader.RH62Definition
+	rh62.Rules = []validation.RecordRule{
+		{Id: "credit", Expression: `$.movmnt-sign == "C" && $.cbi-reason == "48"`},
+	}
+
+	lines := " 620000001001110523110523C000000006000,0048                                           Bonifico SEPA Italia a Vs. favore \n" +
+		" 620000001002110523110523D000000006000,0048                                           Bonifico SEPA Italia a Vs. favore \n"
+
+	rdr, err := reader.NewReader(reader.Config{Discriminator: reader.DiscriminatorModePrefix, Records: []fixedlengthfile.FixedLengthRecordDefinition{rh62}},
+		reader.WithIoReader(bytes.NewReader([]byte(lines))), reader.WithCollectViolations(true))
+	require.NoError(t, err)
+	defer rdr.Close()
+
+	for _, err = rdr.Read(); err == nil; _, err = rdr.Read() {
+	}
+	require.Equal(t, io.EOF, err)
+
+	byLine := rdr.Report().ByLine()
+	require.Len(t, byLine, 1)
+	require.Len(t, byLine[2], 1)
+	require.Equal(t, "credit", byLine[2][0].Rule)
+}
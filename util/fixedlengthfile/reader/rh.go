@@ -4,6 +4,23 @@ import (
 	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/fixedlengthfile"
 )
 
+// RHGrammar is the structure of a CBI RH file: the RH header, the statements made of the 61 opening, the 62 movements with their 63 details,
+// the 64 closing and the optional 65 cash balances, and the EF trailer.
+const RHGrammar = "RH statement:(61 movement:(62 63*)* 64 65?)* EF"
+
+var RHGrammarSymbols = map[string][]string{
+	"RH": {RHDefinition.Id},
+	"61": {RH61Definition.Id},
+	"62": {RH62Definition.Id},
+	"63": {
+		RH63Definition_KKK.Id, RH63Definition_YYY.Id, RH63Definition_YY2.Id, RH63Definition_ZZ1.Id, RH63Definition_ZZ2.Id,
+		RH63Definition_ZZ3.Id, RH63Definition_ID1.Id, RH63Definition_RI1.Id, RH63Definition_RI2.Id, RH63Definition_Else.Id,
+	},
+	"64": {RH64Definition.Id},
+	"65": {RH65Definition.Id},
+	"EF": {RHEFDefinition.Id},
+}
+
 var RHDefinition = fixedlengthfile.FixedLengthRecordDefinition{
 	Id:                  "RH",
 	PrefixDiscriminator: " RH",
@@ -12,7 +29,7 @@ var RHDefinition = fixedlengthfile.FixedLengthRecordDefinition{
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "record-type", Name: "record-type", Length: 2},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "sender", Name: "sender", Length: 5},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "recipient", Name: "recipient", Length: 5},
-		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "creation-date", Name: "creation-date", Length: 6},
+		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Type: "date(DDMMYY)", Id: "creation-date", Name: "creation-date", Length: 6},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "support-name", Name: "support-name", Length: 20},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: true, Id: "filler-2", Name: "filler-2", Length: 76},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: true, Id: "field-na", Name: "field-na", Length: 5},
@@ -27,7 +44,7 @@ var RHEFDefinition = fixedlengthfile.FixedLengthRecordDefinition{
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "record-type", Name: "record-type", Length: 2},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "sender", Name: "sender", Length: 5},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "recipient", Name: "recipient", Length: 5},
-		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "creation-date", Name: "creation-date", Length: 6},
+		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Type: "date(DDMMYY)", Id: "creation-date", Name: "creation-date", Length: 6},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "support-name", Name: "support-name", Length: 20},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: true, Id: "filler-2", Name: "filler-2", Length: 6},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "no-statements", Name: "no-statements", Length: 7},
@@ -56,9 +73,9 @@ var RH61Definition = fixedlengthfile.FixedLengthRecordDefinition{
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "bank-cab", Name: "bank-cab", Length: 5},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "current-account-code", Name: "current-account-code", Length: 12},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "currency-code", Name: "currency-code", Length: 3},
-		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "accounting-date", Name: "accounting-date", Length: 6},
+		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Type: "date(DDMMYY)", Id: "accounting-date", Name: "accounting-date", Length: 6},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "sign", Name: "sign", Length: 1},
-		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "opening-balance", Name: "opening-balance", Length: 15},
+		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Type: "decimal(2)", Id: "opening-balance", Name: "opening-balance", Length: 15},
 		// {Format: fixedlengthfile.FieldFormat{ Trim: true }, Drop: false,  Id: "more-iban-details", Name: "more-iban-details", Length: 4},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "country-code", Name: "country-code", Length: 2},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "check-digit", Name: "check-digit", Length: 2},
@@ -74,10 +91,10 @@ var RH62Definition = fixedlengthfile.FixedLengthRecordDefinition{
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "record-type", Name: "record-type", Length: 2},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "progr-number", Name: "progr-number", Length: 7},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "movmnt-progr-number", Name: "movmnt-progr-number", Length: 3},
-		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "value-date", Name: "value-date", Length: 6},
-		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "accounting-date", Name: "accounting-date", Length: 6},
+		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Type: "date(DDMMYY)", Id: "value-date", Name: "value-date", Length: 6},
+		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Type: "date(DDMMYY)", Id: "accounting-date", Name: "accounting-date", Length: 6},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "movmnt-sign", Name: "movmnt-sign", Length: 1},
-		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "movmntamount", Name: "movmntamount", Length: 15},
+		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Type: "decimal(2)", Id: "movmntamount", Name: "movmntamount", Length: 15},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "cbi-reason", Name: "cbi-reason", Length: 2},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "internal-reason", Name: "internal-reason", Length: 2},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "cheque-number", Name: "cheque-number", Length: 16},
@@ -110,7 +127,7 @@ var RH63Definition_YYY = fixedlengthfile.FixedLengthRecordDefinition{
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "progr-number", Name: "progr-number", Length: 7},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "movmnt-progr-number", Name: "movmnt-progr-number", Length: 3},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "structure-flag", Name: "structure-flag", Length: 3},
-		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "order-date", Name: "order-date", Length: 8},
+		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Type: "date(DDMMYYYY)", Id: "order-date", Name: "order-date", Length: 8},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "ordering-prty--taxpayer-code", Name: "ordering-prty--taxpayer-code", Length: 16},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "ordering-prty-descr", Name: "ordering-prty-descr", Length: 40},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "country", Name: "country", Length: 40},
@@ -242,11 +259,11 @@ var RH64Definition = fixedlengthfile.FixedLengthRecordDefinition{
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "record-type", Name: "record-type", Length: 2},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "progr-number", Name: "progr-number", Length: 7},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "currency-code", Name: "currency-code", Length: 3},
-		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "accounting-date", Name: "accounting-date", Length: 6},
+		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Type: "date(DDMMYY)", Id: "accounting-date", Name: "accounting-date", Length: 6},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "accounts-balance-sign", Name: "accounts-balance-sign", Length: 1},
-		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "accounts-balance", Name: "accounts-balance", Length: 15},
+		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Type: "decimal(2)", Id: "accounts-balance", Name: "accounts-balance", Length: 15},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "cash-balance-sign", Name: "cash-balance-sign", Length: 1},
-		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "cash-balance", Name: "cash-balance", Length: 15},
+		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Type: "decimal(2)", Id: "cash-balance", Name: "cash-balance", Length: 15},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: true, Id: "filler-2", Name: "filler-2", Length: 54},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: true, Id: "filler-3", Name: "filler-3", Length: 15},
 	},
@@ -260,24 +277,24 @@ var RH65Definition = fixedlengthfile.FixedLengthRecordDefinition{
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "record-type", Name: "record-type", Length: 2},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "progr-number", Name: "progr-number", Length: 7},
 		// {Format: fixedlengthfile.FieldFormat{ Trim: true }, Drop: false,  Id: "first-cash-balance", Name: "first-cash-balance", Length: 22},
-		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "first-cash-on-hand-date", Name: "first-cash-on-hand-date", Length: 6},
+		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Type: "date(DDMMYY)", Id: "first-cash-on-hand-date", Name: "first-cash-on-hand-date", Length: 6},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "first-cash-sign", Name: "first-cash-sign", Length: 1},
-		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "first-cash-balance", Name: "first-cash-balance", Length: 15},
+		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Type: "decimal(2)", Id: "first-cash-balance", Name: "first-cash-balance", Length: 15},
 		// {Format: fixedlengthfile.FieldFormat{ Trim: true }, Drop: false,  Id: "second-cash-balance", Name: "second-cash-balance", Length: 22},
-		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "second-cash-on-hand-date", Name: "second-cash-on-hand-date", Length: 6},
+		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Type: "date(DDMMYY)", Id: "second-cash-on-hand-date", Name: "second-cash-on-hand-date", Length: 6},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "second-cash-sign", Name: "second-cash-sign", Length: 1},
-		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "second-cash-balance", Name: "second-cash-balance", Length: 15},
+		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Type: "decimal(2)", Id: "second-cash-balance", Name: "second-cash-balance", Length: 15},
 		// {Format: fixedlengthfile.FieldFormat{ Trim: true }, Drop: false,  Id: "third-cash-balance", Name: "third-cash-balance", Length: 22},
-		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "third-cash-on-hand-date", Name: "third-cash-on-hand-date", Length: 6},
+		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Type: "date(DDMMYY)", Id: "third-cash-on-hand-date", Name: "third-cash-on-hand-date", Length: 6},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "third-cash-sign", Name: "third-cash-sign", Length: 1},
-		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "third-cash-balance", Name: "third-cash-balance", Length: 15},
+		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Type: "decimal(2)", Id: "third-cash-balance", Name: "third-cash-balance", Length: 15},
 		// {Format: fixedlengthfile.FieldFormat{ Trim: true }, Drop: false,  Id: "fourth-cash-balance", Name: "fourth-cash-balance", Length: 22},
-		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "fourth-cash-on-hand-date", Name: "fourth-cash-on-hand-date", Length: 6},
+		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Type: "date(DDMMYY)", Id: "fourth-cash-on-hand-date", Name: "fourth-cash-on-hand-date", Length: 6},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "fourth-cash-sign", Name: "fourth-cash-sign", Length: 1},
-		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "fourth-cash-balance", Name: "fourth-cash-balance", Length: 15},
+		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Type: "decimal(2)", Id: "fourth-cash-balance", Name: "fourth-cash-balance", Length: 15},
 		//{Format: fixedlengthfile.FieldFormat{ Trim: true }, Drop: false,  Id: "fifth-cash-balance", Name: "fifth-cash-balance", Length: 22},
-		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "fifth-cash-on-hand-date", Name: "fifth-cash-on-hand-date", Length: 6},
+		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Type: "date(DDMMYY)", Id: "fifth-cash-on-hand-date", Name: "fifth-cash-on-hand-date", Length: 6},
 		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "fifth-cash-sign", Name: "fifth-cash-sign", Length: 1},
-		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Id: "fifth-cash-balance", Name: "fifth-cash-balance", Length: 15},
+		{Format: fixedlengthfile.FieldFormat{Trim: true}, Drop: false, Type: "decimal(2)", Id: "fifth-cash-balance", Name: "fifth-cash-balance", Length: 15},
 	},
 }
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util"
+	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/textfile/validation"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -45,6 +46,7 @@ type FixedLengthFieldDefinition struct {
 	Disabled         bool        `yaml:"disabled,omitempty" mapstructure:"disabled,omitempty" json:"disabled,omitempty"`
 	Format           FieldFormat `yaml:"format,omitempty" mapstructure:"format,omitempty" json:"format,omitempty"`
 	SuppressWarnings bool        `yaml:"suppress-warnings,omitempty" mapstructure:"suppress-warnings,omitempty" json:"suppress-warnings,omitempty"`
+	Validation       string      `yaml:"validation,omitempty" mapstructure:"validation,omitempty" json:"validation,omitempty"`
 
 	// UnPadPrefix string `yaml:"unpad-prefix,omitempty" mapstructure:"unpad-prefix,omitempty" json:"unpad-prefix,omitempty"`
 	// Trim   bool   `yaml:"trim,omitempty" mapstructure:"trim,omitempty" json:"trim,omitempty"`
@@ -119,6 +121,7 @@ type FixedLengthRecordDefinition struct {
 	LengthMode          FixedLengthRecordMode        `yaml:"length-mode,omitempty" mapstructure:"length-mode,omitempty" json:"length-mode,omitempty"`
 	Fields              []FixedLengthFieldDefinition `yaml:"fields,omitempty" mapstructure:"fields,omitempty" json:"fields,omitempty"`
 	Len                 int                          `yaml:"len,omitempty" mapstructure:"len,omitempty" json:"len,omitempty"`
+	Rules               []validation.RecordRule      `yaml:"rules,omitempty" mapstructure:"rules,omitempty" json:"rules,omitempty"`
 	FieldMap            map[string]int
 }
 
@@ -153,6 +156,16 @@ func (r *FixedLengthRecordDefinition) AdjustFieldInfoIndex() error {
 			return err
 		}
 
+		ft, err := f.FieldType()
+		if err == nil && ft.Kind == FixedLengthFieldBinary && f.Length != 2 && f.Length != 4 && f.Length != 8 {
+			err = fmt.Errorf("comp field %s of length %d: 2, 4 or 8 expected", f.Name, f.Length)
+		}
+
+		if err != nil {
+			log.Error().Err(err).Str("field", f.Name).Msg(semLogContext)
+			return err
+		}
+
 		r.Fields[i].Offset = recordLength + 1
 		r.Fields[i].Index = i
 		recordLength += f.Length
@@ -2,6 +2,7 @@ package writer
 
 import (
 	"errors"
+	"fmt"
 	"io"
 
 	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/fixedlengthfile"
@@ -20,6 +21,8 @@ type Config struct {
 	FileName              string                                        `yaml:"filename,omitempty" mapstructure:"filename,omitempty" json:"filename,omitempty"`
 	ForgiveOnMissingField bool                                          `yaml:"forgive-on-missing-fields,omitempty" mapstructure:"forgive-on-missing-fields,omitempty" json:"forgive-on-missing-fields,omitempty"`
 	Records               []fixedlengthfile.FixedLengthRecordDefinition `yaml:"records,omitempty" mapstructure:"records,omitempty" json:"records,omitempty"`
+	RecordLength          int                                           `yaml:"record-length,omitempty" mapstructure:"record-length,omitempty" json:"record-length,omitempty"`
+	Encoding              string                                        `yaml:"encoding,omitempty" mapstructure:"encoding,omitempty" json:"encoding,omitempty"`
 	ioWriter              io.Writer
 
 	// HeadFields            []fixedlengthfile.FixedLengthFieldDefinition `yaml:"h-fields,omitempty" mapstructure:"h-fields,omitempty" json:"h-fields,omitempty"`
@@ -42,6 +45,20 @@ func WithFilename(fn string) Option {
 	}
 }
 
+// WithRecordLength writes the records without new lines, padded with spaces to the given length.
+func WithRecordLength(l int) Option {
+	return func(cfg *Config) {
+		cfg.RecordLength = l
+	}
+}
+
+// WithEncoding encodes the text fields with an EBCDIC code page, such as fixedlengthfile.CodePage280. It requires a record length.
+func WithEncoding(cp string) Option {
+	return func(cfg *Config) {
+		cfg.Encoding = cp
+	}
+}
+
 func WithRecord(recCfg fixedlengthfile.FixedLengthRecordDefinition) Option {
 	return func(cfg *Config) {
 		flds, _ := adjustFieldInfoIndex(recCfg.Fields)
@@ -129,6 +146,19 @@ func (cfg Config) ResolveConfig(opts ...Option) (*Config, error) {
 	}
 
 	config.Records = adjustedRecords
+	if config.RecordLength < 0 {
+		err = fmt.Errorf("invalid record length %d", config.RecordLength)
+		log.Error().Err(err).Msg(semLogContext)
+		return nil, err
+	}
+
+	// the EBCDIC files have no new lines.
+	if config.Encoding != "" && config.RecordLength == 0 {
+		err = fmt.Errorf("encoding %s without record length", config.Encoding)
+		log.Error().Err(err).Msg(semLogContext)
+		return nil, err
+	}
+
 	if config.ioWriter == nil && config.FileName == "" {
 		err = errors.New("please provide a writer or filename")
 		log.Error().Err(err).Msg(semLogContext)
@@ -24,13 +24,14 @@ type Writer interface {
 
 type Record struct {
 	csvRecord     []string
+	values        []string
 	fields        []fixedlengthfile.FixedLengthFieldDefinition
 	fieldMap      map[string]int
 	forgivingMode bool
 }
 
 func newRecord(fields []fixedlengthfile.FixedLengthFieldDefinition, fieldMap map[string]int, forgivingMode bool) Record {
-	return Record{csvRecord: make([]string, len(fields), len(fields)), fields: fields, fieldMap: fieldMap, forgivingMode: forgivingMode}
+	return Record{csvRecord: make([]string, len(fields), len(fields)), values: make([]string, len(fields)), fields: fields, fieldMap: fieldMap, forgivingMode: forgivingMode}
 }
 
 func computeFieldMap(fields []fixedlengthfile.FixedLengthFieldDefinition) map[string]int {
@@ -47,18 +48,45 @@ func computeFieldMap(fields []fixedlengthfile.FixedLengthFieldDefinition) map[st
 }
 
 func (r *Record) String() string {
-	var sb strings.Builder
+	b, err := r.Bytes(nil)
+	if err != nil {
+		log.Error().Err(err).Msg("fixed-length-writer::record-string")
+	}
+
+	return string(b)
+}
+
+// Bytes encodes the record: the text fields are padded and converted with the code page, if any, the binary fields encoded as comp-3 or comp.
+func (r *Record) Bytes(cp *fixedlengthfile.CodePage) ([]byte, error) {
+	var buf []byte
 	for i := 0; i < len(r.csvRecord); i++ {
+		f := r.fields[i]
+		if f.IsBinary() {
+			b, err := f.EncodeBinary(r.csvRecord[i])
+			if err != nil {
+				return buf, err
+			}
+			buf = append(buf, b...)
+			continue
+		}
 
-		if len(r.csvRecord[i]) < r.fields[i].Length {
-			s := r.fields[i].Sprintf(r.csvRecord[i])
-			sb.WriteString(s)
-		} else {
-			sb.WriteString(r.csvRecord[i])
+		if cp != nil {
+			b, err := cp.Sprintf(f, r.values[i])
+			if err != nil {
+				return buf, err
+			}
+			buf = append(buf, b...)
+			continue
 		}
+
+		s := r.csvRecord[i]
+		if len(s) < f.Length {
+			s = f.Sprintf(s)
+		}
+		buf = append(buf, s...)
 	}
 
-	return sb.String()
+	return buf, nil
 }
 
 func (r *Record) Set(fieldId string, fieldValue interface{}) error {
@@ -72,7 +100,16 @@ func (r *Record) Set(fieldId string, fieldValue interface{}) error {
 
 	if fIndex, ok := r.fieldMap[fieldId]; ok {
 		f := r.fields[fIndex]
-		s = f.Sprintf(s)
+		r.values[fIndex] = s
+		if f.IsBinary() {
+			// The binary fields keep the value and are encoded by Bytes: the error of a value that doesn't fit is reported here.
+			if _, err := f.EncodeBinary(s); err != nil {
+				log.Error().Err(err).Str("field-id", fieldId).Msg(semLogContext)
+				return err
+			}
+		} else {
+			s = f.Sprintf(s)
+		}
 		r.csvRecord[fIndex] = s
 	} else {
 		var evt *zerolog.Event
@@ -101,6 +138,7 @@ type writerImpl struct {
 	//tailFieldMap map[string]int
 	osFile     *os.File
 	lineNumber int
+	codePage   *fixedlengthfile.CodePage
 
 	logger util.GeometricTraceLogger
 }
@@ -121,6 +159,12 @@ func NewWriter(cfg Config, opts ...Option) (Writer, error) {
 		logger: util.GeometricTraceLogger{},
 	}
 
+	r.codePage, err = fixedlengthfile.LookupCodePage(config.Encoding)
+	if err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+		return nil, err
+	}
+
 	if config.ioWriter != nil {
 		r.ioWriter = bufio.NewWriter(config.ioWriter)
 	} else {
@@ -182,11 +226,32 @@ func (w *writerImpl) NewRecord(key string) (Record, error) {
 //}
 
 func (w *writerImpl) WriteRecord(rec Record) error {
-	_, err := w.ioWriter.WriteString(rec.String())
+	b, err := rec.Bytes(w.codePage)
 	if err != nil {
 		return err
 	}
-	_, err = w.ioWriter.WriteRune('\n')
+
+	if w.cfg.RecordLength == 0 {
+		if _, err = w.ioWriter.Write(b); err != nil {
+			return err
+		}
+		_, err = w.ioWriter.WriteRune('\n')
+		return err
+	}
+
+	if len(b) > w.cfg.RecordLength {
+		return fmt.Errorf("record of %d bytes longer than the record length %d", len(b), w.cfg.RecordLength)
+	}
+
+	pad := []byte(strings.Repeat(" ", w.cfg.RecordLength-len(b)))
+	if w.codePage != nil {
+		pad, _ = w.codePage.Encode(string(pad))
+	}
+
+	if _, err = w.ioWriter.Write(b); err != nil {
+		return err
+	}
+	_, err = w.ioWriter.Write(pad)
 	return err
 }
 
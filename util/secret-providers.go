@@ -0,0 +1,255 @@
+package util
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	SecretProviderFile    = "file"
+	SecretProviderEnvFile = "envfile"
+	SecretProviderBase64  = "b64"
+
+	// EnvFileKeySeparator separates the path of the env file from the key, as in ${envfile:.env#KEY}.
+	EnvFileKeySeparator = "#"
+
+	RedactedValue = "***"
+
+	// MinSecretValueLength is the length of the shortest secret redacted within a text: redacting the shorter ones everywhere would garble it.
+	// The shorter secrets are redacted only when they are the whole text, as the value of a var.
+	MinSecretValueLength = 4
+)
+
+// ConfigSecretRegexp matches the references resolved by a secret provider such as ${file:/run/secrets/db}.
+var ConfigSecretRegexp = regexp.MustCompile(`(\$\{([a-zA-Z][a-zA-Z0-9_\-]*):([^}\s]+)\})`)
+
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretProvider resolves the references of its prefix. It is the hook for vault like backends: the ref is the text following the prefix.
+type SecretProvider interface {
+	Secret(ref string) (string, error)
+}
+
+type SecretProviderFunc func(ref string) (string, error)
+
+func (f SecretProviderFunc) Secret(ref string) (string, error) {
+	return f(ref)
+}
+
+// MapSecretProvider is a provider serving the secrets of a map: a local stand-in for the remote backends.
+type MapSecretProvider map[string]string
+
+func (m MapSecretProvider) Secret(ref string) (string, error) {
+	if s, ok := m[ref]; ok {
+		return s, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrSecretNotFound, ref)
+}
+
+var secretProviders = struct {
+	mu        sync.RWMutex
+	providers map[string]SecretProvider
+}{
+	providers: map[string]SecretProvider{
+		SecretProviderFile:    SecretProviderFunc(fileSecret),
+		SecretProviderEnvFile: SecretProviderFunc(envFileSecret),
+		SecretProviderBase64:  SecretProviderFunc(base64Secret),
+	},
+}
+
+// RegisterSecretProvider makes the provider resolve the ${name:...} references. A nil provider removes the registration.
+func RegisterSecretProvider(name string, p SecretProvider) {
+	secretProviders.mu.Lock()
+	defer secretProviders.mu.Unlock()
+
+	if p == nil {
+		delete(secretProviders.providers, name)
+		return
+	}
+	secretProviders.providers[name] = p
+}
+
+func lookupSecretProvider(name string) (SecretProvider, bool) {
+	secretProviders.mu.RLock()
+	defer secretProviders.mu.RUnlock()
+	p, ok := secretProviders.providers[name]
+	return p, ok
+}
+
+// fileSecret reads the secret from a file, as the docker and kubernetes ones. The trailing new line is not part of the secret.
+func fileSecret(ref string) (string, error) {
+	b, err := os.ReadFile(ref)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// envFileSecret reads the value of a key of an env file. Lines are in the KEY=VALUE form, optionally preceded by export. Empty lines and comments are skipped.
+func envFileSecret(ref string) (string, error) {
+	ndx := strings.LastIndex(ref, EnvFileKeySeparator)
+	if ndx < 0 {
+		return "", fmt.Errorf("env file reference %s without key", ref)
+	}
+
+	fn, key := ref[:ndx], ref[ndx+1:]
+	file, err := os.Open(fn)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		k, v, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok || strings.TrimSpace(k) != key {
+			continue
+		}
+
+		v = strings.TrimSpace(v)
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		return v, nil
+	}
+
+	if err = scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", fmt.Errorf("%w: %s in %s", ErrSecretNotFound, key, fn)
+}
+
+func base64Secret(ref string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(ref)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+var secretValues = struct {
+	mu     sync.RWMutex
+	values map[string]struct{}
+}{values: make(map[string]struct{})}
+
+// RegisterSecretValue marks a value as secret: RedactSecrets hides it. The values resolved by the secret providers are registered automatically.
+func RegisterSecretValue(s string) {
+	if s == "" {
+		return
+	}
+
+	secretValues.mu.Lock()
+	defer secretValues.mu.Unlock()
+	secretValues.values[s] = struct{}{}
+}
+
+// RedactSecrets replaces the secret values found in the text with RedactedValue. Longer secrets are replaced first and the ones
+// shorter than MinSecretValueLength only when they are the whole text.
+func RedactSecrets(s string) string {
+	secretValues.mu.RLock()
+	defer secretValues.mu.RUnlock()
+
+	if len(secretValues.values) == 0 || s == "" {
+		return s
+	}
+
+	if _, ok := secretValues.values[s]; ok {
+		return RedactedValue
+	}
+
+	values := make([]string, 0, len(secretValues.values))
+	for v := range secretValues.values {
+		if len(v) >= MinSecretValueLength {
+			values = append(values, v)
+		}
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+
+	for _, v := range values {
+		s = strings.ReplaceAll(s, v, RedactedValue)
+	}
+
+	return s
+}
+
+type redactedError struct {
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return RedactSecrets(e.err.Error())
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// RedactError is the error with the secret values of its message redacted, as the ones quoted by the parsing errors of a resolved config.
+func RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &redactedError{err: err}
+}
+
+// resolveConfigSecrets replaces the references of the registered providers. The references starting or ending in the values of the env vars,
+// whose positions are envSpans, are not the ones of the config and are left as they are, as the references that cannot be resolved.
+func resolveConfigSecrets(v string, envSpans [][2]int) string {
+	const semLogContext = "util::resolve-config-secrets"
+
+	if !strings.Contains(v, "${") {
+		return v
+	}
+
+	inEnvValue := func(ndx int) bool {
+		for _, sp := range envSpans {
+			if ndx >= sp[0] && ndx < sp[1] {
+				return true
+			}
+		}
+		return false
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, m := range ConfigSecretRegexp.FindAllStringSubmatchIndex(v, -1) {
+		if inEnvValue(m[0]) || inEnvValue(m[1]-1) {
+			continue
+		}
+
+		name := v[m[4]:m[5]]
+		p, ok := lookupSecretProvider(name)
+		if !ok {
+			continue
+		}
+
+		secret, err := p.Secret(v[m[6]:m[7]])
+		if err != nil {
+			log.Error().Err(err).Str("provider", name).Msg(semLogContext)
+			continue
+		}
+
+		RegisterSecretValue(secret)
+		sb.WriteString(v[last:m[0]])
+		sb.WriteString(secret)
+		last = m[1]
+	}
+	sb.WriteString(v[last:])
+
+	return sb.String()
+}
@@ -2,6 +2,7 @@ package csvreader
 
 import (
 	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/textfile"
+	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/textfile/validation"
 	"github.com/rs/zerolog/log"
 	"io"
 	"strings"
@@ -12,7 +13,10 @@ type Config struct {
 	Separator  string                  `yaml:"separator,omitempty" mapstructure:"separator,omitempty" json:"separator,omitempty"`
 	FileName   string                  `yaml:"filename,omitempty" mapstructure:"filename,omitempty" json:"filename,omitempty"`
 	Fields     []textfile.CSVFieldInfo `yaml:"fields,omitempty" mapstructure:"fields,omitempty" json:"fields,omitempty"`
-	ioReader   io.Reader
+	Rules      []validation.RecordRule `yaml:"rules,omitempty" mapstructure:"rules,omitempty" json:"rules,omitempty"`
+	// CollectViolations collects the violations of the validation in the report of the reader: otherwise they are the error of the Read.
+	CollectViolations bool `yaml:"collect-violations,omitempty" mapstructure:"collect-violations,omitempty" json:"collect-violations,omitempty"`
+	ioReader          io.Reader
 }
 
 type Option func(cfg *Config)
@@ -47,6 +51,18 @@ func WithFields(fi []textfile.CSVFieldInfo) Option {
 	}
 }
 
+func WithRules(rules []validation.RecordRule) Option {
+	return func(cfg *Config) {
+		cfg.Rules = rules
+	}
+}
+
+func WithCollectViolations(b bool) Option {
+	return func(cfg *Config) {
+		cfg.CollectViolations = b
+	}
+}
+
 func (c *Config) AdjustFieldIndexes(fs []string) {
 
 	const semLogContext = "csv-reader::adjust-field-indexes"
@@ -10,7 +10,7 @@ import (
 
 	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util"
 	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/textfile"
-	"github.com/go-playground/validator/v10"
+	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/textfile/validation"
 	"github.com/rs/zerolog/log"
 )
 
@@ -18,6 +18,7 @@ type Reader interface {
 	Close(removeFile bool)
 	Read() (map[string]interface{}, error)
 	Filename() string
+	Report() *validation.Report
 }
 
 type readerImpl struct {
@@ -28,6 +29,9 @@ type readerImpl struct {
 	lineNumber int
 	isEOF      bool
 
+	validator *validation.Validator
+	report    validation.Report
+
 	logger util.GeometricTraceLogger
 }
 
@@ -52,8 +56,14 @@ func NewReader(cfg Config, opts ...Option) (Reader, error) {
 	}
 
 	r := &readerImpl{
-		cfg:    config,
-		logger: util.GeometricTraceLogger{},
+		cfg:       config,
+		validator: validation.NewValidator(),
+		logger:    util.GeometricTraceLogger{},
+	}
+
+	if err = r.validator.AddRecordRules("", config.Rules); err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+		return nil, err
 	}
 
 	if config.ioReader != nil {
@@ -79,6 +89,9 @@ func NewReader(cfg Config, opts ...Option) (Reader, error) {
 			}
 		}
 
+		// the line numbers of the records, and of their violations, are the ones of the file.
+		r.lineNumber++
+
 		if len(config.Fields) != 0 {
 			log.Info().Msg(semLogContext + " file has header line, field names will be taken from first line")
 			r.cfg.AdjustFieldIndexes(fieldNames)
@@ -119,12 +132,15 @@ func (w *readerImpl) Filename() string {
 	return w.cfg.FileName
 }
 
+// Report is the validation report of the records read so far.
+func (r *readerImpl) Report() *validation.Report {
+	return &r.report
+}
+
 func (r *readerImpl) Read() (map[string]interface{}, error) {
 
 	const semLogContext = "csv-reader::read"
 
-	validate := validator.New()
-
 	if r.isEOF {
 		return nil, io.EOF
 	}
@@ -148,6 +164,7 @@ func (r *readerImpl) Read() (map[string]interface{}, error) {
 		r.logger.LogEvent(log.Trace().Int("line-number", r.lineNumber), semLogContext)
 	}
 
+	var violations []validation.Violation
 	if len(r.cfg.Fields) > 0 {
 		var firstErr error
 		for i := range r.cfg.Fields {
@@ -159,16 +176,15 @@ func (r *readerImpl) Read() (map[string]interface{}, error) {
 				}
 				fieldValue := fields[r.cfg.Fields[i].Index]
 				record[fieldId] = fieldValue
-				err = validateField(validate, fieldId, fieldValue, r.cfg.Fields[i].Validation, r.cfg.Fields[i].Help)
-				if err != nil {
-					log.Error().Err(err).Msg(semLogContext)
-					if firstErr == nil {
-						firstErr = err
-					}
+				rule := validation.FieldRule{Field: fieldId, Tag: r.cfg.Fields[i].Validation, Help: r.cfg.Fields[i].Help}
+				if violation, ok := r.validator.ValidateField(r.lineNumber, "", rule, fieldValue); !ok {
+					log.Error().Str("violation", violation.Message).Msg(semLogContext)
+					violations = append(violations, violation)
 				}
 			} else {
 				err = fmt.Errorf("field %s not found", r.cfg.Fields[i].Name)
 				log.Error().Err(err).Msg(semLogContext)
+				violations = append(violations, validation.Violation{LineNo: r.lineNumber, Field: r.cfg.Fields[i].Name, Message: err.Error()})
 				if firstErr == nil {
 					firstErr = err
 				}
@@ -176,6 +192,7 @@ func (r *readerImpl) Read() (map[string]interface{}, error) {
 		}
 
 		if firstErr != nil {
+			r.report.Add(violations)
 			return record, firstErr
 		}
 	} else {
@@ -185,34 +202,11 @@ func (r *readerImpl) Read() (map[string]interface{}, error) {
 		}
 	}
 
-	return record, nil
-}
-
-func validateField(validate *validator.Validate, fieldName, fieldValue string, rules string, help string) error {
-	if rules != "" {
-		errs := validate.Var(fieldValue, rules)
-		if errs != nil {
-			var err error
-			switch verr := errs.(type) {
-			case validator.ValidationErrors:
-				if ferr, ok := verr[0].(validator.FieldError); ok {
-					if help != "" {
-						err = errors.New(help)
-					} else {
-						err = fmt.Errorf("property %s of value %s cannot be validated against rule: %s", fieldName, fmt.Sprint(fieldValue), ferr.Tag())
-					}
-				} else {
-					err = fmt.Errorf("property %s of value %s cannot be validated against rule: %s", fieldName, fmt.Sprint(fieldValue), rules)
-				}
-			case *validator.InvalidValidationError:
-				err = fmt.Errorf("property %s of value %s cannot be validated against an INVALID rule: %s", fieldName, fmt.Sprint(fieldValue), rules)
-			default:
-				err = fmt.Errorf("property %s of value %s cannot be validated (with unknown error) against rule: %s", fieldName, fmt.Sprint(fieldValue), rules)
-			}
-
-			return err
-		}
+	violations = append(violations, r.validator.ValidateRecord(r.lineNumber, "", record)...)
+	r.report.Add(violations)
+	if len(violations) > 0 && !r.cfg.CollectViolations {
+		return record, &validation.Error{Violations: violations}
 	}
 
-	return nil
+	return record, nil
 }
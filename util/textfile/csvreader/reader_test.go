@@ -8,6 +8,7 @@ import (
 
 	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/textfile"
 	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/textfile/csvreader"
+	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/textfile/validation"
 	"github.com/go-playground/validator/v10"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -63,6 +64,56 @@ func TestReader(t *testing.T) {
 	}
 }
 
+func TestReaderRules(t *testing.T) {
+
+	data := "campaign;amount;sign\r\n" +
+		"BPMIFI;100;C\r\n" +
+		";100;X\r\n" +
+		"BPMIFI;abc;D\r\n"
+
+	cfg := csvreader.Config{
+		HeaderLine: true,
+		Separator:  ";",
+		Fields:     []textfile.CSVFieldInfo{{Name: "campaign", Validation: "required"}, {Name: "amount", Validation: "numeric"}, {Name: "sign"}},
+		Rules:      []validation.RecordRule{{Id: "sign", Expression: `$.sign == "C" || $.sign == "D"`}},
+	}
+
+	r, err := csvreader.NewReader(cfg, csvreader.WithIoReader(bytes.NewBufferString(data)), csvreader.WithCollectViolations(true))
+	require.NoError(t, err)
+
+	n := 0
+	for _, err = r.Read(); err == nil; _, err = r.Read() {
+		n++
+	}
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, 3, n)
+
+	report := r.Report()
+	t.Log(report.String())
+	require.Equal(t, 2, report.InvalidRecords)
+	require.Len(t, report.ByLine()[3], 2)
+	require.Len(t, report.ByLine()[4], 1)
+
+	r, err = csvreader.NewReader(cfg, csvreader.WithIoReader(bytes.NewBufferString(data)))
+	require.NoError(t, err)
+
+	_, err = r.Read()
+	require.NoError(t, err)
+	_, err = r.Read()
+	require.ErrorIs(t, err, validation.ErrInvalidRecord)
+
+	// the header misses the sign field.
+	r, err = csvreader.NewReader(cfg, csvreader.WithIoReader(bytes.NewBufferString("campaign;amount\r\n;100\r\n")))
+	require.NoError(t, err)
+
+	_, err = r.Read()
+	require.Error(t, err)
+
+	report = r.Report()
+	require.Equal(t, 1, report.InvalidRecords)
+	require.Len(t, report.ByLine()[2], 2)
+}
+
 func TestValidate(t *testing.T) {
 	validate := validator.New()
 	record := map[string]interface{}{
@@ -0,0 +1,265 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/expression"
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog/log"
+)
+
+// RecordRule is a boolean expression on the fields of a record, evaluated with util/expression. The fields are referenced as json paths
+// of the record, as in "{$.sign}" == "C"; the bare form $.sign == "C" is accepted too. Message, if any, replaces the default text of the violation.
+type RecordRule struct {
+	Id         string `yaml:"id,omitempty" mapstructure:"id,omitempty" json:"id,omitempty"`
+	Expression string `yaml:"expression,omitempty" mapstructure:"expression,omitempty" json:"expression,omitempty"`
+	Message    string `yaml:"message,omitempty" mapstructure:"message,omitempty" json:"message,omitempty"`
+}
+
+// FieldRule is the go-playground validator tag of a field. Help, if any, replaces the default text of the violation.
+type FieldRule struct {
+	Field string
+	Tag   string
+	Help  string
+}
+
+type Violation struct {
+	LineNo   int    `yaml:"line-no,omitempty" mapstructure:"line-no,omitempty" json:"line-no,omitempty"`
+	RecordId string `yaml:"record-id,omitempty" mapstructure:"record-id,omitempty" json:"record-id,omitempty"`
+	Field    string `yaml:"field,omitempty" mapstructure:"field,omitempty" json:"field,omitempty"`
+	Value    string `yaml:"value,omitempty" mapstructure:"value,omitempty" json:"value,omitempty"`
+	Rule     string `yaml:"rule,omitempty" mapstructure:"rule,omitempty" json:"rule,omitempty"`
+	Message  string `yaml:"message,omitempty" mapstructure:"message,omitempty" json:"message,omitempty"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("line %d: %s", v.LineNo, v.Message)
+}
+
+var ErrInvalidRecord = errors.New("invalid record")
+
+// Error carries the violations of a record when the reader doesn't collect them. It matches ErrInvalidRecord.
+type Error struct {
+	Violations []Violation
+}
+
+func (e *Error) Unwrap() error {
+	return ErrInvalidRecord
+}
+
+func (e *Error) Error() string {
+	msgs := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		msgs = append(msgs, v.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Report collects the violations of the records read.
+type Report struct {
+	Violations     []Violation `yaml:"violations,omitempty" mapstructure:"violations,omitempty" json:"violations,omitempty"`
+	NumOfRecords   int         `yaml:"num-of-records,omitempty" mapstructure:"num-of-records,omitempty" json:"num-of-records,omitempty"`
+	InvalidRecords int         `yaml:"invalid-records,omitempty" mapstructure:"invalid-records,omitempty" json:"invalid-records,omitempty"`
+}
+
+// Add accounts a record with its violations.
+func (r *Report) Add(violations []Violation) {
+	r.NumOfRecords++
+	if len(violations) > 0 {
+		r.InvalidRecords++
+		r.Violations = append(r.Violations, violations...)
+	}
+}
+
+func (r *Report) IsValid() bool {
+	return len(r.Violations) == 0
+}
+
+// ByLine groups the violations by line number.
+func (r *Report) ByLine() map[int][]Violation {
+	m := make(map[int][]Violation)
+	for _, v := range r.Violations {
+		m[v.LineNo] = append(m[v.LineNo], v)
+	}
+	return m
+}
+
+func (r *Report) String() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("records: %d, invalid: %d, violations: %d", r.NumOfRecords, r.InvalidRecords, len(r.Violations)))
+
+	violations := append([]Violation(nil), r.Violations...)
+	sort.SliceStable(violations, func(i, j int) bool { return violations[i].LineNo < violations[j].LineNo })
+	for _, v := range violations {
+		sb.WriteString("\n")
+		sb.WriteString(v.String())
+	}
+	return sb.String()
+}
+
+type compiledRule struct {
+	rule RecordRule
+	expr *expression.CompiledExpression
+}
+
+// Validator checks the fields and the record rules of the records. It is not safe for concurrent use.
+type Validator struct {
+	validate *validator.Validate
+	rules    map[string][]compiledRule
+}
+
+func NewValidator() *Validator {
+	return &Validator{validate: validator.New(), rules: make(map[string][]compiledRule)}
+}
+
+// AddRecordRules compiles the rules of the records with the given id. The empty id is the one of the readers with a single kind of record.
+func (v *Validator) AddRecordRules(recordId string, rules []RecordRule) error {
+	const semLogContext = "record-validator::add-rules"
+
+	for i, r := range rules {
+		if r.Id == "" {
+			r.Id = fmt.Sprintf("rule-%d", i+1)
+		}
+
+		ce, err := expression.Compile(BareJsonPathToReference(r.Expression))
+		if err != nil {
+			err = fmt.Errorf("rule %s of record %s: %w", r.Id, recordId, err)
+			log.Error().Err(err).Msg(semLogContext)
+			return err
+		}
+
+		v.rules[recordId] = append(v.rules[recordId], compiledRule{rule: r, expr: ce})
+	}
+
+	return nil
+}
+
+func (v *Validator) HasRules(recordId string) bool {
+	return len(v.rules[recordId]) > 0
+}
+
+// ValidateField checks the value of a field against its validator tag.
+func (v *Validator) ValidateField(lineNo int, recordId string, rule FieldRule, value string) (Violation, bool) {
+	if rule.Tag == "" {
+		return Violation{}, true
+	}
+
+	errs := v.validate.Var(value, rule.Tag)
+	if errs == nil {
+		return Violation{}, true
+	}
+
+	violation := Violation{LineNo: lineNo, RecordId: recordId, Field: rule.Field, Value: value, Rule: rule.Tag}
+	switch verr := errs.(type) {
+	case validator.ValidationErrors:
+		violation.Rule = verr[0].Tag()
+		violation.Message = fmt.Sprintf("property %s of value %s cannot be validated against rule: %s", rule.Field, value, violation.Rule)
+	case *validator.InvalidValidationError:
+		violation.Message = fmt.Sprintf("property %s of value %s cannot be validated against an INVALID rule: %s", rule.Field, value, rule.Tag)
+	default:
+		violation.Message = fmt.Sprintf("property %s of value %s cannot be validated (with unknown error) against rule: %s", rule.Field, value, rule.Tag)
+	}
+
+	if rule.Help != "" {
+		violation.Message = rule.Help
+	}
+
+	return violation, false
+}
+
+// ValidateRecord evaluates the rules of the record. A rule that cannot be evaluated is a violation too.
+func (v *Validator) ValidateRecord(lineNo int, recordId string, record map[string]interface{}) []Violation {
+	const semLogContext = "record-validator::validate-record"
+
+	rules := v.rules[recordId]
+	if len(rules) == 0 {
+		return nil
+	}
+
+	ctx, err := expression.NewContext(expression.WithMapInput(record), expression.WithTypedReferences(true))
+	if err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+		return []Violation{{LineNo: lineNo, RecordId: recordId, Message: err.Error()}}
+	}
+
+	var violations []Violation
+	for _, r := range rules {
+		ok, err := r.expr.BoolEval(ctx)
+		if ok && err == nil {
+			continue
+		}
+
+		violation := Violation{LineNo: lineNo, RecordId: recordId, Rule: r.rule.Id, Message: r.rule.Message}
+		if err != nil {
+			violation.Message = fmt.Sprintf("rule %s cannot be evaluated: %v", r.rule.Id, err)
+		} else if violation.Message == "" {
+			violation.Message = fmt.Sprintf("rule %s not satisfied: %s", r.rule.Id, r.rule.Expression)
+		}
+		violations = append(violations, violation)
+	}
+
+	return violations
+}
+
+// BareJsonPathToReference turns the json paths not enclosed in braces or quotes, as in $.sign, into references, as in {$.sign}.
+// The paths with a dash in a segment, not allowed by the dot notation, use the bracket one, as in {$["movmnt-sign"]}. A dash is part of the
+// path only if followed by a letter: $.amount-1 and $.a-$.b are subtractions, while a subtraction of a name needs spaces, as in $.a - b.
+func BareJsonPathToReference(expr string) string {
+	if !strings.Contains(expr, "$.") {
+		return expr
+	}
+
+	var sb strings.Builder
+	quote := byte(0)
+	braces := 0
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '{':
+			braces++
+		case c == '}':
+			braces--
+		case c == '$' && braces == 0 && i+1 < len(expr) && expr[i+1] == '.':
+			j := i + 2
+			for j < len(expr) && (isJsonPathChar(expr[j]) || expr[j] == '-' && j+1 < len(expr) && isLetter(expr[j+1])) {
+				j++
+			}
+			sb.WriteString("{" + bareJsonPath(expr[i:j]) + "}")
+			i = j - 1
+			continue
+		}
+		sb.WriteByte(c)
+	}
+
+	return sb.String()
+}
+
+func bareJsonPath(path string) string {
+	if !strings.Contains(path, "-") {
+		return path
+	}
+
+	var sb strings.Builder
+	sb.WriteString("$")
+	for _, seg := range strings.Split(strings.TrimPrefix(path, "$."), ".") {
+		sb.WriteString(`["` + seg + `"]`)
+	}
+	return sb.String()
+}
+
+func isJsonPathChar(c byte) bool {
+	return isLetter(c) || c >= '0' && c <= '9' || c == '_' || c == '.'
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
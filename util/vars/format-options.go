@@ -0,0 +1,255 @@
+package varResolver
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	FormatOptUpper    = "upper"
+	FormatOptLower    = "lower"
+	FormatOptBase64   = "b64"
+	FormatOptSha256   = "sha256"
+	FormatOptMask     = "mask="
+	FormatOptDateFrom = "date-from="
+	FormatOptRound    = "round="
+	FormatOptSubstr   = "substr="
+
+	// MaskChar replaces the hidden chars of the mask= option.
+	MaskChar = "*"
+)
+
+var ErrUnknownFormatOption = errors.New("unknown format option")
+
+// FormatOptionFunc transforms the value of a variable. arg is the text following the '=' of the options registered with a name ending in '='.
+type FormatOptionFunc func(v interface{}, arg string) (interface{}, error)
+
+var formatOptions = struct {
+	mu   sync.RWMutex
+	opts map[string]FormatOptionFunc
+}{
+	opts: map[string]FormatOptionFunc{
+		FormatOptUpper:    upperFormatOption,
+		FormatOptLower:    lowerFormatOption,
+		FormatOptBase64:   base64FormatOption,
+		FormatOptSha256:   sha256FormatOption,
+		FormatOptMask:     maskFormatOption,
+		FormatOptDateFrom: dateFromFormatOption,
+		FormatOptRound:    roundFormatOption,
+		FormatOptSubstr:   substrFormatOption,
+	},
+}
+
+// RegisterFormatOption adds a format option. Names of options taking an argument end with '=', as in mask=. The options provided by the package cannot be replaced.
+func RegisterFormatOption(name string, f FormatOptionFunc) error {
+	if name == "" || name == "=" || f == nil {
+		return errors.New("format option name and function are mandatory")
+	}
+
+	if _, ok := optsMap[name]; ok {
+		return fmt.Errorf("format option %s is a predefined one", name)
+	}
+
+	formatOptions.mu.Lock()
+	defer formatOptions.mu.Unlock()
+	if _, ok := formatOptions.opts[name]; ok {
+		return fmt.Errorf("format option %s already registered", name)
+	}
+
+	formatOptions.opts[name] = f
+	return nil
+}
+
+// packageFormatOptions are the names of the options provided by the package.
+var packageFormatOptions = func() map[string]struct{} {
+	m := make(map[string]struct{}, len(formatOptions.opts))
+	for n := range formatOptions.opts {
+		m[n] = struct{}{}
+	}
+	return m
+}()
+
+// UnregisterFormatOption removes an option added by RegisterFormatOption, as a test does on cleanup. The options provided by the package cannot be removed.
+func UnregisterFormatOption(name string) error {
+	if _, ok := packageFormatOptions[name]; ok {
+		return fmt.Errorf("format option %s is provided by the package", name)
+	}
+
+	formatOptions.mu.Lock()
+	defer formatOptions.mu.Unlock()
+	if _, ok := formatOptions.opts[name]; !ok {
+		return fmt.Errorf("format option %s not registered", name)
+	}
+
+	delete(formatOptions.opts, name)
+	return nil
+}
+
+func lookupFormatOption(name string) (FormatOptionFunc, bool) {
+	formatOptions.mu.RLock()
+	defer formatOptions.mu.RUnlock()
+	f, ok := formatOptions.opts[name]
+	return f, ok
+}
+
+var strictFormatOptions atomic.Bool
+
+// SetStrictFormatOptions makes ToString fail with ErrUnknownFormatOption on the tags that are not options. By default these are taken, as they have always been,
+// as time layouts or sprintf verbs.
+func SetStrictFormatOptions(b bool) {
+	strictFormatOptions.Store(b)
+}
+
+// applyFormatOptions runs the registered options found in the tags, in the order they appear, before the predefined ones.
+// Nil values are left alone for the onf= option to apply.
+func (vr Variable) applyFormatOptions(v interface{}) (interface{}, error) {
+	if v == nil {
+		return v, nil
+	}
+
+	var err error
+	for _, t := range vr.tags {
+		name, arg := t, ""
+		if ndx := strings.Index(t, "="); ndx >= 0 {
+			name, arg = t[:ndx+1], t[ndx+1:]
+		}
+
+		f, ok := lookupFormatOption(name)
+		if !ok {
+			continue
+		}
+
+		v, err = f(v, arg)
+		if err != nil {
+			return nil, fmt.Errorf("format option %s: %w", t, err)
+		}
+	}
+
+	return v, nil
+}
+
+func textValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+func upperFormatOption(v interface{}, _ string) (interface{}, error) {
+	return strings.ToUpper(textValue(v)), nil
+}
+
+func lowerFormatOption(v interface{}, _ string) (interface{}, error) {
+	return strings.ToLower(textValue(v)), nil
+}
+
+func base64FormatOption(v interface{}, _ string) (interface{}, error) {
+	return base64.StdEncoding.EncodeToString([]byte(textValue(v))), nil
+}
+
+func sha256FormatOption(v interface{}, _ string) (interface{}, error) {
+	h := sha256.Sum256([]byte(textValue(v)))
+	return hex.EncodeToString(h[:]), nil
+}
+
+// maskFormatOption hides the chars of the value but the last n, or the first n if n is negative, as in mask=4.
+func maskFormatOption(v interface{}, arg string) (interface{}, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	r := []rune(textValue(v))
+	keep := n
+	if keep < 0 {
+		keep = -keep
+	}
+
+	if keep >= len(r) {
+		return string(r), nil
+	}
+
+	masked := strings.Repeat(MaskChar, len(r)-keep)
+	if n < 0 {
+		return string(r[:keep]) + masked, nil
+	}
+	return masked + string(r[len(r)-keep:]), nil
+}
+
+// dateFromFormatOption parses the text value with the layout, as in date-from=20060102, to have it formatted by a following tml= option.
+func dateFromFormatOption(v interface{}, arg string) (interface{}, error) {
+	if t, ok := v.(time.Time); ok {
+		return t, nil
+	}
+	return time.Parse(arg, textValue(v))
+}
+
+// roundFormatOption rounds half away from zero a numeric value to the number of decimals, as in round=2. The result is the text with exactly that number of decimals.
+func roundFormatOption(v interface{}, arg string) (interface{}, error) {
+	decimals, err := strconv.Atoi(arg)
+	if err != nil || decimals < 0 {
+		return nil, fmt.Errorf("invalid number of decimals %s", arg)
+	}
+
+	// The decimal of a float is its shortest representation: 1.005 is not rounded down as its binary approximation would be.
+	var d decimal.Decimal
+	switch tv := v.(type) {
+	case float64:
+		d = decimal.NewFromFloat(tv)
+	case float32:
+		d = decimal.NewFromFloat32(tv)
+	case int:
+		d = decimal.NewFromInt(int64(tv))
+	case int64:
+		d = decimal.NewFromInt(tv)
+	default:
+		d, err = decimal.NewFromString(strings.TrimSpace(textValue(v)))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return d.Round(int32(decimals)).StringFixed(int32(decimals)), nil
+}
+
+// substrFormatOption takes the chars from start to end excluded, as in substr=2:5. The end is optional and the bounds are clipped to the length of the value.
+func substrFormatOption(v interface{}, arg string) (interface{}, error) {
+	r := []rune(textValue(v))
+
+	from, to, hasTo := strings.Cut(arg, ":")
+	start, err := strconv.Atoi(from)
+	if err != nil {
+		return nil, err
+	}
+
+	end := len(r)
+	if hasTo && to != "" {
+		if end, err = strconv.Atoi(to); err != nil {
+			return nil, err
+		}
+	}
+
+	start = clip(start, 0, len(r))
+	end = clip(end, start, len(r))
+	return string(r[start:end]), nil
+}
+
+func clip(n, min, max int) int {
+	if n < min {
+		return min
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
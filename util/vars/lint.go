@@ -0,0 +1,170 @@
+package varResolver
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	LintSeverityError   = "error"
+	LintSeverityWarning = "warning"
+)
+
+// LintIssue is a problem found by Lint in a variable reference. Line and Column are 1-based, the column counts the runes of the line.
+type LintIssue struct {
+	Line      int    `yaml:"line,omitempty" mapstructure:"line,omitempty" json:"line,omitempty"`
+	Column    int    `yaml:"column,omitempty" mapstructure:"column,omitempty" json:"column,omitempty"`
+	Reference string `yaml:"reference,omitempty" mapstructure:"reference,omitempty" json:"reference,omitempty"`
+	Severity  string `yaml:"severity,omitempty" mapstructure:"severity,omitempty" json:"severity,omitempty"`
+	Message   string `yaml:"message,omitempty" mapstructure:"message,omitempty" json:"message,omitempty"`
+}
+
+func (li LintIssue) String() string {
+	return fmt.Sprintf("%d:%d %s %s: %s", li.Line, li.Column, li.Severity, li.Reference, li.Message)
+}
+
+var (
+	// lintPrefixRegexp matches the names that look like a prefixed one, as in x:name.
+	lintPrefixRegexp = regexp.MustCompile(`^[a-zA-Z]+:`)
+	// lintSprintfRegexp matches a single sprintf verb with its flags, width and precision.
+	lintSprintfRegexp = regexp.MustCompile(`^%[-+# 0]*[0-9]*(?:\.[0-9]+)?[vTtbcdoOqxXUeEfFgGsp]$`)
+	lintLayoutTime    = time.Date(2001, time.February, 3, 4, 5, 6, 0, time.UTC)
+)
+
+// Lint checks the references of the given type found in the text without resolving them. It reports unknown prefixes and format options,
+// malformed sprf= and tml= values and suffixes not matching the prefix as errors. The tags taken as time layouts or sprintf verbs,
+// a deprecated form, and the names matching only the extended pattern, as the json path ones, are reported as warnings.
+func Lint(text string, refType VariableReferenceType) []LintIssue {
+
+	var issues []LintIssue
+	for _, sr := range scanReferences(text, refType == WritersideVariableReference) {
+		if sr.err != nil {
+			// The reference ends with the suffix that raised the error.
+			match := text[sr.start:sr.end]
+			for _, sfix := range []string{SimpleVariableReferenceSuffix, ScriptletPercentVariableReferenceSuffix, ScriptletDashVariableReferenceSuffix} {
+				if strings.HasPrefix(text[sr.end:], sfix) {
+					match += sfix
+					break
+				}
+			}
+
+			line, col := lintPosition(text, sr.start)
+			issues = append(issues, LintIssue{Line: line, Column: col, Reference: match, Severity: LintSeverityError, Message: sr.err.Error()})
+			continue
+		}
+
+		if sr.node.mapping.Type == refType || refType == AnyVariableReference {
+			issues = lintReference(issues, text, sr.node, refType)
+		}
+	}
+
+	return issues
+}
+
+// lintReference checks the alternatives of the reference that don't hold nested references, and then the nested references.
+func lintReference(issues []LintIssue, text string, n *referenceNode, refType VariableReferenceType) []LintIssue {
+	ref := n.reference(text)
+	line, col := lintPosition(text, n.start)
+	issue := func(severity, format string, args ...interface{}) {
+		issues = append(issues, LintIssue{Line: line, Column: col, Reference: ref.Match, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	alts := ref.Alternatives()
+	for _, name := range alts {
+		if _, ok := FallbackLiteral(name); (ok && len(alts) > 1) || lintHasNested(name, ref.Nested) {
+			continue
+		}
+
+		// The format options, not allowed by the strict pattern, are checked below.
+		if refType != WritersideVariableReference && !VariableReferencePatternRegexp.MatchString(ref.RefType.ToVar(strings.Split(name, ",")[0])) {
+			issue(LintSeverityWarning, "reference name matches only the extended pattern")
+		}
+
+		variable, err := ParseVariable(strings.TrimPrefix(name, "!"))
+		if err != nil {
+			issue(LintSeverityError, "%s", err.Error())
+			continue
+		}
+
+		if variable.Prefix == VariablePrefixNotSpecified {
+			if pfix := lintPrefixRegexp.FindString(variable.Name); pfix != "" {
+				issue(LintSeverityError, "unknown prefix %s", pfix)
+			}
+		}
+
+		for _, t := range variable.tags {
+			severity, msg := lintTag(t)
+			if msg != "" {
+				issue(severity, "%s", msg)
+			}
+		}
+	}
+
+	for _, p := range n.parts {
+		if nested, ok := p.(*referenceNode); ok {
+			issues = lintReference(issues, text, nested, AnyVariableReference)
+		}
+	}
+
+	return issues
+}
+
+func lintHasNested(name string, nested []VariableReference) bool {
+	for _, r := range nested {
+		if strings.Contains(name, r.Match) {
+			return true
+		}
+	}
+	return false
+}
+
+func lintTag(t string) (string, string) {
+	opt := t
+	if ndx := strings.Index(t, "="); ndx >= 0 {
+		opt = t[:ndx+1]
+	}
+
+	if _, ok := optsMap[opt]; !ok {
+		if _, ok = lookupFormatOption(opt); ok {
+			return "", ""
+		}
+
+		if strings.Contains(t, "=") {
+			return LintSeverityError, fmt.Sprintf("unknown format option %s", t)
+		}
+
+		if lintSprintfRegexp.MatchString("%"+t) || isTimeLayout(t) {
+			return LintSeverityWarning, fmt.Sprintf("format option %s is taken as a time layout or sprintf verb: use %s or %s", t, FormatOptTimeLayout, FormatOptSprintf)
+		}
+
+		return LintSeverityError, fmt.Sprintf("unknown format option %s", t)
+	}
+
+	arg := strings.TrimPrefix(t, opt)
+	switch opt {
+	case FormatOptSprintf:
+		if !lintSprintfRegexp.MatchString("%" + arg) {
+			return LintSeverityError, fmt.Sprintf("malformed sprintf verb %s", arg)
+		}
+	case FormatOptTimeLayout:
+		if !isTimeLayout(arg) {
+			return LintSeverityError, fmt.Sprintf("malformed time layout %s", arg)
+		}
+	}
+
+	return "", ""
+}
+
+// isTimeLayout tells if the text holds at least a layout element: formatting a time leaves a text without elements as is.
+func isTimeLayout(layout string) bool {
+	return layout != "" && lintLayoutTime.Format(layout) != layout
+}
+
+func lintPosition(text string, offset int) (int, int) {
+	line := strings.Count(text[:offset], "\n") + 1
+	lineStart := strings.LastIndex(text[:offset], "\n") + 1
+	return line, utf8.RuneCountInString(text[lineStart:offset]) + 1
+}
@@ -0,0 +1,403 @@
+package varResolver
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// FallbackSeparator separates the alternatives of a reference such as {$.a.b|v:default|env:X|'literal'}.
+	FallbackSeparator = "|"
+	// FallbackLiteralQuote encloses the literal alternative of a fallback chain.
+	FallbackLiteralQuote = '\''
+
+	DefaultMaxResolutionDepth = 10
+)
+
+var (
+	ErrReferenceCycle   = errors.New("variable reference cycle")
+	ErrMaxDepthExceeded = errors.New("variable reference max depth exceeded")
+
+	// errIncompleteReference is raised when the text ends inside what could be a reference.
+	errIncompleteReference = errors.New("incomplete variable reference")
+)
+
+type ResolveOption func(o *resolveOptions)
+
+type resolveOptions struct {
+	maxDepth  int
+	recursive bool
+}
+
+// WithMaxDepth bounds the nesting of the references and, with WithRecursiveValues, the depth of the resolution of the values.
+func WithMaxDepth(n int) ResolveOption {
+	return func(o *resolveOptions) {
+		o.maxDepth = n
+	}
+}
+
+// WithRecursiveValues resolves in turn the references found in the resolved values. A reference met again while resolving its own value is reported as ErrReferenceCycle.
+func WithRecursiveValues(b bool) ResolveOption {
+	return func(o *resolveOptions) {
+		o.recursive = b
+	}
+}
+
+// referenceNode is a reference whose name is made of text and nested references, as in {v:prefix-{v:env}}.
+type referenceNode struct {
+	mapping    PrefixSuffixTypeMapping
+	parts      []interface{}
+	start, end int
+}
+
+// reference is the VariableReference of the node found in the text s.
+func (n *referenceNode) reference(s string) VariableReference {
+	r := VariableReference{RefType: n.mapping.Type, Match: s[n.start:n.end], VarName: s[n.start+len(n.mapping.Prefix) : n.end-len(n.mapping.Suffix)]}
+	for _, p := range n.parts {
+		if nested, ok := p.(*referenceNode); ok {
+			r.Nested = append(r.Nested, nested.reference(s))
+		}
+	}
+	return r
+}
+
+// scannedReference is a reference found by scanReferences, or the error raised by the one starting at start.
+type scannedReference struct {
+	node       *referenceNode
+	start, end int
+	err        error
+}
+
+// scanReferences returns the references of the text, the nested ones excluded. After a reference raising an error, as a suffix
+// not matching the prefix, the scan goes on from where the error was found.
+func scanReferences(s string, writerside bool) []scannedReference {
+	var refs []scannedReference
+	for pos := 0; pos < len(s); {
+		n, end, err := parseReference(s, pos, writerside)
+		switch {
+		case err != nil && !errors.Is(err, errIncompleteReference):
+			refs = append(refs, scannedReference{start: pos, end: end, err: err})
+		case n != nil:
+			refs = append(refs, scannedReference{node: n, start: pos})
+			pos = end
+			continue
+		}
+
+		if end > pos {
+			pos = end
+		} else {
+			pos++
+		}
+	}
+
+	return refs
+}
+
+// parseReferences splits the text in strings and references. A candidate reference that is not terminated or holds chars not allowed
+// in names is text, as it happens with FindVariableReferences. The writerside references cannot be nested because their prefix and suffix coincide.
+func parseReferences(s string, writerside bool) ([]interface{}, error) {
+	parts, _, err := parsePartialReferences(s, writerside, false, 0)
+	return parts, err
+}
+
+// parsePartialReferences parses the text up to the first reference not terminated when the text is partial, the beginning of a longer one.
+// It returns the length of the text parsed. References left incomplete and longer than maxIncomplete are taken as text.
+func parsePartialReferences(s string, writerside bool, partial bool, maxIncomplete int) ([]interface{}, int, error) {
+	var parts []interface{}
+	var sb strings.Builder
+	pos := 0
+	for pos < len(s) {
+		n, end, err := parseReference(s, pos, writerside)
+		if errors.Is(err, errIncompleteReference) {
+			if partial && len(s)-pos <= maxIncomplete {
+				break
+			}
+			n, err = nil, nil
+		}
+
+		if err != nil {
+			return nil, pos, err
+		}
+
+		if n == nil {
+			sb.WriteByte(s[pos])
+			pos++
+			continue
+		}
+
+		if sb.Len() > 0 {
+			parts = append(parts, sb.String())
+			sb.Reset()
+		}
+		parts = append(parts, n)
+		pos = end
+	}
+
+	if sb.Len() > 0 {
+		parts = append(parts, sb.String())
+	}
+
+	return parts, pos, nil
+}
+
+// referenceOpener checks if a reference begins at pos. It returns errIncompleteReference if the text ends before telling.
+func referenceOpener(s string, pos int, writerside bool) (PrefixSuffixTypeMapping, bool, error) {
+	var m PrefixSuffixTypeMapping
+	var ok bool
+
+	prefixes := []string{ScriptletPercentVariableReferencePrefix, ScriptletDashVariableReferencePrefix, DollarVariableReferencePrefix, SimpleVariableReferencePrefix}
+	if writerside {
+		prefixes = []string{WritersideVariableReferencePrefix}
+	}
+
+	for _, pfix := range prefixes {
+		if strings.HasPrefix(s[pos:], pfix) {
+			m, ok = PrefixMap[pfix], true
+			break
+		}
+
+		if len(s)-pos < len(pfix) && strings.HasPrefix(pfix, s[pos:]) {
+			return m, false, errIncompleteReference
+		}
+	}
+
+	if !ok {
+		return m, false, nil
+	}
+
+	// The name starts with a letter or a dollar. An exclamation mark, the json escape, can precede it but in writerside references.
+	ndx := pos + len(m.Prefix)
+	if !writerside && ndx < len(s) && s[ndx] == '!' {
+		ndx++
+	}
+
+	if ndx >= len(s) {
+		return m, false, errIncompleteReference
+	}
+
+	if !(isLetter(s[ndx]) || s[ndx] == '$') {
+		return m, false, nil
+	}
+
+	return m, true, nil
+}
+
+// parseReference parses the reference at pos. It returns a nil node if there is no reference at pos.
+func parseReference(s string, pos int, writerside bool) (*referenceNode, int, error) {
+	m, ok, err := referenceOpener(s, pos, writerside)
+	if !ok {
+		return nil, pos, err
+	}
+
+	n := &referenceNode{mapping: m, start: pos}
+	var sb strings.Builder
+	for pos += len(m.Prefix); pos < len(s); {
+		if strings.HasPrefix(s[pos:], m.Suffix) {
+			if sb.Len() > 0 {
+				n.parts = append(n.parts, sb.String())
+			}
+			n.end = pos + len(m.Suffix)
+			return n, n.end, nil
+		}
+
+		if !writerside {
+			for _, sfix := range []string{SimpleVariableReferenceSuffix, ScriptletPercentVariableReferenceSuffix, ScriptletDashVariableReferenceSuffix} {
+				if strings.HasPrefix(s[pos:], sfix) {
+					return nil, pos, fmt.Errorf(SuffixErrorMessage, sfix, m.Prefix)
+				}
+			}
+
+			nested, end, err := parseReference(s, pos, writerside)
+			if err != nil {
+				return nil, pos, err
+			}
+
+			if nested != nil {
+				if sb.Len() > 0 {
+					n.parts = append(n.parts, sb.String())
+					sb.Reset()
+				}
+				n.parts = append(n.parts, nested)
+				pos = end
+				continue
+			}
+		}
+
+		c := s[pos]
+		switch {
+		case c == FallbackLiteralQuote:
+			end := strings.IndexByte(s[pos+1:], FallbackLiteralQuote)
+			if end < 0 {
+				return nil, pos, errIncompleteReference
+			}
+			sb.WriteString(s[pos : pos+end+2])
+			pos += end + 2
+		case isNameChar(c):
+			sb.WriteByte(c)
+			pos++
+		default:
+			return nil, pos, nil
+		}
+	}
+
+	return nil, pos, errIncompleteReference
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// isNameChar tells the chars allowed in names by VariableReferencePatternRegexpExt and the fallback separator.
+func isNameChar(c byte) bool {
+	return isLetter(c) || (c >= '0' && c <= '9') || strings.IndexByte(":,=@'$.\"*[]_-!|", c) >= 0
+}
+
+func hasReferences(parts []interface{}) bool {
+	for _, p := range parts {
+		if _, ok := p.(*referenceNode); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitFallbacks splits the alternatives of a fallback chain. Separators inside the quoted literals are not considered.
+// The name must not hold nested references: VariableReference.Alternatives splits the ones that do.
+func SplitFallbacks(name string) []string {
+	var alts []string
+	start, quoted := 0, false
+	for i := 0; i < len(name); i++ {
+		switch name[i] {
+		case FallbackLiteralQuote:
+			quoted = !quoted
+		case FallbackSeparator[0]:
+			if !quoted {
+				alts = append(alts, name[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(alts, name[start:])
+}
+
+// FallbackLiteral returns the text of a quoted literal alternative. A quoted name is a literal only in a chain of more alternatives.
+func FallbackLiteral(alt string) (string, bool) {
+	if len(alt) >= 2 && alt[0] == FallbackLiteralQuote && alt[len(alt)-1] == FallbackLiteralQuote {
+		return alt[1 : len(alt)-1], true
+	}
+	return "", false
+}
+
+// Alternatives splits the name of the reference in the alternatives of its fallback chain: a name without fallbacks is its only alternative.
+// The separators inside the nested references and the quoted literals are not considered.
+func (r VariableReference) Alternatives() []string {
+	var alts []string
+	start, quoted, k := 0, false, 0
+	for i := 0; i < len(r.VarName); i++ {
+		if !quoted && k < len(r.Nested) && strings.HasPrefix(r.VarName[i:], r.Nested[k].Match) {
+			i += len(r.Nested[k].Match) - 1
+			k++
+			continue
+		}
+
+		switch r.VarName[i] {
+		case FallbackLiteralQuote:
+			quoted = !quoted
+		case FallbackSeparator[0]:
+			if !quoted {
+				alts = append(alts, r.VarName[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(alts, r.VarName[start:])
+}
+
+type resolution struct {
+	current   string
+	ofType    VariableReferenceType
+	resolver  VariableResolverFunc
+	opts      resolveOptions
+	resolving []string
+}
+
+func (r *resolution) resolveParts(parts []interface{}, depth int) (string, bool, error) {
+	var sb strings.Builder
+	rcDeferred := false
+	for _, p := range parts {
+		switch tp := p.(type) {
+		case string:
+			sb.WriteString(tp)
+		case *referenceNode:
+			s, deferred, err := r.resolveNode(tp, depth)
+			if err != nil {
+				return "", false, err
+			}
+			rcDeferred = rcDeferred || deferred
+			sb.WriteString(s)
+		}
+	}
+
+	return sb.String(), rcDeferred, nil
+}
+
+// resolveNode resolves the nested references first and then the reference named after them.
+func (r *resolution) resolveNode(n *referenceNode, depth int) (string, bool, error) {
+	if depth > r.opts.maxDepth {
+		return "", false, fmt.Errorf("%w: %d", ErrMaxDepthExceeded, r.opts.maxDepth)
+	}
+
+	name, deferred, err := r.resolveParts(n.parts, depth+1)
+	if err != nil {
+		return "", false, err
+	}
+
+	if deferred || (n.mapping.Type != r.ofType && r.ofType != AnyVariableReference) {
+		return n.mapping.Type.ToVar(name), deferred, nil
+	}
+
+	var resolved string
+	alts := SplitFallbacks(name)
+	for _, alt := range alts {
+		if lit, ok := FallbackLiteral(alt); ok && len(alts) > 1 {
+			resolved = lit
+			break
+		}
+
+		resolved, deferred = r.resolver(r.current, alt)
+		if deferred {
+			if len(alts) > 1 {
+				return n.mapping.Type.ToVar(name), true, nil
+			}
+			return n.mapping.Type.ToVar(resolved), true, nil
+		}
+
+		if resolved != "" {
+			break
+		}
+	}
+
+	if !r.opts.recursive {
+		return resolved, false, nil
+	}
+
+	key := n.mapping.Type.ToVar(name)
+	for _, k := range r.resolving {
+		if k == key {
+			return "", false, fmt.Errorf("%w: %s -> %s", ErrReferenceCycle, strings.Join(r.resolving, " -> "), key)
+		}
+	}
+
+	parts, err := parseReferences(resolved, r.ofType == WritersideVariableReference)
+	if err != nil || !hasReferences(parts) {
+		return resolved, false, err
+	}
+
+	r.resolving = append(r.resolving, key)
+	resolved, deferred, err = r.resolveParts(parts, depth+1)
+	r.resolving = r.resolving[:len(r.resolving)-1]
+	return resolved, deferred, err
+}
@@ -13,6 +13,7 @@ type VariableReference struct {
 	RefType VariableReferenceType
 	Match   string
 	VarName string
+	Nested  []VariableReference
 }
 
 type VariableReferenceType string
@@ -78,6 +79,7 @@ var VariableReferencePatternRegexp = regexp.MustCompile("((?:<[%#]=)|(?:\\$\\{)|
 
 // VariableReferencePatternRegexpExt sort of extended mode with names of vars starting with letters or the dollar sign followed by more possible chars.
 // V1 - Tried to include symbols from https://goessner.net/articles/JsonPath/
+// It doesn't match the nested references and the fallback chains: FindVariableReferences does.
 var VariableReferencePatternRegexpExt = regexp.MustCompile("((?:<[%#]=)|(?:\\$\\{)|{)(!?[$a-zA-Z][:,=@'$\\.\\\"\\*\\[\\]a-zA-Z0-9_\\-]*)([%#]>|})")
 
 // PercentVariableReferencePatternRegexp to include %pattern%. It's need separated from others and use for writerside type of variables.
@@ -107,35 +109,19 @@ var PrefixMap = map[string]PrefixSuffixTypeMapping{
 	},
 }
 
+// FindVariableReferences returns the references of the given type found in the text. The references nested in the name of another one,
+// as in {v:prefix-{v:env}}, are returned among the Nested ones of the latter.
 func FindVariableReferences(s string, ofType VariableReferenceType) ([]VariableReference, error) {
 
-	rxp := VariableReferencePatternRegexpExt
-	if ofType == WritersideVariableReference {
-		rxp = PercentVariableReferencePatternRegexp
-	}
-	matches := rxp.FindAllSubmatch([]byte(s), -1)
-
 	var resp []VariableReference
-	for _, m := range matches {
-
-		pfix := string(m[1])
-		varname := string(m[2])
-		sfix := string(m[3])
-
-		refType, ok := PrefixMap[pfix]
-		if !ok {
-			return nil, fmt.Errorf("cannot find a match for prefix %s", pfix)
-		}
-
-		requiredSuffix := refType.Suffix
-		if sfix != requiredSuffix {
-			return nil, fmt.Errorf("suffix %s doesn't match prefix %s", sfix, pfix)
+	for _, sr := range scanReferences(s, ofType == WritersideVariableReference) {
+		if sr.err != nil {
+			return nil, sr.err
 		}
 
-		if refType.Type == ofType || ofType == AnyVariableReference {
-			resp = append(resp, VariableReference{RefType: refType.Type, Match: string(m[0]), VarName: varname})
+		if sr.node.mapping.Type == ofType || ofType == AnyVariableReference {
+			resp = append(resp, sr.node.reference(s))
 		}
-
 	}
 
 	return resp, nil
@@ -143,26 +129,28 @@ func FindVariableReferences(s string, ofType VariableReferenceType) ([]VariableR
 
 type VariableResolverFunc func(current string, s string) (string, bool)
 
-func ResolveVariables(s string, ofType VariableReferenceType, aResolver VariableResolverFunc, trimResult bool) (string, bool, error) {
+// ResolveVariables replaces the references of the given type with the values provided by the resolver.
+// References can be nested, as in {v:prefix-{v:env}}, and are resolved inside-out. A reference can list fallback alternatives,
+// as in {$.a.b|v:default|env:X|'literal'}: the first alternative resolving to a non-empty text is taken and the quoted literal always resolves.
+func ResolveVariables(s string, ofType VariableReferenceType, aResolver VariableResolverFunc, trimResult bool, opts ...ResolveOption) (string, bool, error) {
 
 	if s == "" {
 		return s, true, nil
 	}
 
-	vars, err := FindVariableReferences(s, ofType)
-	if err != nil || len(vars) == 0 {
+	r := resolution{current: s, ofType: ofType, resolver: aResolver, opts: resolveOptions{maxDepth: DefaultMaxResolutionDepth}}
+	for _, o := range opts {
+		o(&r.opts)
+	}
+
+	parts, err := parseReferences(s, ofType == WritersideVariableReference)
+	if err != nil || !hasReferences(parts) {
 		return s, false, err
 	}
 
-	rcDeferred := false
-	for _, v := range vars {
-		resolved, deferred := aResolver(s, v.VarName)
-		if deferred {
-			s = strings.ReplaceAll(s, v.Match, v.RefType.ToVar(resolved))
-			rcDeferred = true
-		} else {
-			s = strings.ReplaceAll(s, v.Match, resolved)
-		}
+	s, rcDeferred, err := r.resolveParts(parts, 1)
+	if err != nil {
+		return "", false, err
 	}
 
 	return strings.TrimSpace(s), rcDeferred, nil
@@ -2,8 +2,10 @@ package varResolver_test
 
 import (
 	"fmt"
+	"io"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/GPA-Gruppo-Progetti-Avanzati-SRL/tpm-common/util/expression/funcs"
@@ -125,3 +127,197 @@ func TestVariableValueFormat(t *testing.T) {
 	}
 
 }
+
+func TestResolveNestedAndFallbackReferences(t *testing.T) {
+
+	m := map[string]interface{}{
+		"env":         "prod",
+		"prefix-prod": "db.prod.local",
+		"default":     "DEFAULT",
+		"self":        "{v:self}",
+		"a":           "<{v:b}>",
+		"b":           "B",
+	}
+
+	var tests = []struct {
+		input   string
+		refType vars.VariableReferenceType
+		wanted  string
+	}{
+		{input: "host: {v:prefix-{v:env}}", refType: vars.SimpleVariableReference, wanted: "host: db.prod.local"},
+		{input: "host: ${v:prefix-${v:env}}", refType: vars.DollarVariableReference, wanted: "host: db.prod.local"},
+		{input: "host: <%=v:prefix-{v:env}%>", refType: vars.AnyVariableReference, wanted: "host: db.prod.local"},
+		{input: "host: <#=v:prefix-<#=v:env#>#>", refType: vars.ScriptletDashVariableReference, wanted: "host: db.prod.local"},
+		{input: "{v:missing|v:default|'literal'}", refType: vars.SimpleVariableReference, wanted: "DEFAULT"},
+		{input: "${v:missing|v:not-there|'lit|eral}'}", refType: vars.DollarVariableReference, wanted: "lit|eral}"},
+		{input: "%v:missing|v:env%", refType: vars.WritersideVariableReference, wanted: "prod"},
+		{input: "${v:missing|v:env} {v:env}", refType: vars.DollarVariableReference, wanted: "prod {v:env}"},
+		{input: `{"a": 1} {v:env}`, refType: vars.SimpleVariableReference, wanted: `{"a": 1} prod`},
+		{input: "{v:a}", refType: vars.SimpleVariableReference, wanted: "<{v:b}>"},
+	}
+
+	for i, tc := range tests {
+		s, _, err := vars.ResolveVariables(tc.input, tc.refType, vars.SimpleMapResolver(m), true)
+		require.NoError(t, err, "test: %d - %s", i, tc.input)
+		require.Equal(t, tc.wanted, s, "test: %d - %s", i, tc.input)
+	}
+
+	s, _, err := vars.ResolveVariables("{v:a}", vars.SimpleVariableReference, vars.SimpleMapResolver(m), true, vars.WithRecursiveValues(true))
+	require.NoError(t, err)
+	require.Equal(t, "<B>", s)
+
+	_, _, err = vars.ResolveVariables("{v:self}", vars.SimpleVariableReference, vars.SimpleMapResolver(m), true, vars.WithRecursiveValues(true))
+	require.ErrorIs(t, err, vars.ErrReferenceCycle)
+
+	_, _, err = vars.ResolveVariables("{v:prefix-{v:env}}", vars.SimpleVariableReference, vars.SimpleMapResolver(m), true, vars.WithMaxDepth(1))
+	require.ErrorIs(t, err, vars.ErrMaxDepthExceeded)
+
+	refs, err := vars.FindVariableReferences("host: {v:prefix-{v:env|'dev'}|v:default|'n/a'} {v:env}", vars.AnyVariableReference)
+	require.NoError(t, err)
+	require.Len(t, refs, 2)
+	require.Equal(t, "{v:prefix-{v:env|'dev'}|v:default|'n/a'}", refs[0].Match)
+	require.Equal(t, []string{"v:prefix-{v:env|'dev'}", "v:default", "'n/a'"}, refs[0].Alternatives())
+	require.Len(t, refs[0].Nested, 1)
+	require.Equal(t, []string{"v:env", "'dev'"}, refs[0].Nested[0].Alternatives())
+	require.Equal(t, "v:env", refs[1].VarName)
+}
+
+func TestVariableFormatOptions(t *testing.T) {
+
+	err := vars.RegisterFormatOption("reverse", func(v interface{}, _ string) (interface{}, error) {
+		r := []rune(fmt.Sprint(v))
+		for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+			r[i], r[j] = r[j], r[i]
+		}
+		return string(r), nil
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, vars.UnregisterFormatOption("reverse")) })
+
+	require.Error(t, vars.UnregisterFormatOption(vars.FormatOptUpper))
+	require.Error(t, vars.RegisterFormatOption("reverse", func(v interface{}, _ string) (interface{}, error) { return v, nil }))
+	require.Error(t, vars.RegisterFormatOption(vars.FormatOptLen, func(v interface{}, _ string) (interface{}, error) { return v, nil }))
+
+	var tests = []struct {
+		input  string
+		value  interface{}
+		wanted string
+	}{
+		{input: "{v:x,upper}", value: "abc", wanted: "ABC"},
+		{input: "{v:x,lower}", value: "ABC", wanted: "abc"},
+		{input: "{v:x,b64}", value: "abc", wanted: "YWJj"},
+		{input: "{v:x,sha256}", value: "abc", wanted: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{input: "{v:x,mask=4}", value: "4111111111111111", wanted: "************1111"},
+		{input: "{v:x,mask=-2}", value: "ABCDE", wanted: "AB***"},
+		{input: "{v:x,date-from=20060102,tml=02/01/2006}", value: "20240315", wanted: "15/03/2024"},
+		{input: "{v:x,round=2}", value: 12.345, wanted: "12.35"},
+		{input: "{v:x,round=0}", value: "7.5", wanted: "8"},
+		{input: "{v:x,round=2}", value: 1.005, wanted: "1.01"},
+		{input: "{v:x,round=2}", value: "-1.005", wanted: "-1.01"},
+		{input: "{v:x,round=1}", value: 3, wanted: "3.0"},
+		{input: "{v:x,substr=1:3}", value: "abcdef", wanted: "bc"},
+		{input: "{v:x,substr=3}", value: "abcdef", wanted: "def"},
+		{input: "{v:x,substr=0:3,upper,reverse}", value: "abcdef", wanted: "CBA"},
+		{input: "{v:x,upper,len=2}", value: "abcdef", wanted: "AB"},
+		{input: "{v:x,upper,onf=none}", value: nil, wanted: "none"},
+	}
+
+	for i, tc := range tests {
+		v, err := vars.ParseVariable(strings.Trim(tc.input, "{}"))
+		require.NoError(t, err)
+
+		res, err := v.ToString(tc.value, false, false)
+		require.NoError(t, err, "test: %d - %s", i, tc.input)
+		require.Equal(t, tc.wanted, res, "test: %d - %s", i, tc.input)
+	}
+
+	v, err := vars.ParseVariable("v:x,round=a")
+	require.NoError(t, err)
+	_, err = v.ToString("1.5", false, false)
+	require.Error(t, err)
+
+	v, err = vars.ParseVariable("v:x,unknown-opt")
+	require.NoError(t, err)
+	_, err = v.ToString("abc", false, false)
+	require.NoError(t, err)
+
+	vars.SetStrictFormatOptions(true)
+	defer vars.SetStrictFormatOptions(false)
+	_, err = v.ToString("abc", false, false)
+	require.ErrorIs(t, err, vars.ErrUnknownFormatOption)
+}
+
+func TestLint(t *testing.T) {
+
+	text := `app:
+  host: ${HOST}
+  port: ${PORT,sprf=05d}
+  name: ${x:name}
+  date: ${today,tml=yyyy} ${today,20060102}
+  opt: ${MY_VAR,unknown=1} ${MY_VAR,upper,mask=4}
+  path: ${$.a.b}
+  bad: <%=VAR} ok
+  àè: ${v:x,sprf=ss}
+`
+
+	issues := vars.Lint(text, vars.AnyVariableReference)
+	for _, i := range issues {
+		t.Log(i.String())
+	}
+
+	wanted := []struct {
+		line     int
+		column   int
+		severity string
+	}{
+		{line: 4, column: 9, severity: vars.LintSeverityError},
+		{line: 5, column: 9, severity: vars.LintSeverityError},
+		{line: 5, column: 27, severity: vars.LintSeverityWarning},
+		{line: 6, column: 8, severity: vars.LintSeverityError},
+		{line: 7, column: 9, severity: vars.LintSeverityWarning},
+		{line: 8, column: 8, severity: vars.LintSeverityError},
+		{line: 9, column: 7, severity: vars.LintSeverityError},
+	}
+
+	require.Len(t, issues, len(wanted))
+	for i, w := range wanted {
+		require.Equal(t, w.line, issues[i].Line, "issue %d", i)
+		require.Equal(t, w.column, issues[i].Column, "issue %d", i)
+		require.Equal(t, w.severity, issues[i].Severity, "issue %d", i)
+	}
+
+	require.Empty(t, vars.Lint("${HOST} %v:x%", vars.WritersideVariableReference))
+}
+
+func TestResolveVariablesStream(t *testing.T) {
+
+	m := map[string]interface{}{
+		"env":         "prod",
+		"prefix-prod": "db.prod.local",
+		"name":        "MARIO ROSSI",
+	}
+
+	input := `
+  {"host": "{v:prefix-{v:env}}", "name": "{v:name,upper}", "missing": "{v:missing|'n/a'}", "json": {"a": 1}, "tail": "{v:env}$"}
+ `
+
+	wanted, _, err := vars.ResolveVariables(input, vars.SimpleVariableReference, vars.SimpleMapResolver(m), true)
+	require.NoError(t, err)
+	require.Contains(t, wanted, `"host": "db.prod.local"`)
+
+	for _, r := range []io.Reader{strings.NewReader(input), iotest.OneByteReader(strings.NewReader(input)), iotest.HalfReader(strings.NewReader(input))} {
+		var sb strings.Builder
+		_, err = vars.ResolveVariablesStream(r, &sb, vars.SimpleVariableReference, vars.SimpleMapResolver(m), true)
+		require.NoError(t, err)
+		require.Equal(t, wanted, sb.String())
+	}
+
+	var sb strings.Builder
+	deferred, err := vars.ResolveVariablesStream(iotest.OneByteReader(strings.NewReader("a %v:env% ${v:env,defer} ")), &sb, vars.WritersideVariableReference, vars.SimpleMapResolver(m), false)
+	require.NoError(t, err)
+	require.False(t, deferred)
+	require.Equal(t, "a prod ${v:env,defer} ", sb.String())
+
+	_, err = vars.ResolveVariablesStream(iotest.TimeoutReader(strings.NewReader(strings.Repeat("x", vars.StreamBufferSize+1))), &sb, vars.SimpleVariableReference, vars.SimpleMapResolver(m), false)
+	require.ErrorIs(t, err, iotest.ErrTimeout)
+}
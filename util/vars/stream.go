@@ -0,0 +1,103 @@
+package varResolver
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"unicode"
+)
+
+const (
+	StreamBufferSize = 32 * 1024
+	// StreamMaxReferenceLength is the length beyond which a reference not yet terminated at the end of a buffer is taken as text.
+	StreamMaxReferenceLength = 4 * 1024
+)
+
+// ResolveVariablesStream is the streaming counterpart of ResolveVariables: the text is read from r in buffers and the resolved text written to w.
+// References split across buffers are held back until complete. The current text passed to the resolver is the part of the input being resolved, not the whole input.
+// If trimResult is set the leading and trailing white space of the whole output is removed.
+func ResolveVariablesStream(r io.Reader, w io.Writer, ofType VariableReferenceType, aResolver VariableResolverFunc, trimResult bool, opts ...ResolveOption) (bool, error) {
+
+	res := resolution{ofType: ofType, resolver: aResolver, opts: resolveOptions{maxDepth: DefaultMaxResolutionDepth}}
+	for _, o := range opts {
+		o(&res.opts)
+	}
+
+	var out io.Writer = w
+	var tw *trimWriter
+	if trimResult {
+		tw = &trimWriter{w: w}
+		out = tw
+	}
+
+	writerside := ofType == WritersideVariableReference
+	rcDeferred := false
+	buf := make([]byte, StreamBufferSize)
+	var pending []byte
+	for eof := false; !eof; {
+		n, err := r.Read(buf)
+		pending = append(pending, buf[:n]...)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				return rcDeferred, err
+			}
+			eof = true
+		}
+
+		s := string(pending)
+		parts, parsed, err := parsePartialReferences(s, writerside, !eof, StreamMaxReferenceLength)
+		if err != nil {
+			return rcDeferred, err
+		}
+
+		res.current = s[:parsed]
+		resolved, deferred, err := res.resolveParts(parts, 1)
+		if err != nil {
+			return rcDeferred, err
+		}
+		rcDeferred = rcDeferred || deferred
+
+		if _, err = io.WriteString(out, resolved); err != nil {
+			return rcDeferred, err
+		}
+
+		pending = pending[parsed:]
+	}
+
+	return rcDeferred, nil
+}
+
+// trimWriter drops the leading white space of the output and holds back the trailing one until more text follows.
+type trimWriter struct {
+	w       io.Writer
+	started bool
+	spaces  []byte
+}
+
+func (tw *trimWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if !tw.started {
+		p = bytes.TrimLeftFunc(p, unicode.IsSpace)
+		if len(p) == 0 {
+			return n, nil
+		}
+		tw.started = true
+	}
+
+	text := bytes.TrimRightFunc(p, unicode.IsSpace)
+	if len(text) > 0 {
+		if len(tw.spaces) > 0 {
+			if _, err := tw.w.Write(tw.spaces); err != nil {
+				return 0, err
+			}
+			tw.spaces = tw.spaces[:0]
+		}
+
+		if _, err := tw.w.Write(text); err != nil {
+			return 0, err
+		}
+	}
+
+	tw.spaces = append(tw.spaces, p[len(text):]...)
+	return n, nil
+}
@@ -102,6 +102,11 @@ func (vr Variable) Raw() string {
 	return strings.Join(s, ",")
 }
 
+// HasTags reports if the reference carries format options.
+func (vr Variable) HasTags() bool {
+	return len(vr.tags) > 0
+}
+
 func (vr Variable) IsTagPresent(tag string) bool {
 	for i := 0; i < len(vr.tags); i++ {
 		if resolveFormatOption(vr.tags[i]) == tag {
@@ -117,14 +122,27 @@ func (vr Variable) IsTagPresent(tag string) bool {
 func (vr Variable) ToString(v interface{}, jsonEscape bool, skipOpts bool) (string, error) {
 	const semLogContext = "variable::to-string"
 
-	opts := vr.getOpts(v, skipOpts)
+	var err error
+	if !skipOpts {
+		v, err = vr.applyFormatOptions(v)
+		if err != nil {
+			log.Error().Err(err).Msg(semLogContext)
+			return "", err
+		}
+	}
+
+	opts, err := vr.getOpts(v, skipOpts)
+	if err != nil {
+		log.Error().Err(err).Msg(semLogContext)
+		return "", err
+	}
+
 	if isOnf(v) {
 		v = opts.DefaultValue
 	}
 
 	var res string
 	var b []byte
-	var err error
 
 	if opts.TrimSpace {
 		if s, ok := v.(string); ok {
@@ -277,6 +295,10 @@ func resolveFormatOption(s string) string {
 	}
 
 	_, ok := optsMap[s]
+	if !ok {
+		_, ok = lookupFormatOption(s)
+	}
+
 	if !ok {
 		log.Info().Str("opt", s).Msg(semLogContext + " format option not found")
 		return ""
@@ -308,7 +330,7 @@ func getPrefix(s string, defaultPrefix VariablePrefix) VariablePrefix {
 	return defaultPrefix
 }
 
-func (vr Variable) getOpts(value interface{}, skipOpts bool) VariableOpts {
+func (vr Variable) getOpts(value interface{}, skipOpts bool) (VariableOpts, error) {
 
 	const semLogContext = "variable-name::get-opts"
 
@@ -420,6 +442,15 @@ func (vr Variable) getOpts(value interface{}, skipOpts bool) VariableOpts {
 				}
 
 			default:
+				// The registered options have already been applied.
+				if _, ok := lookupFormatOption(formatOption); ok {
+					continue
+				}
+
+				if strictFormatOptions.Load() {
+					return opts, fmt.Errorf("%w: %s", ErrUnknownFormatOption, vr.tags[i])
+				}
+
 				switch value.(type) {
 				case time.Time:
 					opts.Format = vr.tags[i]
@@ -448,7 +479,7 @@ func (vr Variable) getOpts(value interface{}, skipOpts bool) VariableOpts {
 		}
 	}
 
-	return opts
+	return opts, nil
 }
 
 func isOnf(value interface{}) bool {